@@ -1,3 +1,6 @@
+//go:build amd64 || arm64
+// +build amd64 arm64
+
 package goj
 
 import (
@@ -6,8 +9,6 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-const maxTestBufSize = 17317
-
 func TestScanNumbers(t *testing.T) {
 	buf := make([]byte, maxTestBufSize)
 	for i := 0; i < maxTestBufSize; i++ {
@@ -51,3 +52,40 @@ func TestScanNonSpecialStringChars(t *testing.T) {
 		assert.Equal(t, maxTestBufSize, i+x)
 	}
 }
+
+func TestScanStringStopsAtControlChars(t *testing.T) {
+	for _, c := range []byte{0x00, 0x01, 0x1f, '"', '\\'} {
+		buf := []byte("0123456789abcdefghij")
+		buf[17] = c
+		assert.Equal(t, 17, scanNonSpecialStringCharsASM(buf, 0))
+		assert.Equal(t, scanNonSpecialStringCharsGo(buf, 3), scanNonSpecialStringCharsASM(buf, 3))
+	}
+}
+
+func TestScanBracesAndBrackets(t *testing.T) {
+	buf := make([]byte, maxTestBufSize)
+	for i := 0; i < maxTestBufSize; i++ {
+		buf[i] = byte('a' + (i % 26))
+	}
+	for i := 0; i < maxTestBufSize; i += 7 {
+		assert.Equal(t, maxTestBufSize, i+scanBraces(buf, i))
+		assert.Equal(t, maxTestBufSize, i+scanBrackets(buf, i))
+	}
+	for _, c := range []byte{'{', '}', '"'} {
+		buf := []byte("0123456789abcdefghij[]")
+		buf[17] = c
+		assert.Equal(t, 17, scanBraces(buf, 0))
+		if c == '"' {
+			assert.Equal(t, 17, scanBrackets(buf, 0))
+		} else {
+			assert.Equal(t, 20, scanBrackets(buf, 0))
+		}
+	}
+	for _, c := range []byte{'[', ']'} {
+		buf := []byte("0123456789abcdefghij{}")
+		buf[17] = c
+		assert.Equal(t, 17, scanBrackets(buf, 0))
+		assert.Equal(t, 17, scanBrackets(buf, 3)+3)
+		assert.Equal(t, 20, scanBraces(buf, 0))
+	}
+}
@@ -0,0 +1,179 @@
+package goj
+
+import (
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Canonicalize returns the JSON document in buf in the canonical form of
+// RFC 8785, the JSON Canonicalization Scheme: without insignificant
+// whitespace, with the members of objects ordered by the UTF-16 code units
+// of their keys, numbers written as ECMAScript does, and strings with only
+// the escapes JSON requires.
+//
+// Documents which have no canonical form are rejected: those with
+// duplicate keys, numbers too large for a float64, or strings which are not
+// valid Unicode.
+func Canonicalize(buf []byte) ([]byte, error) {
+	c := canonicalizer{w: NewWriter(nil)}
+	it := NewIterator(buf)
+	t, _, v, err := it.Next()
+	if err == io.EOF {
+		return nil, errors.New("goj: unexpected end of JSON input")
+	} else if err != nil {
+		return nil, err
+	}
+	ents, err := collect(it, t, v)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.write(ents, 0); err != nil {
+		return nil, err
+	}
+	if _, _, _, err := it.Next(); err != io.EOF {
+		return nil, err
+	}
+	return c.w.Bytes(), nil
+}
+
+type canonicalizer struct {
+	w     *Writer
+	order []int // the contents of the containers being written
+}
+
+// write writes the entity ents[i], collected by collect, and all of its
+// contents.
+func (c *canonicalizer) write(ents []entity, i int) error {
+	e := &ents[i]
+	switch e.t {
+	case Object, Array:
+		start := len(c.order)
+		c.order = contents(c.order, ents, i)
+		end := len(c.order)
+		if e.t == Object {
+			members := c.order[start:end]
+			sort.SliceStable(members, func(a, b int) bool {
+				return lessUTF16(ents[members[a]].key, ents[members[b]].key)
+			})
+			c.w.BeginObject()
+		} else {
+			c.w.BeginArray()
+		}
+		for n := start; n < end; n++ {
+			j := c.order[n]
+			if m := &ents[j]; e.t == Object {
+				if err := checkString(m.key, m.keyText); err != nil {
+					return err
+				}
+				if n > start && string(m.key) == string(ents[c.order[n-1]].key) {
+					return errors.New("goj: duplicate key " + strconv.Quote(string(m.key)))
+				}
+				c.w.KeyBytes(m.key)
+			}
+			if err := c.write(ents, j); err != nil {
+				return err
+			}
+		}
+		c.order = c.order[:start]
+		if e.t == Object {
+			c.w.EndObject()
+		} else {
+			c.w.EndArray()
+		}
+	case String:
+		if err := checkString(e.v, e.text); err != nil {
+			return err
+		}
+		c.w.StringBytes(e.v)
+	case True:
+		c.w.Bool(true)
+	case False:
+		c.w.Bool(false)
+	case Null:
+		c.w.Null()
+	default:
+		f, err := strconv.ParseFloat(string(e.v), 64)
+		if math.IsInf(f, 0) {
+			return errors.New("goj: number " + string(e.v) + " is out of range")
+		} else if err != nil && f != 0 {
+			return err
+		}
+		if f == 0 {
+			// there is no negative zero in ECMAScript's output
+			f = 0
+		}
+		c.w.Float(f)
+	}
+	return nil
+}
+
+// lessUTF16 reports whether a sorts before b when both are compared as
+// sequences of UTF-16 code units.  This differs from comparing UTF-8 only
+// where characters beyond the Basic Multilingual Plane, written as
+// surrogate pairs, meet those from U+E000 to U+FFFF.
+func lessUTF16(a, b []byte) bool {
+	for len(a) > 0 && len(b) > 0 {
+		ra, na := utf8.DecodeRune(a)
+		rb, nb := utf8.DecodeRune(b)
+		if ra != rb {
+			// runes sharing a high surrogate differ in the low one
+			a1, a2 := utf16Units(ra)
+			b1, b2 := utf16Units(rb)
+			if a1 != b1 {
+				return a1 < b1
+			}
+			return a2 < b2
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return len(a) < len(b)
+}
+
+// utf16Units returns the UTF-16 code units of r: a surrogate pair, or r
+// itself and 0.
+func utf16Units(r rune) (rune, rune) {
+	if r >= 0x10000 {
+		return utf16.EncodeRune(r)
+	}
+	return r, 0
+}
+
+// checkString fails if the string s, which appeared in the input as raw,
+// is not valid Unicode.  The parser replaces unpaired surrogates written
+// as escapes, so those are looked for in raw.
+func checkString(s, raw []byte) error {
+	if !utf8.Valid(s) {
+		return errors.New("goj: invalid UTF-8 in string " + strconv.Quote(string(s)))
+	}
+	for i := 0; i+6 <= len(raw); i++ {
+		if raw[i] != '\\' {
+			continue
+		}
+		if raw[i+1] != 'u' {
+			i++
+			continue
+		}
+		r, _ := strconv.ParseUint(string(raw[i+2:i+6]), 16, 16)
+		switch {
+		case r >= 0xd800 && r < 0xdc00:
+			var lo uint64
+			if i+12 <= len(raw) && raw[i+6] == '\\' && raw[i+7] == 'u' {
+				lo, _ = strconv.ParseUint(string(raw[i+8:i+12]), 16, 16)
+			}
+			if lo < 0xdc00 || lo >= 0xe000 {
+				return errors.New("goj: unpaired surrogate in string " + strconv.Quote(string(raw)))
+			}
+			i += 11
+		case r >= 0xdc00 && r < 0xe000:
+			return errors.New("goj: unpaired surrogate in string " + strconv.Quote(string(raw)))
+		default:
+			i += 5
+		}
+	}
+	return nil
+}
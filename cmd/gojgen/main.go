@@ -0,0 +1,739 @@
+// gojgen generates specialized JSON decoders for Go struct types.
+//
+// Given a Go source file, gojgen writes a companion file which adds a
+// DecodeGoj(buf []byte) error method to every struct type declared in it
+// (or just those named with -type).  The generated code drives goj's scanner
+// directly: each struct gets a GojMember method which switches on key bytes,
+// converts scalars in place and skips unknown members without decoding them.
+// Field names and tags follow the encoding/json rules.  Types gojgen has no
+// specialized code for (those from other packages, interfaces, fixed size
+// arrays, []byte...) are decoded with goj.Unmarshal.
+//
+// Usage:
+//
+//	gojgen [-type T1,T2] [-o output.go] file.go
+//
+// or, from a go:generate directive:
+//
+//	//go:generate gojgen $GOFILE
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	typeList := flag.String("type", "", "comma separated list of types to generate decoders for (default: all structs in the file)")
+	output := flag.String("o", "", "output file (default: <file>_goj.go)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gojgen [-type T1,T2] [-o output.go] file.go\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	input := flag.Arg(0)
+
+	out := *output
+	if out == "" {
+		if strings.HasSuffix(input, "_test.go") {
+			out = strings.TrimSuffix(input, "_test.go") + "_goj_test.go"
+		} else {
+			out = strings.TrimSuffix(input, ".go") + "_goj.go"
+		}
+	}
+
+	var types []string
+	if *typeList != "" {
+		types = strings.Split(*typeList, ",")
+	}
+
+	src, err := Generate(input, out, types)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gojgen: %s\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(out, src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "gojgen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// typeDecl is a type declared in the package being generated for.
+type typeDecl struct {
+	name    string
+	expr    ast.Expr
+	methods map[string]bool
+}
+
+type generator struct {
+	decls   map[string]*typeDecl
+	buf     bytes.Buffer
+	frames  bytes.Buffer
+	done    map[string]bool // struct types and frame types already generated
+	queue   []string        // struct types waiting to be generated
+	pkgName string
+}
+
+// Generate returns the source of the decoders for the struct types declared
+// in the file input (or those of them listed in types), resolving other type
+// names against the rest of its package.  The file named by output, which may
+// not exist yet, is excluded from that package.
+func Generate(input, output string, types []string) ([]byte, error) {
+	g := &generator{
+		decls: make(map[string]*typeDecl),
+		done:  make(map[string]bool),
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, input, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	g.pkgName = f.Name.Name
+
+	// gather declarations from the rest of the package, so types declared in
+	// other files may be referred to
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(input), "*.go"))
+	for _, name := range files {
+		if sameFile(name, output) || sameFile(name, input) {
+			continue
+		}
+		if strings.HasSuffix(name, "_test.go") != strings.HasSuffix(input, "_test.go") {
+			continue
+		}
+		other, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil || other.Name.Name != g.pkgName || isGenerated(other) {
+			continue
+		}
+		g.collect(other)
+	}
+	g.collect(f)
+
+	var roots []string
+	if len(types) > 0 {
+		for _, t := range types {
+			d := g.decls[t]
+			if d == nil {
+				return nil, fmt.Errorf("type %s not found", t)
+			}
+			if _, ok := d.expr.(*ast.StructType); !ok {
+				return nil, fmt.Errorf("type %s is not a struct", t)
+			}
+			roots = append(roots, t)
+		}
+	} else {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if _, ok := ts.Type.(*ast.StructType); ok && ts.TypeParams == nil {
+					roots = append(roots, ts.Name.Name)
+				}
+			}
+		}
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no struct types found in %s", input)
+	}
+
+	for _, r := range roots {
+		g.enqueue(r)
+	}
+	for len(g.queue) > 0 {
+		name := g.queue[0]
+		g.queue = g.queue[1:]
+		if err := g.genStruct(name); err != nil {
+			return nil, err
+		}
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by gojgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\n", g.pkgName)
+	fmt.Fprintf(&src, "import \"github.com/lloyd/goj\"\n\n")
+	src.Write(g.buf.Bytes())
+	src.Write(g.frames.Bytes())
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %s\n%s", err, src.Bytes())
+	}
+	return formatted, nil
+}
+
+func sameFile(a, b string) bool {
+	if b == "" {
+		return false
+	}
+	aa, err1 := filepath.Abs(a)
+	bb, err2 := filepath.Abs(b)
+	return err1 == nil && err2 == nil && aa == bb
+}
+
+func isGenerated(f *ast.File) bool {
+	for _, c := range f.Comments {
+		if c.Pos() > f.Package {
+			break
+		}
+		if strings.HasPrefix(c.Text(), "Code generated ") {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) collect(f *ast.File) {
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.TypeParams != nil {
+					continue
+				}
+				td := g.decl(ts.Name.Name)
+				td.expr = ts.Type
+			}
+		case *ast.FuncDecl:
+			if d.Recv == nil || len(d.Recv.List) != 1 {
+				continue
+			}
+			recv := d.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			if id, ok := recv.(*ast.Ident); ok {
+				g.decl(id.Name).methods[d.Name.Name] = true
+			}
+		}
+	}
+}
+
+func (g *generator) decl(name string) *typeDecl {
+	td := g.decls[name]
+	if td == nil {
+		td = &typeDecl{name: name, methods: make(map[string]bool)}
+		g.decls[name] = td
+	}
+	return td
+}
+
+func (g *generator) enqueue(name string) {
+	if !g.done[name] {
+		g.done[name] = true
+		g.queue = append(g.queue, name)
+	}
+}
+
+// kind classifies how values of a type are decoded.
+type kind int
+
+const (
+	kFallback kind = iota
+	kScalar
+	kStruct
+	kPointer
+	kSlice
+	kMap
+)
+
+// scalar describes the goj.Frames helper used to decode a basic type.
+type scalar struct {
+	helper string // String, Bool, Int, Uint or Float
+	bits   int
+}
+
+var scalars = map[string]scalar{
+	"string":  {"String", 0},
+	"bool":    {"Bool", 0},
+	"int":     {"Int", 0},
+	"int8":    {"Int", 8},
+	"int16":   {"Int", 16},
+	"int32":   {"Int", 32},
+	"rune":    {"Int", 32},
+	"int64":   {"Int", 64},
+	"uint":    {"Uint", 0},
+	"uint8":   {"Uint", 8},
+	"byte":    {"Uint", 8},
+	"uint16":  {"Uint", 16},
+	"uint32":  {"Uint", 32},
+	"uint64":  {"Uint", 64},
+	"uintptr": {"Uint", 64},
+	"float32": {"Float", 32},
+	"float64": {"Float", 64},
+}
+
+// nativeTypes are the types returned by each goj.Frames helper.
+var nativeTypes = map[string]string{
+	"String": "string",
+	"Bool":   "bool",
+	"Int":    "int64",
+	"Uint":   "uint64",
+	"Float":  "float64",
+}
+
+// underlying resolves locally declared type names to their definition.  It
+// returns nil for names which are not declared in the package, or which have
+// custom unmarshaling methods.
+func (g *generator) underlying(e ast.Expr) ast.Expr {
+	for i := 0; i < 16; i++ {
+		id, ok := e.(*ast.Ident)
+		if !ok {
+			return e
+		}
+		if _, ok := scalars[id.Name]; ok {
+			return e
+		}
+		d := g.decls[id.Name]
+		if d == nil || d.expr == nil || d.methods["UnmarshalText"] || d.methods["UnmarshalJSON"] {
+			return nil
+		}
+		if _, ok := d.expr.(*ast.StructType); ok {
+			if i > 0 {
+				// a type defined as another struct type does not get
+				// its methods, so can't be pushed as a goj.Frame
+				return nil
+			}
+			return e
+		}
+		e = d.expr
+	}
+	return nil
+}
+
+func (g *generator) classify(e ast.Expr) (kind, ast.Expr) {
+	u := g.underlying(e)
+	switch t := u.(type) {
+	case *ast.Ident:
+		if _, ok := scalars[t.Name]; ok {
+			return kScalar, t
+		}
+		if d := g.decls[t.Name]; d != nil {
+			if _, ok := d.expr.(*ast.StructType); ok {
+				return kStruct, t
+			}
+		}
+	case *ast.StarExpr:
+		if k, _ := g.classify(t.X); k != kFallback {
+			return kPointer, t
+		}
+	case *ast.ArrayType:
+		if t.Len != nil {
+			break
+		}
+		if id, ok := g.underlying(t.Elt).(*ast.Ident); ok && (id.Name == "byte" || id.Name == "uint8") {
+			// base64 encoded
+			break
+		}
+		if g.supportedElem(t.Elt, true) {
+			return kSlice, t
+		}
+	case *ast.MapType:
+		if id, ok := g.underlying(t.Key).(*ast.Ident); !ok || id.Name != "string" {
+			break
+		}
+		if g.supportedElem(t.Value, false) {
+			return kMap, t
+		}
+	}
+	return kFallback, u
+}
+
+// supportedElem reports whether elements of type e can be decoded by a
+// generated slice or map frame.  Map elements are not addressable, which
+// rules out everything but scalars and pointers to structs.
+func (g *generator) supportedElem(e ast.Expr, addressable bool) bool {
+	k, u := g.classify(e)
+	switch k {
+	case kScalar:
+		return true
+	case kPointer:
+		pk, _ := g.classify(u.(*ast.StarExpr).X)
+		return addressable || pk == kStruct
+	case kFallback:
+		return false
+	}
+	return addressable
+}
+
+// field is a JSON object member mapped to a (possibly promoted) struct field.
+type field struct {
+	name    string
+	tagged  bool
+	quoted  bool
+	typ     ast.Expr
+	path    []string // selectors from the struct to the field
+	allocs  []string // embedded pointers (as selector paths) to allocate
+	allocTy []string // types of those pointers' targets
+}
+
+func parseTag(lit *ast.BasicLit) (string, string, bool) {
+	if lit == nil {
+		return "", "", false
+	}
+	tags, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", "", false
+	}
+	tag, ok := reflectTag(tags, "json")
+	if !ok {
+		return "", "", false
+	}
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		return tag[:i], tag[i+1:], true
+	}
+	return tag, "", true
+}
+
+// reflectTag is reflect.StructTag.Lookup.
+func reflectTag(tag, key string) (string, bool) {
+	for tag != "" {
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		tag = tag[i:]
+		if tag == "" {
+			break
+		}
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			break
+		}
+		name := tag[:i]
+		tag = tag[i+1:]
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			break
+		}
+		qvalue := tag[:i+1]
+		tag = tag[i+1:]
+		if key == name {
+			value, err := strconv.Unquote(qvalue)
+			if err != nil {
+				break
+			}
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func hasOption(opts, name string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fields lists the JSON members of struct type name, applying the
+// encoding/json rules for embedded structs: shallower fields hide deeper
+// ones, and at equal depth a single tagged field wins over untagged ones.
+func (g *generator) fields(name string) ([]field, error) {
+	type queued struct {
+		typ     string
+		path    []string
+		allocs  []string
+		allocTy []string
+	}
+	var result []field
+	taken := make(map[string]bool)
+	visited := make(map[string]bool)
+	next := []queued{{typ: name}}
+
+	for len(next) > 0 {
+		current := next
+		next = nil
+		var level []field
+		for _, q := range current {
+			if visited[q.typ] {
+				continue
+			}
+			visited[q.typ] = true
+			st := g.decls[q.typ].expr.(*ast.StructType)
+			for _, f := range st.Fields.List {
+				tagName, opts, _ := parseTag(f.Tag)
+				if tagName == "-" && opts == "" {
+					continue
+				}
+				if len(f.Names) == 0 {
+					// embedded
+					te := f.Type
+					ptr := false
+					if star, ok := te.(*ast.StarExpr); ok {
+						te, ptr = star.X, true
+					}
+					var fname string
+					switch x := te.(type) {
+					case *ast.Ident:
+						fname = x.Name
+					case *ast.SelectorExpr:
+						fname = x.Sel.Name
+					}
+					k, _ := g.classify(te)
+					path := append(append([]string(nil), q.path...), fname)
+					if tagName == "" && k == kStruct {
+						nq := queued{typ: te.(*ast.Ident).Name, path: path, allocs: q.allocs, allocTy: q.allocTy}
+						if ptr {
+							nq.allocs = append(append([]string(nil), q.allocs...), strings.Join(path, "."))
+							nq.allocTy = append(append([]string(nil), q.allocTy...), nq.typ)
+						}
+						next = append(next, nq)
+						continue
+					}
+					if tagName == "" {
+						if _, ok := te.(*ast.SelectorExpr); ok {
+							return nil, fmt.Errorf("%s: embedded %s from another package is not supported", name, exprString(f.Type))
+						}
+					}
+					if !ast.IsExported(fname) {
+						continue
+					}
+					level = append(level, g.newField(fname, tagName, opts, f.Type, path, q.allocs, q.allocTy))
+					continue
+				}
+				for _, n := range f.Names {
+					if !n.IsExported() {
+						continue
+					}
+					path := append(append([]string(nil), q.path...), n.Name)
+					level = append(level, g.newField(n.Name, tagName, opts, f.Type, path, q.allocs, q.allocTy))
+				}
+			}
+		}
+
+		for i := range level {
+			f := level[i]
+			if taken[f.name] {
+				continue
+			}
+			dominant := -1
+			count, tagged := 0, 0
+			for j := range level {
+				if level[j].name != f.name {
+					continue
+				}
+				count++
+				if level[j].tagged {
+					tagged++
+					dominant = j
+				}
+			}
+			taken[f.name] = true
+			if count == 1 {
+				dominant = i
+			} else if tagged != 1 {
+				continue
+			}
+			result = append(result, level[dominant])
+		}
+	}
+	return result, nil
+}
+
+func (g *generator) newField(goName, tagName, opts string, typ ast.Expr, path, allocs, allocTy []string) field {
+	f := field{
+		name:    goName,
+		tagged:  tagName != "",
+		typ:     typ,
+		path:    path,
+		allocs:  allocs,
+		allocTy: allocTy,
+	}
+	if tagName != "" {
+		f.name = tagName
+	}
+	if hasOption(opts, "string") {
+		if k, _ := g.classify(typ); k == kScalar {
+			f.quoted = true
+		}
+	}
+	return f
+}
+
+func exprString(e ast.Expr) string {
+	var b bytes.Buffer
+	format.Node(&b, token.NewFileSet(), e)
+	return b.String()
+}
+
+// typeName turns a type expression into a fragment of a Go identifier.
+func typeName(e ast.Expr) string {
+	switch t := e.(type) {
+	case *ast.Ident:
+		return strings.ToUpper(t.Name[:1]) + t.Name[1:]
+	case *ast.StarExpr:
+		return "Ptr" + typeName(t.X)
+	case *ast.ArrayType:
+		return "Slice" + typeName(t.Elt)
+	case *ast.MapType:
+		return "Map" + typeName(t.Key) + typeName(t.Value)
+	}
+	return "X"
+}
+
+func (g *generator) genStruct(name string) error {
+	fields, err := g.fields(name)
+	if err != nil {
+		return err
+	}
+	w := &g.buf
+	fmt.Fprintf(w, "// DecodeGoj decodes the JSON object in buf into x.\n")
+	fmt.Fprintf(w, "func (x *%s) DecodeGoj(buf []byte) error {\n", name)
+	fmt.Fprintf(w, "return goj.DecodeObject(buf, x)\n}\n\n")
+
+	fmt.Fprintf(w, "// GojMember decodes a member of a JSON object into x.  It implements\n")
+	fmt.Fprintf(w, "// goj.Frame.\n")
+	fmt.Fprintf(w, "func (x *%s) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {\n", name)
+	fmt.Fprintf(w, "switch string(key) {\n")
+	for _, f := range fields {
+		fmt.Fprintf(w, "case %s:\n", strconv.Quote(f.name))
+		for i, a := range f.allocs {
+			fmt.Fprintf(w, "if x.%s == nil {\nx.%s = new(%s)\n}\n", a, a, f.allocTy[i])
+		}
+		if f.quoted {
+			fmt.Fprintf(w, "t, value = s.Literal(t, key, value)\n")
+		}
+		g.genValue(w, f.typ, "x."+strings.Join(f.path, "."), true)
+	}
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "if k, ok := s.Fold(key, gojFields%s); ok {\n", typeName(ast.NewIdent(name)))
+	fmt.Fprintf(w, "return x.GojMember(s, t, k, value)\n}\n")
+	fmt.Fprintf(w, "return goj.Skip\n}\n\n")
+
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = fmt.Sprintf("[]byte(%s)", strconv.Quote(f.name))
+	}
+	fmt.Fprintf(w, "var gojFields%s = [][]byte{%s}\n\n", typeName(ast.NewIdent(name)), strings.Join(names, ", "))
+	return nil
+}
+
+// genValue writes statements which decode the current member (t, key, value)
+// into lhs, which has type e, and return the action for the parser.
+func (g *generator) genValue(w *bytes.Buffer, e ast.Expr, lhs string, addressable bool) {
+	k, u := g.classify(e)
+	typ := exprString(e)
+	switch k {
+	case kScalar:
+		sc := scalars[u.(*ast.Ident).Name]
+		if sc.helper == "String" || sc.helper == "Bool" {
+			fmt.Fprintf(w, "if v, ok := s.%s(t, key, value); ok {\n", sc.helper)
+		} else {
+			fmt.Fprintf(w, "if v, ok := s.%s(t, key, value, %d); ok {\n", sc.helper, sc.bits)
+		}
+		if typ == nativeTypes[sc.helper] {
+			fmt.Fprintf(w, "%s = v\n}\n", lhs)
+		} else {
+			fmt.Fprintf(w, "%s = %s(v)\n}\n", lhs, typ)
+		}
+		fmt.Fprintf(w, "return goj.Continue\n")
+	case kStruct:
+		fmt.Fprintf(w, "if t == goj.Null {\nreturn goj.Continue\n}\n")
+		fmt.Fprintf(w, "if t != goj.Object {\ns.TypeError(t, key, (*%s)(nil))\nreturn goj.Skip\n}\n", typ)
+		fmt.Fprintf(w, "s.Push(&%s)\n", lhs)
+		fmt.Fprintf(w, "return goj.Continue\n")
+	case kPointer:
+		elem := u.(*ast.StarExpr).X
+		fmt.Fprintf(w, "if t == goj.Null {\n%s = nil\nreturn goj.Continue\n}\n", lhs)
+		if ek, _ := g.classify(elem); ek == kStruct {
+			g.enqueue(g.underlying(elem).(*ast.Ident).Name)
+			fmt.Fprintf(w, "if t != goj.Object {\ns.TypeError(t, key, (*%s)(nil))\nreturn goj.Skip\n}\n", exprString(elem))
+			fmt.Fprintf(w, "if %s == nil {\n%s = new(%s)\n}\n", lhs, lhs, exprString(elem))
+			fmt.Fprintf(w, "s.Push(%s)\n", lhs)
+			fmt.Fprintf(w, "return goj.Continue\n")
+			return
+		}
+		fmt.Fprintf(w, "if %s == nil {\n%s = new(%s)\n}\n", lhs, lhs, exprString(elem))
+		g.genValue(w, elem, "*"+lhs, true)
+	case kSlice:
+		elem := u.(*ast.ArrayType).Elt
+		frame := g.sliceFrame(u.(*ast.ArrayType), elem)
+		fmt.Fprintf(w, "if t == goj.Null {\n%s = nil\nreturn goj.Continue\n}\n", lhs)
+		fmt.Fprintf(w, "if t != goj.Array {\ns.TypeError(t, key, &%s)\nreturn goj.Skip\n}\n", lhs)
+		fmt.Fprintf(w, "if %s == nil {\n%s = %s{}\n} else {\n%s = %s[:0]\n}\n", lhs, lhs, typ, lhs, lhs)
+		fmt.Fprintf(w, "s.Push((*%s)(&%s))\n", frame, lhs)
+		fmt.Fprintf(w, "return goj.Continue\n")
+	case kMap:
+		mt := u.(*ast.MapType)
+		frame := g.mapFrame(mt)
+		fmt.Fprintf(w, "if t == goj.Null {\n%s = nil\nreturn goj.Continue\n}\n", lhs)
+		fmt.Fprintf(w, "if t != goj.Object {\ns.TypeError(t, key, (*%s)(nil))\nreturn goj.Skip\n}\n", typ)
+		fmt.Fprintf(w, "if %s == nil {\n%s = make(%s)\n}\n", lhs, lhs, typ)
+		fmt.Fprintf(w, "s.Push(%s(%s))\n", frame, lhs)
+		fmt.Fprintf(w, "return goj.Continue\n")
+	default:
+		if !addressable {
+			panic("gojgen: fallback for non-addressable " + lhs)
+		}
+		fmt.Fprintf(w, "return s.Fallback(&%s, t, value)\n", lhs)
+	}
+	if k == kStruct {
+		g.enqueue(g.underlying(e).(*ast.Ident).Name)
+	}
+}
+
+func (g *generator) sliceFrame(t *ast.ArrayType, elem ast.Expr) string {
+	name := "goj" + typeName(t)
+	if g.done[name] {
+		return name
+	}
+	g.done[name] = true
+	var body bytes.Buffer
+	g.genValue(&body, elem, "(*x)[i]", true)
+
+	w := &g.frames
+	fmt.Fprintf(w, "// %s decodes the elements of a %s.\n", name, exprString(t))
+	fmt.Fprintf(w, "type %s %s\n\n", name, exprString(t))
+	fmt.Fprintf(w, "func (x *%s) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {\n", name)
+	fmt.Fprintf(w, "var e %s\ni := len(*x)\n*x = append(*x, e)\n", exprString(elem))
+	w.Write(body.Bytes())
+	fmt.Fprintf(w, "}\n\n")
+	return name
+}
+
+func (g *generator) mapFrame(t *ast.MapType) string {
+	name := "goj" + typeName(t)
+	if g.done[name] {
+		return name
+	}
+	g.done[name] = true
+	var body bytes.Buffer
+	g.genValue(&body, t.Value, "x["+exprString(t.Key)+"(key)]", false)
+
+	w := &g.frames
+	fmt.Fprintf(w, "// %s decodes the members of a %s.\n", name, exprString(t))
+	fmt.Fprintf(w, "type %s %s\n\n", name, exprString(t))
+	fmt.Fprintf(w, "func (x %s) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {\n", name)
+	w.Write(body.Bytes())
+	fmt.Fprintf(w, "}\n\n")
+	return name
+}
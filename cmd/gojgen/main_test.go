@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// the generated decoders used by the tests in ../../test must be up to date
+func TestGeneratedUpToDate(t *testing.T) {
+	const input = "../../test/gentypes_test.go"
+	const output = "../../test/gentypes_goj_test.go"
+	got, err := Generate(input, output, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("%s is stale, run go generate in ./test", output)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	if _, err := Generate("../../test/gentypes_test.go", "", []string{"NoSuchType"}); err == nil {
+		t.Errorf("expected error for unknown type")
+	}
+	if _, err := Generate("../../test/gentypes_test.go", "", []string{"genStatus"}); err == nil {
+		t.Errorf("expected error for non-struct type")
+	}
+}
@@ -0,0 +1,65 @@
+// gojinfer infers a schema from sample documents.
+//
+// It reads newline separated JSON, which may be compressed with gzip or
+// bzip2, from the named files, or from standard input, and writes a JSON
+// Schema which every document matches, or with -go the declaration of a Go
+// struct type they can be unmarshaled into.
+//
+// Usage:
+//
+//	gojinfer [-go TypeName] [file.json ...]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lloyd/goj"
+	"github.com/lloyd/goj/schema"
+)
+
+func main() {
+	goType := flag.String("go", "", "write a Go struct type with this name instead of a JSON Schema")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gojinfer [-go TypeName] [file.json ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	in := schema.NewInferrer()
+	read := func(r io.Reader) {
+		err := goj.ReadCompressedJSONNL(r, func(t goj.Type, k []byte, v []byte, line int64) bool {
+			in.Callback(t, k, v)
+			return true
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gojinfer: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if flag.NArg() == 0 {
+		read(os.Stdin)
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gojinfer: %s\n", err)
+			os.Exit(1)
+		}
+		read(f)
+		f.Close()
+	}
+
+	s := in.Shape()
+	var err error
+	out := s.JSONSchema()
+	if *goType != "" {
+		if out, err = s.GoStruct(*goType); err != nil {
+			fmt.Fprintf(os.Stderr, "gojinfer: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	os.Stdout.Write(out)
+}
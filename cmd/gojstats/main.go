@@ -0,0 +1,164 @@
+// gojstats reports where the bytes of JSON documents go.
+//
+// It reads newline separated JSON, which may be compressed with gzip or
+// bzip2, from the named files, or from standard input, and prints the
+// aggregate statistics gathered by goj/stats: the deepest nesting, the
+// number of entities of each type, the most frequent keys, the largest
+// strings, the share of strings with escapes and the bytes spent under each
+// path.  With -docs it also prints a line for each document.
+//
+// Usage:
+//
+//	gojstats [-docs] [-n 20] [-top 10] [-depth 0] [file.json ...]
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/lloyd/goj"
+	"github.com/lloyd/goj/stats"
+)
+
+func main() {
+	docs := flag.Bool("docs", false, "print the statistics of each document")
+	n := flag.Int("n", 20, "number of keys and paths to list")
+	top := flag.Int("top", 10, "number of largest strings to list")
+	depth := flag.Int("depth", 0, "limit paths to this many components (0: no limit)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gojstats [-docs] [-n 20] [-top 10] [-depth 0] [file.json ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	a := stats.NewAnalyzer()
+	a.Top = *top
+	a.MaxPathDepth = *depth
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	read := func(name string, r io.Reader) {
+		d, err := goj.Decompress(r)
+		if err != nil {
+			out.Flush()
+			fmt.Fprintf(os.Stderr, "gojstats: %s\n", err)
+			os.Exit(1)
+		}
+		defer d.Close()
+		br := bufio.NewReaderSize(d, 1<<20)
+		for line := 1; ; line++ {
+			buf, err := br.ReadBytes('\n')
+			if doc := bytes.TrimRight(buf, "\r\n"); len(bytes.TrimSpace(doc)) > 0 {
+				s, perr := a.Analyze(doc)
+				if perr != nil {
+					out.Flush()
+					fmt.Fprintf(os.Stderr, "gojstats: %s:%d: %s\n", name, line, perr)
+					os.Exit(1)
+				}
+				if *docs {
+					fmt.Fprintf(out, "%s:%d: %d bytes, depth %d, %d entities, %.1f%% escaped strings\n",
+						name, line, s.Bytes, s.MaxDepth, entities(s), 100*s.EscapedRatio())
+				}
+			}
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				out.Flush()
+				fmt.Fprintf(os.Stderr, "gojstats: %s\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+	if flag.NArg() == 0 {
+		read("stdin", os.Stdin)
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			out.Flush()
+			fmt.Fprintf(os.Stderr, "gojstats: %s\n", err)
+			os.Exit(1)
+		}
+		read(name, f)
+		f.Close()
+	}
+	report(out, a.Total(), *n)
+}
+
+func entities(s *stats.Stats) (n int64) {
+	for _, c := range s.Tokens {
+		n += c
+	}
+	return n
+}
+
+func report(out io.Writer, s *stats.Stats, n int) {
+	fmt.Fprintf(out, "%d documents, %d bytes, max depth %d\n", s.Documents, s.Bytes, s.MaxDepth)
+	fmt.Fprintf(out, "%d strings (keys included), %d escaped (%.1f%%)\n\n", s.Strings, s.Escaped, 100*s.EscapedRatio())
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "entities\ttype\t\n")
+	for t, c := range s.Tokens {
+		if c > 0 {
+			fmt.Fprintf(w, "%d\t%s\t\n", c, goj.Type(t))
+		}
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\n")
+	w = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "count\tkey\n")
+	for _, k := range largest(s.Keys, n) {
+		fmt.Fprintf(w, "%d\t%q\n", s.Keys[k], k)
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\n")
+	w = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "bytes\tshare\tpath\n")
+	for _, p := range largest(s.PathBytes, n) {
+		fmt.Fprintf(w, "%d\t%.1f%%\t%s\n", s.PathBytes[p], 100*float64(s.PathBytes[p])/float64(s.Bytes), pathName(p))
+	}
+	w.Flush()
+
+	if len(s.Largest) > 0 {
+		fmt.Fprintf(out, "\n")
+		w = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(w, "bytes\tdocument\toffset\tpath\tstart\n")
+		for _, str := range s.Largest {
+			fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%q\n", str.Length, str.Document+1, str.Offset, pathName(str.Path), str.Prefix)
+		}
+		w.Flush()
+	}
+}
+
+// largest returns the n keys of m with the largest counts, largest first.
+func largest(m map[string]int64, n int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+func pathName(p string) string {
+	if p == "" {
+		return "(root)"
+	}
+	return p
+}
@@ -0,0 +1,278 @@
+package goj
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// The magic numbers which begin compressed streams.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh") // and the block size, '1' to '9'
+)
+
+// Decompress returns a reader of the data in r, decompressed if it begins
+// as a gzip, zstd or bzip2 stream does, or as it is otherwise.  Decompression
+// runs ahead of the reader, in other goroutines, so that it goes on in
+// parallel with the parse.
+//
+// Gzip streams of several members, as written by concatenating files, are
+// read to their end.  Their members are decompressed one after the other,
+// unless each records its size in its header, as the BGZF files of bgzip
+// do: then up to GOMAXPROCS members are decompressed at once.  Bzip2
+// streams, which may also be concatenated, are decompressed one after the
+// other, by compress/bzip2.
+//
+// Reading zstd needs a build with the goj_zstd tag, which brings in
+// github.com/klauspost/compress/zstd, otherwise Decompress fails.
+//
+// Close stops the decompression, it does not close r.  Once Close returns r
+// is no longer read, and what of it was not read is left to the caller.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(r, 1<<16)
+	magic, err := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return newGzipReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		return newZstdReader(br)
+	case bytes.HasPrefix(magic, bzip2Magic) && len(magic) > 3 && '1' <= magic[3] && magic[3] <= '9':
+		return newBlockReader(readBlocks(bzip2.NewReader(br)), nil), nil
+	case err != nil && err != io.EOF:
+		return nil, err
+	}
+	return io.NopCloser(br), nil
+}
+
+// ReadCompressedJSONNL reads and parses newline separated JSON as
+// ReadJSONNL does, from r decompressed by Decompress.
+func ReadCompressedJSONNL(r io.Reader, cb func(t Type, key []byte, value []byte, line int64) bool) error {
+	d, err := Decompress(r)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return ReadJSONNL(d, cb)
+}
+
+// blockSize is how much of a stream is decompressed at a time, when its
+// parts can't be decompressed in parallel.
+const blockSize = 1 << 20
+
+// readBlocks returns the function which reads the next block of r, for a
+// blockReader which decompresses r ahead of its reader.
+func readBlocks(r io.Reader) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		buf := make([]byte, blockSize)
+		n := 0
+		var err error
+		for n < len(buf) && err == nil {
+			var m int
+			m, err = r.Read(buf[n:])
+			n += m
+		}
+		return buf[:n], err
+	}
+}
+
+func newGzipReader(br *bufio.Reader) (io.ReadCloser, error) {
+	if h, _ := br.Peek(bgzfHeaderSize); bgzfSize(h) > 0 {
+		return newBlockReader(func() ([]byte, error) { return nextMember(br) }, inflateMember), nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return newBlockReader(readBlocks(zr), nil), nil
+}
+
+// bgzfHeaderSize is the size of the header of a BGZF block: that of gzip
+// with the extra field, and a single subfield in it.
+const bgzfHeaderSize = 18
+
+// bgzfSize returns the size of the gzip member which h begins, if its
+// header records it in the "BC" extra subfield as BGZF does, or 0.
+func bgzfSize(h []byte) int {
+	if len(h) < 12 || h[0] != gzipMagic[0] || h[1] != gzipMagic[1] || h[3]&4 == 0 {
+		return 0
+	}
+	extra := h[12:]
+	if xlen := int(binary.LittleEndian.Uint16(h[10:])); xlen < len(extra) {
+		extra = extra[:xlen]
+	}
+	for len(extra) >= 4 {
+		slen := int(binary.LittleEndian.Uint16(extra[2:]))
+		if extra[0] == 'B' && extra[1] == 'C' && slen == 2 && len(extra) >= 6 {
+			return int(binary.LittleEndian.Uint16(extra[4:])) + 1
+		}
+		if len(extra) < 4+slen {
+			break
+		}
+		extra = extra[4+slen:]
+	}
+	return 0
+}
+
+// nextMember reads the next member of a BGZF stream, still compressed.
+func nextMember(br *bufio.Reader) ([]byte, error) {
+	h, err := br.Peek(12)
+	if len(h) == 0 && err == io.EOF {
+		return nil, io.EOF
+	}
+	if len(h) == 12 {
+		h, _ = br.Peek(12 + int(binary.LittleEndian.Uint16(h[10:])))
+	}
+	size := bgzfSize(h)
+	if size == 0 {
+		if len(h) < 12 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, errors.New("goj: a gzip member of a BGZF stream does not record its size")
+	}
+	member := make([]byte, size)
+	if _, err := io.ReadFull(br, member); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return member, nil
+}
+
+var gzipReaders sync.Pool
+
+// inflateMember decompresses a single gzip member, whose trailer gives the
+// size of its data.
+func inflateMember(member []byte) ([]byte, error) {
+	if len(member) < 8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	size := binary.LittleEndian.Uint32(member[len(member)-4:])
+	if size > 1<<16 {
+		// BGZF blocks hold no more than 64 KiB
+		return nil, errors.New("goj: a gzip member of a BGZF stream is too large")
+	}
+	data := make([]byte, size)
+	zr, _ := gzipReaders.Get().(*gzip.Reader)
+	var err error
+	if zr == nil {
+		zr, err = gzip.NewReader(bytes.NewReader(member))
+	} else {
+		err = zr.Reset(bytes.NewReader(member))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReaders.Put(zr)
+	zr.Multistream(false)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return nil, err
+	}
+	// the checksum is checked at the end of the data, which must be there
+	if n, err := zr.Read(make([]byte, 1)); n > 0 || err != io.EOF {
+		if err == nil || err == io.EOF {
+			err = gzip.ErrChecksum
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// A block is a part of the decompressed stream, or the error which ends it.
+type block struct {
+	data []byte
+	err  error
+}
+
+// blockReader reads a stream whose blocks are produced ahead of it: next
+// returns them in order from one goroutine, and decode, if not nil, turns
+// each into its data in a goroutine of its own.
+type blockReader struct {
+	queue chan chan block
+	done  chan struct{}
+	wg    sync.WaitGroup // the goroutines of next and decode
+	cur   []byte
+	err   error
+}
+
+func newBlockReader(next func() ([]byte, error), decode func([]byte) ([]byte, error)) *blockReader {
+	workers := 1
+	if decode != nil {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	r := &blockReader{
+		queue: make(chan chan block, 2*workers),
+		done:  make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(r.queue)
+		sem := make(chan struct{}, workers)
+		for {
+			select {
+			case <-r.done:
+				return
+			default:
+			}
+			b, err := next()
+			res := make(chan block, 1)
+			select {
+			case r.queue <- res:
+			case <-r.done:
+				return
+			}
+			if err != nil || decode == nil {
+				res <- block{b, err}
+				if err != nil {
+					return
+				}
+				continue
+			}
+			sem <- struct{}{}
+			r.wg.Add(1)
+			go func() {
+				defer r.wg.Done()
+				data, err := decode(b)
+				<-sem
+				res <- block{data, err}
+			}()
+		}
+	}()
+	return r
+}
+
+var errClosed = errors.New("goj: read after Close")
+
+func (r *blockReader) Read(p []byte) (int, error) {
+	for len(r.cur) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		res, ok := <-r.queue
+		if !ok {
+			r.err = io.EOF
+			continue
+		}
+		b := <-res
+		r.cur, r.err = b.data, b.err
+	}
+	n := copy(p, r.cur)
+	r.cur = r.cur[n:]
+	return n, nil
+}
+
+// Close stops the goroutines, and waits for them to finish.
+func (r *blockReader) Close() error {
+	if r.err != errClosed {
+		r.cur, r.err = nil, errClosed
+		close(r.done)
+		r.wg.Wait()
+	}
+	return nil
+}
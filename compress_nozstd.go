@@ -0,0 +1,13 @@
+//go:build !goj_zstd
+// +build !goj_zstd
+
+package goj
+
+import (
+	"errors"
+	"io"
+)
+
+func newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	return nil, errors.New("goj: reading zstd needs a build with the goj_zstd tag")
+}
@@ -0,0 +1,20 @@
+//go:build goj_zstd
+// +build goj_zstd
+
+package goj
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// newZstdReader decompresses r with klauspost/compress, whose decoder
+// already decodes blocks ahead of the reader.
+func newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
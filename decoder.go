@@ -0,0 +1,360 @@
+package goj
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// A Decoder reads and decodes JSON values from an input stream.  It offers
+// the pull style API of encoding/json.Decoder, Token, More, InputOffset and
+// Decode, so that it can replace one without changes to the calling code.
+// Tokens are the types encoding/json uses: json.Delim for brackets and
+// braces, string, float64 (or json.Number, see UseNumber), bool and nil.
+//
+// goj only parses complete documents, so a Decoder buffers each top-level
+// value in full.  The first call to Token inside a value parses all of it in
+// one pass, and the following calls hand out the tokens recorded then.
+type Decoder struct {
+	r         io.Reader
+	buf       []byte
+	scanp     int   // current position in buf
+	base      int64 // offset of buf[0] in the input stream
+	rerr      error // error returned by r, seen once buf is drained
+	err       error // sticky syntax error
+	parser    *Parser
+	cb        Callback
+	docStart  int // position in buf of the value being tokenized
+	toks      []token
+	strs      []string // strings containing escapes, referenced by tokens
+	tokp      int      // next token to return
+	pos       int      // progress of scanValue, 0 when no scan is in progress
+	depth     int
+	useNumber bool
+}
+
+// token is a token recorded while parsing a top-level value.  Offsets are
+// positions in the decoder's buffer.  Strings are read from the buffer
+// unless they contain escapes, then s is one more than their index in strs.
+type token struct {
+	start int
+	end   int
+	s     int
+	t     Type
+	key   bool
+}
+
+const minRead = 512
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	d := &Decoder{r: r, parser: NewParser()}
+	d.cb = d.event
+	return d
+}
+
+// UseNumber causes the Decoder to return numbers as json.Number instead of
+// float64, both from Token and when decoding into an interface{}.
+func (d *Decoder) UseNumber() {
+	d.useNumber = true
+}
+
+// Buffered returns a reader of the data remaining in the Decoder's buffer.
+func (d *Decoder) Buffered() io.Reader {
+	return bytes.NewReader(d.buf[d.scanp:])
+}
+
+// InputOffset returns the input stream byte offset of the current decoder
+// position: the end of the most recently returned token and the beginning
+// of the next one.
+func (d *Decoder) InputOffset() int64 {
+	return d.base + int64(d.scanp)
+}
+
+// More reports whether there is another element in the current array or
+// object being parsed, or, between top-level values, more input.
+func (d *Decoder) More() bool {
+	if d.tokp < len(d.toks) {
+		t := d.toks[d.tokp].t
+		return t != ArrayEnd && t != ObjectEnd
+	}
+	_, err := d.peek()
+	return err == nil
+}
+
+// Token returns the next JSON token in the input stream.  Object keys are
+// returned as strings.  At the end of the input stream, Token returns nil,
+// io.EOF.
+func (d *Decoder) Token() (json.Token, error) {
+	if d.tokp == len(d.toks) {
+		if err := d.tokenize(); err != nil {
+			return nil, err
+		}
+	}
+	tk := &d.toks[d.tokp]
+	d.tokp++
+	d.scanp = tk.end
+	switch tk.t {
+	case String:
+		if tk.s > 0 {
+			return d.strs[tk.s-1], nil
+		}
+		return string(d.buf[tk.start+1 : tk.end-1]), nil
+	case Integer, NegInteger, Float:
+		v := d.buf[tk.start:tk.end]
+		if d.useNumber {
+			return json.Number(v), nil
+		}
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return nil, &UnmarshalTypeError{Value: "number " + string(v), Type: float64Type}
+		}
+		return f, nil
+	case True:
+		return true, nil
+	case False:
+		return false, nil
+	case Array:
+		return json.Delim('['), nil
+	case ArrayEnd:
+		return json.Delim(']'), nil
+	case Object:
+		return json.Delim('{'), nil
+	case ObjectEnd:
+		return json.Delim('}'), nil
+	}
+	return nil, nil
+}
+
+// Decode reads the next JSON value from the input and stores it in the value
+// pointed to by v, as Unmarshal does.  Between calls to Token, Decode reads
+// the next array element or object member value.
+func (d *Decoder) Decode(v interface{}) error {
+	if d.err != nil {
+		return d.err
+	}
+	var start, end int
+	if d.tokp < len(d.toks) {
+		tk := d.toks[d.tokp]
+		if tk.key || tk.t == ArrayEnd || tk.t == ObjectEnd {
+			return &Error{e: "not at beginning of value", buf: d.buf, offset: d.scanp}
+		}
+		n := d.tokp + 1
+		if tk.t == Object || tk.t == Array {
+			for depth := 1; depth > 0; n++ {
+				switch d.toks[n].t {
+				case Object, Array:
+					depth++
+				case ObjectEnd, ArrayEnd:
+					depth--
+				}
+			}
+		}
+		start, end = tk.start, d.toks[n-1].end
+		d.tokp = n
+	} else {
+		var err error
+		if start, end, err = d.nextValue(); err != nil {
+			return err
+		}
+	}
+	d.scanp = end
+	err := unmarshal(d.buf[start:end], v, d.useNumber)
+	if _, ok := err.(*Error); ok {
+		d.err = err
+	}
+	return err
+}
+
+// tokenize parses the next top-level value, recording its tokens.
+func (d *Decoder) tokenize() error {
+	start, end, err := d.nextValue()
+	if err != nil {
+		return err
+	}
+	d.toks = d.toks[:0]
+	d.strs = d.strs[:0]
+	d.tokp = 0
+	d.docStart = start
+	if n := (end - start) / 8; cap(d.toks) < n {
+		// a guess at the number of tokens, to save growing toks repeatedly
+		d.toks = make([]token, 0, n)
+	}
+	if err := d.parser.Parse(d.buf[start:end], d.cb); err != nil {
+		d.toks = d.toks[:0]
+		d.err = err
+		return err
+	}
+	return nil
+}
+
+func (d *Decoder) event(t Type, k []byte, v []byte) Action {
+	p := d.parser
+	if k != nil {
+		d.toks = append(d.toks, d.stringToken(p.keyStart, p.keyEnd, k))
+		d.toks[len(d.toks)-1].key = true
+	}
+	if t == String {
+		d.toks = append(d.toks, d.stringToken(p.start, p.i, v))
+	} else {
+		d.toks = append(d.toks, token{t: t, start: d.docStart + p.start, end: d.docStart + p.i})
+	}
+	return Continue
+}
+
+// stringToken records the string s, found between start and end in the
+// value being tokenized.  Escapes always shorten a string, so it can be read
+// back from the buffer if its length matches.
+func (d *Decoder) stringToken(start, end int, s []byte) token {
+	tk := token{t: String, start: d.docStart + start, end: d.docStart + end}
+	if len(s) != end-start-2 {
+		d.strs = append(d.strs, string(s))
+		tk.s = len(d.strs)
+	}
+	return tk
+}
+
+// nextValue buffers the next top-level value in full and returns its
+// position in d.buf.
+func (d *Decoder) nextValue() (int, int, error) {
+	if d.err != nil {
+		return 0, 0, d.err
+	}
+	if _, err := d.peek(); err != nil {
+		return 0, 0, err
+	}
+	for {
+		if end := d.scanValue(d.scanp, d.rerr != nil); end >= 0 {
+			return d.scanp, end, nil
+		}
+		if d.rerr != nil {
+			d.err = d.rerr
+			if d.err == io.EOF {
+				d.err = io.ErrUnexpectedEOF
+			}
+			return 0, 0, d.err
+		}
+		d.refill()
+	}
+}
+
+// peek skips whitespace and returns the next byte, reading more input as
+// needed.
+func (d *Decoder) peek() (byte, error) {
+	for {
+		for i := d.scanp; i < len(d.buf); i++ {
+			switch d.buf[i] {
+			case ' ', '\t', '\n', '\r':
+				continue
+			}
+			d.scanp = i
+			return d.buf[i], nil
+		}
+		d.scanp = len(d.buf)
+		if d.rerr != nil {
+			return 0, d.rerr
+		}
+		d.refill()
+	}
+}
+
+// refill discards the consumed part of the buffer and reads more input.
+func (d *Decoder) refill() {
+	if d.scanp > 0 {
+		d.base += int64(d.scanp)
+		n := copy(d.buf, d.buf[d.scanp:])
+		d.buf = d.buf[:n]
+		if d.pos > 0 {
+			d.pos -= d.scanp
+		}
+		d.scanp = 0
+	}
+	if cap(d.buf)-len(d.buf) < minRead {
+		nb := make([]byte, len(d.buf), 2*cap(d.buf)+minRead)
+		copy(nb, d.buf)
+		d.buf = nb
+	}
+	n, err := d.r.Read(d.buf[len(d.buf):cap(d.buf)])
+	d.buf = d.buf[:len(d.buf)+n]
+	if err != nil {
+		d.rerr = err
+	}
+}
+
+// scanValue returns the end of the value which begins at d.buf[start], or
+// -1 if more input is needed to find it.  The scan of an object or array
+// resumes where the previous call left off.  Malformed values are left for
+// the parser to report.
+func (d *Decoder) scanValue(start int, eof bool) int {
+	buf := d.buf
+	switch c := buf[start]; c {
+	case '{', '[':
+		scan, open, close := scanBraces, byte('{'), byte('}')
+		if c == '[' {
+			scan, open, close = scanBrackets, '[', ']'
+		}
+		if d.pos == 0 {
+			d.pos, d.depth = start+1, 1
+		}
+		for d.pos < len(buf) {
+			i := d.pos + scan(buf, d.pos)
+			if i >= len(buf) {
+				d.pos = len(buf)
+				break
+			}
+			switch buf[i] {
+			case open:
+				d.depth++
+			case close:
+				d.depth--
+				if d.depth == 0 {
+					d.pos = 0
+					return i + 1
+				}
+			case '"':
+				// strings are rescanned in full if they are incomplete
+				if i = stringEnd(buf, i+1); i < 0 {
+					return -1
+				}
+				d.pos = i
+				continue
+			}
+			d.pos = i + 1
+		}
+		return -1
+	case '"':
+		return stringEnd(buf, start+1)
+	}
+	// numbers and literals run up to the next delimiter
+	for i := start; i < len(buf); i++ {
+		switch buf[i] {
+		case ' ', '\t', '\n', '\r', ',', ':', '"', '[', ']', '{', '}':
+			return i
+		}
+	}
+	if eof {
+		return len(buf)
+	}
+	return -1
+}
+
+// stringEnd returns the position just past the closing quote of the string
+// whose contents begin at buf[i], or -1 if the string is incomplete.
+func stringEnd(buf []byte, i int) int {
+	for i < len(buf) {
+		i += scanNonSpecialStringCharsGo(buf, i)
+		if i >= len(buf) {
+			break
+		}
+		switch buf[i] {
+		case '"':
+			return i + 1
+		case '\\':
+			i += 2
+		default:
+			i++
+		}
+	}
+	return -1
+}
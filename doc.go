@@ -0,0 +1,456 @@
+package goj
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Doc is a JSON value in a buffer, decoded only as far as it is read:
+//
+//	doc := goj.NewDoc(buf)
+//	id, err := doc.Object().Get("user").Get("id").Int64()
+//
+// Looking up a member scans its object from the start up to the member,
+// stepping over the values of the members before it with the same scanners
+// Parse uses to skip, and remembers where each member it passed is, so that
+// later lookups in the same object don't scan it again.  Nothing is copied
+// but the strings with escapes which are read.
+//
+// Errors, whether the document is malformed, a value has the wrong type or
+// is not found, are carried along the chain of calls and returned by the
+// accessor at its end, or by Err.  Only what is scanned is checked: values
+// which are stepped over need only have balanced braces or brackets and
+// valid strings, and the text after the value of the document is ignored.
+//
+// Docs are values which refer to the buffer and to the state which all the
+// Docs of the document share.  The buffer must not be modified while they
+// are in use, and they are not safe for concurrent use.  The zero Doc is
+// not valid.
+type Doc struct {
+	d   *lazyDoc
+	off int            // of the first byte of the value
+	c   *lazyContainer // of an object or array, once known
+	err error
+}
+
+// ErrNotFound is the error of a Doc which Get or Index didn't find.
+var ErrNotFound = errors.New("goj: value not found")
+
+// lazyDoc is the state shared by the Docs of a document.
+type lazyDoc struct {
+	p          *Parser
+	containers map[int]*lazyContainer // by the offset of their brace or bracket
+}
+
+// lazyContainer is what is known of an object or array: the members or
+// elements scanned so far, and where to go on from.
+type lazyContainer struct {
+	keys  [][]byte // unescaped, for objects
+	vals  []int    // the offsets of the values
+	index map[string]int
+	next  int  // just past the last value scanned, unless it is pending
+	pend  bool // the last value is not stepped over until the scan goes on
+	done  bool
+	end   int // just past the closing brace or bracket, once done
+	err   error
+}
+
+// NewDoc returns the Doc of the JSON value in buf.
+func NewDoc(buf []byte) Doc {
+	p := NewParser()
+	p.reset(buf)
+	p.skipSpace()
+	d := &lazyDoc{p: p, containers: make(map[int]*lazyContainer)}
+	if p.end() {
+		return Doc{d: d, err: &Error{e: "no JSON value found", buf: buf}}
+	}
+	return Doc{d: d, off: p.i}
+}
+
+// Err returns the error of the Doc, if it is not a value.
+func (d Doc) Err() error {
+	return d.err
+}
+
+// Type returns the type of the value: String, Integer, NegInteger, Float,
+// True, False, Null, Array or Object.
+func (d Doc) Type() (Type, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	p := d.d.p
+	switch p.buf[d.off] {
+	case '{':
+		return Object, nil
+	case '[':
+		return Array, nil
+	case '"':
+		return String, nil
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		p.i = d.off
+		_, t, err := p.readNumber()
+		return t, err
+	}
+	return d.d.literal(d.off)
+}
+
+// Raw returns the text of the value, quotes included for strings and
+// everything up to the closing brace or bracket for objects and arrays.  It
+// is part of the buffer.
+func (d Doc) Raw() ([]byte, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	end, err := d.d.skip(d.off)
+	if err != nil {
+		return nil, err
+	}
+	return d.d.p.buf[d.off:end], nil
+}
+
+// Value returns what a Callback would have been passed as the value: the
+// unescaped text of a string, the text of a number, and nil otherwise.  Only
+// strings with escapes are copied.
+func (d Doc) Value() ([]byte, error) {
+	t, err := d.Type()
+	if err != nil {
+		return nil, err
+	}
+	p := d.d.p
+	p.i = d.off
+	switch t {
+	case String:
+		v, cooked, err := p.readString()
+		if cooked {
+			v = append([]byte(nil), v...)
+		}
+		return v, err
+	case Integer, NegInteger, Float:
+		v, _, err := p.readNumber()
+		return v, err
+	}
+	return nil, nil
+}
+
+// String returns the unescaped text of a string.
+func (d Doc) String() (string, error) {
+	if err := d.expect(String); err != nil {
+		return "", err
+	}
+	v, err := d.Value()
+	return string(v), err
+}
+
+// Int64 returns the value of an integer which fits in an int64.
+func (d Doc) Int64() (int64, error) {
+	if err := d.expect(Integer, NegInteger); err != nil {
+		return 0, err
+	}
+	v, err := d.Value()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(v), 10, 64)
+}
+
+// Uint64 returns the value of an integer which fits in a uint64.
+func (d Doc) Uint64() (uint64, error) {
+	if err := d.expect(Integer); err != nil {
+		return 0, err
+	}
+	v, err := d.Value()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(v), 10, 64)
+}
+
+// Float64 returns the value of a number as a float64.
+func (d Doc) Float64() (float64, error) {
+	if err := d.expect(Integer, NegInteger, Float); err != nil {
+		return 0, err
+	}
+	v, err := d.Value()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(v), 64)
+}
+
+// Bool returns the value of true or false.
+func (d Doc) Bool() (bool, error) {
+	if err := d.expect(True, False); err != nil {
+		return false, err
+	}
+	t, _ := d.Type()
+	return t == True, nil
+}
+
+// Object returns the value, which must be an object.  Member lookups on the
+// Doc it returns go straight to the object's cache, see Get.
+func (d Doc) Object() Doc {
+	return d.container(Object)
+}
+
+// Array returns the value, which must be an array, as Object does.
+func (d Doc) Array() Doc {
+	return d.container(Array)
+}
+
+func (d Doc) container(t Type) Doc {
+	open := byte('{')
+	if t == Array {
+		open = '['
+	}
+	if d.c != nil && d.d.p.buf[d.off] == open {
+		return d
+	}
+	if err := d.expect(t); err != nil {
+		return Doc{d: d.d, err: err}
+	}
+	d.c = d.d.container(d.off)
+	return d
+}
+
+// expect returns an error unless the value has one of the types.
+func (d Doc) expect(types ...Type) error {
+	t, err := d.Type()
+	if err != nil {
+		return err
+	}
+	for _, want := range types {
+		if t == want {
+			return nil
+		}
+	}
+	return &Error{e: "expected " + types[0].String() + ", found " + t.String(), buf: d.d.p.buf, offset: d.off}
+}
+
+// Get returns the value of the member of an object with the given key, the
+// first one should there be several.  The object is scanned no further than
+// the member.
+func (d Doc) Get(key string) Doc {
+	o := d.Object()
+	if o.err != nil {
+		return o
+	}
+	c := o.c
+	if c.index == nil && len(c.keys) > maxKeyScan {
+		c.index = make(map[string]int, len(c.keys))
+		for i, k := range c.keys {
+			if _, ok := c.index[string(k)]; !ok {
+				c.index[string(k)] = i
+			}
+		}
+	}
+	if c.index != nil {
+		if i, ok := c.index[key]; ok {
+			return Doc{d: o.d, off: c.vals[i]}
+		}
+	} else {
+		for i, k := range c.keys {
+			if string(k) == key {
+				return Doc{d: o.d, off: c.vals[i]}
+			}
+		}
+	}
+	for o.d.more(o.off, c) {
+		if string(c.keys[len(c.keys)-1]) == key {
+			return Doc{d: o.d, off: c.vals[len(c.vals)-1]}
+		}
+	}
+	return o.d.miss(c)
+}
+
+// Index returns the element of an array at index i.  The array is scanned
+// no further than the element.
+func (d Doc) Index(i int) Doc {
+	a := d.Array()
+	if a.err != nil {
+		return a
+	}
+	c := a.c
+	for i >= len(c.vals) && a.d.more(a.off, c) {
+	}
+	if i < 0 || i >= len(c.vals) {
+		return a.d.miss(c)
+	}
+	return Doc{d: a.d, off: c.vals[i]}
+}
+
+// Len returns the number of members of an object, or elements of an
+// array, scanning all of it.
+func (d Doc) Len() (int, error) {
+	if err := d.expect(Object, Array); err != nil {
+		return 0, err
+	}
+	if d.c == nil {
+		d.c = d.d.container(d.off)
+	}
+	for d.d.more(d.off, d.c) {
+	}
+	return len(d.c.vals), d.c.err
+}
+
+// miss returns the Doc of a member or element which is not in c.
+func (d *lazyDoc) miss(c *lazyContainer) Doc {
+	if c.err != nil {
+		return Doc{d: d, err: c.err}
+	}
+	return Doc{d: d, err: ErrNotFound}
+}
+
+func (d *lazyDoc) container(off int) *lazyContainer {
+	c := d.containers[off]
+	if c == nil {
+		c = &lazyContainer{next: off + 1}
+		d.containers[off] = c
+	}
+	return c
+}
+
+// literal checks the true, false or null at off.
+func (d *lazyDoc) literal(off int) (Type, error) {
+	p := d.p
+	buf := p.buf[off:]
+	p.i = off
+	switch {
+	case len(buf) >= len("true") && string(buf[:len("true")]) == "true":
+		return True, nil
+	case len(buf) >= len("false") && string(buf[:len("false")]) == "false":
+		return False, nil
+	case len(buf) >= len("null") && string(buf[:len("null")]) == "null":
+		return Null, nil
+	case buf[0] == 't' || buf[0] == 'f' || buf[0] == 'n':
+		return 0, p.pError("invalid string in json text.")
+	}
+	return 0, p.pError("unallowed token at this point in JSON text")
+}
+
+// skip returns the offset just past the value at off.
+func (d *lazyDoc) skip(off int) (int, error) {
+	p := d.p
+	p.i = off
+	switch p.buf[off] {
+	case '{', '[':
+		c := d.containers[off]
+		switch {
+		case c == nil:
+			p.i = off + 1
+		case c.done:
+			return c.end, nil
+		default:
+			// the members stepped over so far need not be scanned again.
+			// Errors which reading it found are no concern when stepping
+			// over it, as for any other value.
+			p.i = c.next
+		}
+		var err error
+		if p.buf[off] == '{' {
+			_, err = p.skipSection(scanBraces, '{', '}')
+		} else {
+			_, err = p.skipSection(scanBrackets, '[', ']')
+		}
+		return p.i, err
+	case '"':
+		err := p.skipString()
+		return p.i, err
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		_, _, err := p.readNumber()
+		return p.i, err
+	}
+	t, err := d.literal(off)
+	if err != nil {
+		return 0, err
+	}
+	switch t {
+	case False:
+		return off + len("false"), nil
+	default:
+		return off + len("true"), nil
+	}
+}
+
+// more scans the next member or element of the object or array at off into
+// c, and reports whether there was one.
+func (d *lazyDoc) more(off int, c *lazyContainer) bool {
+	if c.done || c.err != nil {
+		return false
+	}
+	if c.pend {
+		end, err := d.skip(c.vals[len(c.vals)-1])
+		if err != nil {
+			c.err = err
+			return false
+		}
+		c.next, c.pend = end, false
+	}
+	p := d.p
+	buf := p.buf
+	object := buf[off] == '{'
+	close := byte(']')
+	if object {
+		close = '}'
+	}
+	p.i = c.next
+	p.skipSpace()
+	if p.end() {
+		c.err = p.pError("premature EOF")
+		return false
+	}
+	if buf[p.i] == close {
+		p.i++
+		c.done, c.end = true, p.i
+		return false
+	}
+	if len(c.vals) > 0 {
+		if buf[p.i] != ',' {
+			if object {
+				c.err = p.pError("after key and value, inside map, I expect ',' or '}'")
+			} else {
+				c.err = p.pError("2 unexpected character")
+			}
+			return false
+		}
+		p.i++
+		p.skipSpace()
+		if p.end() {
+			c.err = p.pError("premature EOF")
+			return false
+		}
+	}
+	var k []byte
+	if object {
+		var cooked bool
+		var err error
+		if k, cooked, err = p.readString(); err != nil {
+			c.err = err
+			return false
+		}
+		if cooked {
+			k = append([]byte(nil), k...)
+		}
+		p.skipSpace()
+		if p.end() || buf[p.i] != ':' {
+			c.err = p.pError("expected ':' to separate key and value")
+			return false
+		}
+		p.i++
+		p.skipSpace()
+	}
+	if p.end() {
+		c.err = p.pError("unexpected end of buffer")
+		return false
+	}
+	if object {
+		c.keys = append(c.keys, k)
+		if c.index != nil {
+			if _, ok := c.index[string(k)]; !ok {
+				c.index[string(k)] = len(c.vals)
+			}
+		}
+	}
+	c.vals = append(c.vals, p.i)
+	c.pend = true
+	return true
+}
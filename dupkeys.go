@@ -0,0 +1,231 @@
+package goj
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+)
+
+// DuplicateKeys is a policy for objects in which a key appears more than
+// once.  JSON leaves their meaning open, and parsers which disagree about
+// it have been the cause of security bugs.
+type DuplicateKeys uint8
+
+const (
+	// AllowDuplicates reports every member, duplicate or not.  This is the
+	// default.
+	AllowDuplicates DuplicateKeys = iota
+	// ErrorOnDuplicates fails the parse with a *DuplicateKeyError.
+	ErrorOnDuplicates
+	// KeepFirst reports only the first member with a given key, as if the
+	// later ones were not there.
+	KeepFirst
+	// KeepLast reports only the last member with a given key, as
+	// encoding/json would leave it.  This looks ahead through each object
+	// which is not within another as it is opened, so it costs an extra
+	// pass over the input.
+	KeepLast
+)
+
+// DuplicateKeyError is returned when a parser which is set to
+// ErrorOnDuplicates finds a key repeated within an object.
+type DuplicateKeyError struct {
+	Key    string // the key, decoded
+	Offset int    // the offset of the repeated key in the input
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return "goj: duplicate key " + strconv.Quote(e.Key) + " at offset " + strconv.Itoa(e.Offset)
+}
+
+// SetDuplicateKeys sets the policy for keys which repeat within an object.
+// Keys are compared after escapes are decoded.  The policy takes effect from
+// the next document parsed.
+func (p *Parser) SetDuplicateKeys(policy DuplicateKeys) {
+	p.dupPolicy = policy
+}
+
+// SetDuplicateKeys sets the policy of the underlying Parser, see
+// Parser.SetDuplicateKeys, and starts over on the document.
+func (it *Iterator) SetDuplicateKeys(policy DuplicateKeys) {
+	it.p.SetDuplicateKeys(policy)
+	it.Reset(it.p.buf)
+}
+
+// keySet holds the keys seen so far in an open object.
+type keySet struct {
+	keys    [][]byte            // while there are few
+	m       map[string]struct{} // once there are many
+	members []keyAt             // for KeepLast, every key in order
+	dup     bool                // for KeepLast, whether any key repeats
+}
+
+// keyAt is a key and its offset in the input.
+type keyAt struct {
+	k  []byte
+	at int
+}
+
+// with more keys than this, a map beats comparing against them all
+const maxKeyScan = 16
+
+func (s *keySet) add(k []byte) (dup bool) {
+	if s.m != nil {
+		if _, dup = s.m[string(k)]; !dup {
+			s.m[string(k)] = struct{}{}
+		}
+		return dup
+	}
+	for _, o := range s.keys {
+		if bytes.Equal(o, k) {
+			return true
+		}
+	}
+	s.keys = append(s.keys, k)
+	if len(s.keys) > maxKeyScan {
+		s.m = make(map[string]struct{}, 2*len(s.keys))
+		for _, o := range s.keys {
+			s.m[string(o)] = struct{}{}
+		}
+	}
+	return false
+}
+
+// lastOnly appends to drop the offsets of the keys of all but the last
+// member with each key, once the set holds all the members of its object.
+func (s *keySet) lastOnly(drop []int) []int {
+	if !s.dup {
+		return drop
+	}
+	s.keys = s.keys[:0]
+	s.m = nil
+	for i := len(s.members) - 1; i >= 0; i-- {
+		if s.add(s.members[i].k) {
+			drop = append(drop, s.members[i].at)
+		}
+	}
+	return drop
+}
+
+// pushKeySet starts an empty set for an object just opened.
+func (p *Parser) pushKeySet() *keySet {
+	n := len(p.keySets)
+	if n < cap(p.keySets) {
+		p.keySets = p.keySets[:n+1]
+	} else {
+		p.keySets = append(p.keySets, keySet{})
+	}
+	s := &p.keySets[n]
+	s.keys = s.keys[:0]
+	s.m = nil
+	s.members = s.members[:0]
+	s.dup = false
+	return s
+}
+
+// openObject starts tracking the keys of an object whose '{' was just
+// consumed.
+func (p *Parser) openObject() {
+	p.pushKeySet()
+	if p.dups == KeepLast && p.i > p.aheadEnd {
+		p.lookAhead()
+	}
+}
+
+func (p *Parser) closeObject() {
+	p.keySets = p.keySets[:len(p.keySets)-1]
+}
+
+// checkKey applies the policy to the key of a member whose key starts at
+// p.keyStart.  A member to be dropped is parsed as usual, but its entities
+// are not reported.
+func (p *Parser) checkKey(k []byte) error {
+	if p.dups == KeepLast {
+		// keys the parse skipped over are passed by
+		for p.nextDrop < len(p.dropKeys) && p.dropKeys[p.nextDrop] < p.keyStart {
+			p.nextDrop++
+		}
+		if p.nextDrop < len(p.dropKeys) && p.dropKeys[p.nextDrop] == p.keyStart {
+			p.nextDrop++
+			p.drop()
+		}
+		return nil
+	}
+	if !p.keySets[len(p.keySets)-1].add(k) {
+		return nil
+	}
+	if p.dups == ErrorOnDuplicates {
+		return &DuplicateKeyError{Key: string(k), Offset: p.keyStart}
+	}
+	p.drop()
+	return nil
+}
+
+// drop starts dropping the member whose key was just read, unless it is
+// already inside a member being dropped.
+func (p *Parser) drop() {
+	if p.dropDepth == 0 {
+		p.dropDepth = len(p.states)
+	}
+}
+
+// dropped reports whether the entity next just returned belongs to a
+// duplicate member which is dropped.
+func (p *Parser) dropped() bool {
+	if p.dropDepth == 0 {
+		return false
+	}
+	// the member is over once the parse is back at the depth of its object
+	if len(p.states) <= p.dropDepth {
+		p.dropDepth = 0
+	}
+	return true
+}
+
+// lookAhead scans the object whose '{' was just consumed, and the objects
+// within it, and records in dropKeys the offsets of the keys of all but the
+// last member with each key, in each of them.  The objects within are not
+// looked through again as the parse opens them, so that it stays linear
+// however deep they nest.  Should the object be invalid, lookAhead stops,
+// and leaves the parse to report the error once it gets there; the objects
+// left open keep the last of the members before it.
+func (p *Parser) lookAhead() {
+	if p.ahead == nil {
+		p.ahead = NewParser()
+	}
+	a := p.ahead
+	a.reset(p.buf)
+	a.i = p.i
+	a.pushState(sObject)
+	a.pushKeySet()
+
+	drop := p.dropKeys[:0]
+	for len(a.keySets) > 0 {
+		t, k, _, err := a.next()
+		if err != nil {
+			break
+		}
+		if k != nil {
+			s := &a.keySets[len(a.keySets)-1]
+			s.members = append(s.members, keyAt{k, a.keyStart})
+			if s.add(k) {
+				s.dup = true
+			}
+		}
+		switch t {
+		case Object:
+			a.pushKeySet()
+		case ObjectEnd:
+			drop = a.keySets[len(a.keySets)-1].lastOnly(drop)
+			a.closeObject()
+		}
+	}
+	for len(a.keySets) > 0 {
+		drop = a.keySets[len(a.keySets)-1].lastOnly(drop)
+		a.closeObject()
+	}
+	sort.Ints(drop)
+	p.dropKeys = drop
+	p.nextDrop = 0
+	p.aheadEnd = a.i
+}
@@ -1,3 +1,6 @@
+//go:build go1.23
+// +build go1.23
+
 // a simple json scanner which reads newline separated json and plucks out and
 // prints values under the '.name' property
 
@@ -11,28 +14,21 @@ import (
 )
 
 func main() {
-	var lastLine int64
-	lastLine = 0
-	depth := 0
-	err := goj.ReadJSONNL(os.Stdin, func(t goj.Type, key []byte, value []byte, line int64) bool {
-		if line > lastLine {
-			fmt.Printf("\n") // no name key in the last object
-			lastLine = line
+	for rec, err := range goj.Lines(os.Stdin) {
+		if err != nil {
+			fmt.Printf("Read error: %s\n", err)
+			return
 		}
-		switch t {
-		case goj.String:
-			if depth == 1 && string(key) == "name" {
-				fmt.Printf("%s\n", string(value))
-				lastLine++
+		name := ""
+		for ev, err := range rec.Events() {
+			if err != nil {
+				fmt.Printf("Parse error: %s\n", err)
+				return
+			}
+			if ev.Type == goj.String && ev.Depth == 1 && string(ev.Key) == "name" {
+				name = string(ev.Value)
 			}
-		case goj.Array, goj.Object:
-			depth++
-		case goj.ArrayEnd, goj.ObjectEnd:
-			depth--
 		}
-		return true
-	})
-	if err != nil {
-		fmt.Printf("Parse error: %s\n", err)
+		fmt.Println(name) // empty when there is no name key in the object
 	}
 }
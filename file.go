@@ -0,0 +1,87 @@
+package goj
+
+import "bytes"
+
+// ParseFile parses the JSON document in the file at path, see
+// Parser.ParseFile.
+func ParseFile(path string, cb Callback) error {
+	return NewParser().ParseFile(path, cb)
+}
+
+// ParseFile parses the JSON document in the file at path, as Parse does.
+// On Linux the file is mapped into memory rather than read, so that it is
+// never copied onto the heap, and is paged in as the parse goes.
+//
+// The keys and values passed to the callback may point into the mapping,
+// which is unmapped when ParseFile returns: they are only valid during the
+// callback, and must be copied to be kept.  The file must not be truncated
+// while it is parsed.
+func (p *Parser) ParseFile(path string, cb Callback) (err error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = detach(err)
+		if uerr := unmap(); err == nil {
+			err = uerr
+		}
+	}()
+	return p.Parse(data, cb)
+}
+
+// ReadJSONNLFile reads and parses the newline separated JSON in the file at
+// path, as ReadJSONNL does, but without copying it: on Linux it is mapped
+// into memory, as by ParseFile, and each line parsed where it lies.  As
+// with ParseFile, the keys and values passed to the callback are only valid
+// during the callback.
+func ReadJSONNLFile(path string, cb func(t Type, key []byte, value []byte, line int64) bool) (err error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = detach(err)
+		if uerr := unmap(); err == nil {
+			err = uerr
+		}
+	}()
+	parser := NewParser()
+	for lineNumber := int64(0); len(data) > 0; lineNumber++ {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i+1], data[i+1:]
+		} else {
+			data = nil
+		}
+		err := parser.Parse(line, func(t Type, k []byte, v []byte) Action {
+			if cb(t, k, v, lineNumber) {
+				return Continue
+			}
+			return Cancel
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detach copies what a parse error shows of the document, so that it
+// outlives the mapping of a file.
+func detach(err error) error {
+	e, ok := err.(*Error)
+	if !ok || e.buf == nil {
+		return err
+	}
+	d := &Error{e: e.e}
+	if e.offset < len(e.buf) {
+		// Verbose shows no more than 20 bytes, and whether there are more
+		end := e.offset + 21
+		if end > len(e.buf) {
+			end = len(e.buf)
+		}
+		d.buf = append([]byte(nil), e.buf[e.offset:end]...)
+	}
+	return d
+}
@@ -0,0 +1,345 @@
+package goj
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+)
+
+// FormatOptions control the output of Format.
+type FormatOptions struct {
+	// Prefix begins every line of output but the first, and Indent is
+	// repeated once for each level of nesting, as for encoding/json.Indent.
+	// The output is compact when both are empty.
+	Prefix string
+	Indent string
+
+	// SortKeys writes the members of objects in order of their keys.
+	SortKeys bool
+
+	// EscapeHTML escapes <, > and & in strings.
+	EscapeHTML bool
+
+	// EscapeNonASCII escapes all characters outside of ASCII in strings.
+	EscapeNonASCII bool
+
+	// Width, if positive, keeps objects and arrays on a single line when
+	// they fit within that many columns.  It only matters when indenting.
+	Width int
+}
+
+// Compact appends to dst the JSON document in src with insignificant space
+// characters elided, like encoding/json.Compact.
+func Compact(dst *bytes.Buffer, src []byte) error {
+	return Format(dst, src, FormatOptions{})
+}
+
+// Indent appends to dst an indented form of the JSON document in src, like
+// encoding/json.Indent.
+func Indent(dst *bytes.Buffer, src []byte, prefix, indent string) error {
+	return Format(dst, src, FormatOptions{Prefix: prefix, Indent: indent})
+}
+
+// Format appends to dst the JSON document in src, laid out as opts describe.
+// The text of numbers is kept exactly, as is that of strings unless they
+// must be escaped differently.  As with encoding/json.Indent, trailing space
+// characters in src are copied when indenting.  If src is not valid, dst is
+// left unchanged.
+func Format(dst *bytes.Buffer, src []byte, opts FormatOptions) error {
+	f := newFormatter(&opts)
+	f.w.SetIndent(opts.Prefix, opts.Indent)
+	if f.w.indented {
+		f.width = opts.Width
+	}
+	it := NewIterator(src)
+	t, _, v, err := it.Next()
+	if err == io.EOF {
+		return errors.New("goj: unexpected end of JSON input")
+	} else if err != nil {
+		return err
+	}
+	if opts.SortKeys || f.width > 0 {
+		ents, err := collect(it, t, v)
+		if err != nil {
+			return err
+		}
+		if f.width > 0 {
+			f.measure(ents)
+		}
+		f.write(ents, 0)
+	} else if err := f.value(it, t, v); err != nil {
+		return err
+	}
+	if _, _, _, err := it.Next(); err != io.EOF {
+		return err
+	}
+	dst.Write(f.w.Bytes())
+	if f.w.indented {
+		n := len(src)
+		for n > 0 && (src[n-1] == ' ' || src[n-1] == '\t' || src[n-1] == '\n' || src[n-1] == '\r') {
+			n--
+		}
+		dst.Write(src[n:])
+	}
+	return nil
+}
+
+// formatter writes documents read from an Iterator.  Formatting with
+// sorted keys or a width first collects the document, so that the members
+// of objects can be reordered, and containers measured, without reading
+// them again.
+type formatter struct {
+	w       *Writer
+	opts    *FormatOptions
+	raw     bool // strings are copied as they appear in the input
+	width   int
+	widths  []int      // the length of each collected entity on a single line
+	order   []int      // the contents of the containers being written
+	scratch []byte     // for measuring escaped strings
+	inline  *formatter // writes containers on a single line, for fits
+}
+
+func newFormatter(opts *FormatOptions) *formatter {
+	w := NewWriter(nil)
+	w.SetEscapeHTML(opts.EscapeHTML)
+	w.SetEscapeNonASCII(opts.EscapeNonASCII)
+	return &formatter{w: w, opts: opts, raw: !opts.EscapeHTML && !opts.EscapeNonASCII}
+}
+
+// value writes the entity last returned by it.Next, and for an object or
+// array all of its contents, as they are read.
+func (f *formatter) value(it *Iterator, t Type, v []byte) error {
+	if t == Object || t == Array {
+		return f.container(it, t)
+	}
+	f.scalar(t, v, it.p.buf[it.p.start:it.p.i])
+	return nil
+}
+
+func (f *formatter) container(it *Iterator, t Type) error {
+	if t == Object {
+		f.w.BeginObject()
+	} else {
+		f.w.BeginArray()
+	}
+	for {
+		t, k, v, err := it.Next()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case ObjectEnd:
+			f.w.EndObject()
+			return nil
+		case ArrayEnd:
+			f.w.EndArray()
+			return nil
+		}
+		if k != nil {
+			f.key(k, it.p.buf[it.p.keyStart:it.p.keyEnd])
+		}
+		if err := f.value(it, t, v); err != nil {
+			return err
+		}
+	}
+}
+
+// key writes the key k of a member, whose text in the input is text.
+func (f *formatter) key(k, text []byte) {
+	if f.raw {
+		f.w.writeKey(text, true)
+	} else {
+		f.w.KeyBytes(k)
+	}
+}
+
+// scalar writes a value which is not an object or array, whose text in the
+// input is text.
+func (f *formatter) scalar(t Type, v, text []byte) {
+	switch t {
+	case String:
+		if f.raw {
+			f.w.Raw(text)
+		} else {
+			f.w.StringBytes(v)
+		}
+	case True:
+		f.w.Bool(true)
+	case False:
+		f.w.Bool(false)
+	case Null:
+		f.w.Null()
+	default:
+		f.w.Number(v)
+	}
+}
+
+// An entity is a value read by collect, with its key if it is the member
+// of an object.
+type entity struct {
+	t       Type
+	key     []byte // the key, unescaped
+	keyText []byte // the key as written in the input
+	v       []byte // the value of a string or number
+	text    []byte // the string or number as written in the input
+	next    int    // the index of the entity after this one and its contents
+}
+
+// collect reads the entity last returned by it.Next, and for an object or
+// array all of its contents, into a list in document order.  Each entity
+// is read once, and the contents of objects can then be visited in any
+// order, see contents.  Strings the parser unescaped are copied out of its
+// buffer, which it reuses.
+func collect(it *Iterator, t Type, v []byte) ([]entity, error) {
+	var ents []entity
+	var open []int // the containers not yet closed
+	var k []byte
+	for {
+		switch t {
+		case ObjectEnd, ArrayEnd:
+			ents[open[len(open)-1]].next = len(ents)
+			open = open[:len(open)-1]
+		case Object, Array:
+			open = append(open, len(ents))
+			fallthrough
+		default:
+			e := entity{t: t, key: k, v: v, next: len(ents) + 1}
+			if k != nil {
+				e.keyText = it.p.buf[it.p.keyStart:it.p.keyEnd]
+			}
+			if t != Object && t != Array {
+				e.text = it.p.buf[it.p.start:it.p.i]
+			}
+			if t == String && len(v) != len(e.text)-2 {
+				e.v = append([]byte(nil), v...)
+			}
+			ents = append(ents, e)
+		}
+		if len(open) == 0 {
+			return ents, nil
+		}
+		var err error
+		if t, k, v, err = it.Next(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// contents appends to dst the indices of the members of the object, or the
+// elements of the array, ents[i].
+func contents(dst []int, ents []entity, i int) []int {
+	for j := i + 1; j < ents[i].next; j = ents[j].next {
+		dst = append(dst, j)
+	}
+	return dst
+}
+
+// write writes the collected entity ents[i], and all of its contents.
+func (f *formatter) write(ents []entity, i int) {
+	e := &ents[i]
+	if e.t != Object && e.t != Array {
+		f.scalar(e.t, e.v, e.text)
+		return
+	}
+	if f.width > 0 && f.fits(ents, i) {
+		return
+	}
+	start := len(f.order)
+	f.order = contents(f.order, ents, i)
+	end := len(f.order)
+	if e.t == Object && f.opts.SortKeys {
+		members := f.order[start:end]
+		sort.SliceStable(members, func(a, b int) bool {
+			return bytes.Compare(ents[members[a]].key, ents[members[b]].key) < 0
+		})
+	}
+	if e.t == Object {
+		f.w.BeginObject()
+	} else {
+		f.w.BeginArray()
+	}
+	for n := start; n < end; n++ {
+		j := f.order[n]
+		if e.t == Object {
+			f.key(ents[j].key, ents[j].keyText)
+		}
+		f.write(ents, j)
+	}
+	f.order = f.order[:start]
+	if e.t == Object {
+		f.w.EndObject()
+	} else {
+		f.w.EndArray()
+	}
+}
+
+// measure records in f.widths the length of each of ents written on a
+// single line, as fits writes them.  Containers are measured after their
+// contents, by adding up their lengths.
+func (f *formatter) measure(ents []entity) {
+	if cap(f.widths) < len(ents) {
+		f.widths = make([]int, len(ents))
+	}
+	widths := f.widths[:len(ents)]
+	for i := len(ents) - 1; i >= 0; i-- {
+		e := &ents[i]
+		switch e.t {
+		case Object, Array:
+			n := len("{}")
+			for j := i + 1; j < e.next; j = ents[j].next {
+				if j > i+1 {
+					n += len(", ")
+				}
+				if e.t == Object {
+					n += f.quotedLen(ents[j].key, ents[j].keyText) + len(": ")
+				}
+				n += widths[j]
+			}
+			widths[i] = n
+		case String:
+			widths[i] = f.quotedLen(e.v, e.text)
+		case True, Null:
+			widths[i] = len("true")
+		case False:
+			widths[i] = len("false")
+		default:
+			widths[i] = len(e.v)
+		}
+	}
+	f.widths = widths
+}
+
+// quotedLen returns the length of the string s, written in the input as
+// text, once the formatter writes it.
+func (f *formatter) quotedLen(s, text []byte) int {
+	if f.raw {
+		return len(text)
+	}
+	f.scratch = appendEscaped(f.scratch[:0], s, f.opts.EscapeHTML, f.opts.EscapeNonASCII)
+	return len(f.scratch)
+}
+
+// fits writes the object or array ents[i] on the current line if it fits
+// within the width, and reports whether it did.
+func (f *formatter) fits(ents []entity, i int) bool {
+	// the column the text would start at
+	col := 0
+	if f.w.key {
+		col = len(f.w.buf) - (bytes.LastIndexByte(f.w.buf, '\n') + 1)
+	} else if len(f.w.stack) > 0 {
+		col = len(f.w.prefix) + len(f.w.stack)*len(f.w.indent)
+	}
+	if f.widths[i] > f.width-col {
+		return false
+	}
+	if f.inline == nil {
+		f.inline = newFormatter(f.opts)
+		f.inline.w.spaced = true
+	}
+	in := f.inline
+	in.w.Reset(nil)
+	in.write(ents, i)
+	f.w.Raw(in.w.buf)
+	return true
+}
@@ -0,0 +1,268 @@
+package goj
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// Frame receives the members of a single JSON object or array.  It is the
+// building block of the decoders written by cmd/gojgen, which implements it
+// for every generated struct type, and for the slices and maps they contain.
+//
+// GojMember is invoked once for each value directly inside the container;
+// key is nil inside arrays.  To decode an object or array member, a Frame
+// pushes another Frame with Frames.Push, which then receives that
+// container's members until it is closed.  Returning Skip for a member that
+// is an object or array skips it entirely.
+type Frame interface {
+	GojMember(s *Frames, t Type, key []byte, value []byte) Action
+}
+
+// Frames is the state of a decode driven by Frame implementations.  Its
+// helper methods convert scalars and record the first type error, so that,
+// as with Unmarshal, decoding continues past values of the wrong type.
+type Frames struct {
+	parser  *Parser
+	literal *Parser
+	cb      Callback
+	stack   []Frame
+	root    Frame
+	pending interface{}
+	scratch []byte
+	err     error
+}
+
+var framesPool = sync.Pool{
+	New: func() interface{} {
+		s := &Frames{
+			parser: NewParser(),
+			stack:  make([]Frame, 0, 8),
+		}
+		s.cb = s.event
+		return s
+	},
+}
+
+// DecodeObject decodes the JSON object in buf, handing its members to root.
+func DecodeObject(buf []byte, root Frame) error {
+	s := framesPool.Get().(*Frames)
+	s.root = root
+	s.err = nil
+	err := s.parser.Parse(buf, s.cb)
+	for i := range s.stack {
+		s.stack[i] = nil
+	}
+	s.stack = s.stack[:0]
+	s.root = nil
+	s.pending = nil
+	if err == ClientCancelledParse && s.err != nil {
+		err = s.err
+	} else if err == nil {
+		err = s.err
+	}
+	framesPool.Put(s)
+	return err
+}
+
+func (s *Frames) event(t Type, k []byte, v []byte) Action {
+	switch t {
+	case ArrayEnd, ObjectEnd:
+		s.stack[len(s.stack)-1] = nil
+		s.stack = s.stack[:len(s.stack)-1]
+		return Continue
+	case SkippedData:
+		if s.pending != nil {
+			if err := Unmarshal(v, s.pending); err != nil {
+				s.saveError(err)
+			}
+			s.pending = nil
+		}
+		return Continue
+	}
+	if len(s.stack) == 0 {
+		if t != Object || s.root == nil {
+			s.saveError(&UnmarshalTypeError{Value: t.String(), Type: reflect.TypeOf(s.root)})
+			return Cancel
+		}
+		s.Push(s.root)
+		s.root = nil
+		return Continue
+	}
+	return s.stack[len(s.stack)-1].GojMember(s, t, k, v)
+}
+
+// Push makes f the receiver of members until the current container ends.
+func (s *Frames) Push(f Frame) {
+	s.stack = append(s.stack, f)
+}
+
+func (s *Frames) saveError(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// TypeError records that a value of type t found under key could not be
+// stored in the value ptr points to.
+func (s *Frames) TypeError(t Type, key []byte, ptr interface{}) {
+	if s.err == nil {
+		s.err = &UnmarshalTypeError{Value: t.String(), Type: reflect.TypeOf(ptr).Elem(), Key: string(key)}
+	}
+}
+
+func (s *Frames) scalarError(t Type, key []byte, v []byte, typ reflect.Type) {
+	if s.err == nil {
+		what := t.String()
+		if t == Integer || t == NegInteger || t == Float {
+			what += " " + string(v)
+		}
+		s.err = &UnmarshalTypeError{Value: what, Type: typ, Key: string(key)}
+	}
+}
+
+var (
+	stringType  = reflect.TypeOf("")
+	boolType    = reflect.TypeOf(false)
+	int64Type   = reflect.TypeOf(int64(0))
+	uint64Type  = reflect.TypeOf(uint64(0))
+	float64Type = reflect.TypeOf(float64(0))
+)
+
+// String returns the value of a string member.  It returns false for null,
+// and for other types after recording a type error.
+func (s *Frames) String(t Type, key []byte, v []byte) (string, bool) {
+	if t == String {
+		return string(v), true
+	}
+	if t != Null {
+		s.scalarError(t, key, v, stringType)
+	}
+	return "", false
+}
+
+// Bool returns the value of a boolean member.  It returns false for null,
+// and for other types after recording a type error.
+func (s *Frames) Bool(t Type, key []byte, v []byte) (bool, bool) {
+	switch t {
+	case True:
+		return true, true
+	case False:
+		return false, true
+	case Null:
+	default:
+		s.scalarError(t, key, v, boolType)
+	}
+	return false, false
+}
+
+// Int returns the value of an integer member which must fit in the given
+// number of bits.  It returns false for null, and for other types or out of
+// range values after recording a type error.
+func (s *Frames) Int(t Type, key []byte, v []byte, bits int) (int64, bool) {
+	if t == Integer || t == NegInteger {
+		if n, err := strconv.ParseInt(string(v), 10, bits); err == nil {
+			return n, true
+		}
+	}
+	if t != Null {
+		s.scalarError(t, key, v, int64Type)
+	}
+	return 0, false
+}
+
+// Uint returns the value of a non-negative integer member which must fit in
+// the given number of bits.  It returns false for null, and for other types
+// or out of range values after recording a type error.
+func (s *Frames) Uint(t Type, key []byte, v []byte, bits int) (uint64, bool) {
+	if t == Integer {
+		if n, err := strconv.ParseUint(string(v), 10, bits); err == nil {
+			return n, true
+		}
+	}
+	if t != Null {
+		s.scalarError(t, key, v, uint64Type)
+	}
+	return 0, false
+}
+
+// Float returns the value of a number member as a float of the given number
+// of bits.  It returns false for null, and for other types or out of range
+// values after recording a type error.
+func (s *Frames) Float(t Type, key []byte, v []byte, bits int) (float64, bool) {
+	if t == Integer || t == NegInteger || t == Float {
+		if n, err := strconv.ParseFloat(string(v), bits); err == nil {
+			return n, true
+		}
+	}
+	if t != Null {
+		s.scalarError(t, key, v, float64Type)
+	}
+	return 0, false
+}
+
+// Literal unwraps a member of a field tagged `json:",string"`, returning the
+// type and value of the JSON scalar inside the string.  If the member is not
+// such a string an error is recorded and Null is returned.
+func (s *Frames) Literal(t Type, key []byte, v []byte) (Type, []byte) {
+	if t == Null {
+		return Null, nil
+	}
+	if t == String {
+		if s.literal == nil {
+			s.literal = NewParser()
+		}
+		var lt Type
+		var lv []byte
+		n := 0
+		err := s.literal.Parse(v, func(t Type, _ []byte, v []byte) Action {
+			lt, lv = t, v
+			n++
+			return Continue
+		})
+		if err == nil && n == 1 {
+			return lt, lv
+		}
+	}
+	s.scalarError(t, key, v, stringType)
+	return Null, nil
+}
+
+// Fallback decodes the current member into the value ptr points to with
+// Unmarshal.  It is used for types which gojgen has no specialized code for.
+// The returned action must be passed back to the parser.
+func (s *Frames) Fallback(ptr interface{}, t Type, v []byte) Action {
+	switch t {
+	case Object, Array:
+		// Unmarshal the raw bytes once the parser has skipped over them
+		s.pending = ptr
+		return Skip
+	case String:
+		s.scratch = appendQuoted(s.scratch[:0], v)
+	case True:
+		s.scratch = append(s.scratch[:0], "true"...)
+	case False:
+		s.scratch = append(s.scratch[:0], "false"...)
+	case Null:
+		s.scratch = append(s.scratch[:0], "null"...)
+	default:
+		s.scratch = append(s.scratch[:0], v...)
+	}
+	if err := Unmarshal(s.scratch, ptr); err != nil {
+		s.saveError(err)
+	}
+	return Continue
+}
+
+// Fold returns the member of fields which equals key under Unicode case
+// folding, so that keys may be matched case-insensitively like
+// encoding/json does.
+func (s *Frames) Fold(key []byte, fields [][]byte) ([]byte, bool) {
+	for _, f := range fields {
+		if bytes.EqualFold(f, key) {
+			return f, true
+		}
+	}
+	return nil, false
+}
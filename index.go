@@ -0,0 +1,476 @@
+package goj
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Engine selects how a Parser finds the entities of a document.  Every
+// engine reports the same entities, keys, values, offsets and errors.
+type Engine uint8
+
+const (
+	// StateMachine scans the document a byte at a time, skipping spaces and
+	// scanning strings and numbers as it goes.  It is the default, and the
+	// reference the other engines are tested against.
+	StateMachine Engine = iota
+	// Indexed parses in two stages, as simdjson does.  The first finds the
+	// quotes, backslashes, structural characters and spaces of the whole
+	// document, 64 bytes at a time with vector instructions where the CPU
+	// has them, works out which bytes are inside strings and builds an
+	// index of where each token starts.  The second walks the index, which
+	// spares it from looking at spaces and at the contents of strings
+	// without escapes.  It pays off on documents with much space or long
+	// strings, such as indented ones, which it parses about twice as fast;
+	// on compact documents of short tokens, building the index costs more
+	// than it saves.  The index takes four bytes for each token.
+	Indexed
+)
+
+func (e Engine) String() string {
+	switch e {
+	case StateMachine:
+		return "state machine"
+	case Indexed:
+		return "indexed"
+	}
+	return "<unknown>"
+}
+
+// SetEngine selects the engine which parses documents.  It takes effect
+// from the next document parsed.
+func (p *Parser) SetEngine(e Engine) {
+	p.engine = e
+}
+
+// SetEngine selects the engine of the underlying Parser, see
+// Parser.SetEngine, and starts over on the document.
+func (it *Iterator) SetEngine(e Engine) {
+	it.p.SetEngine(e)
+	it.Reset(it.p.buf)
+}
+
+// blockMasks describe 64 bytes of a document, one bit for each byte.
+type blockMasks struct {
+	quote      uint64 // '"'
+	backslash  uint64 // '\\'
+	structural uint64 // '{', '}', '[', ']', ':' and ','
+	space      uint64 // ' ', '\t', '\n' and '\r'
+	control    uint64 // below 0x20
+}
+
+// Character classes, as bits of charClass.
+const (
+	classQuote = 1 << iota
+	classBackslash
+	classStructural
+	classSpace
+	classControl
+)
+
+var charClass = func() (c [256]uint8) {
+	c['"'] = classQuote
+	c['\\'] = classBackslash
+	for _, s := range []byte("{}[]:,") {
+		c[s] = classStructural
+	}
+	for i := 0; i < 0x20; i++ {
+		c[i] = classControl
+	}
+	for _, s := range []byte(" \t\n\r") {
+		c[s] |= classSpace
+	}
+	return c
+}()
+
+func classifyGo(s []byte, m []blockMasks) {
+	for b := range m {
+		var q, bs, st, sp, ct uint64
+		for i, c := range s[64*b : 64*b+64] {
+			cl := uint64(charClass[c])
+			q |= (cl & 1) << i
+			bs |= (cl >> 1 & 1) << i
+			st |= (cl >> 2 & 1) << i
+			sp |= (cl >> 3 & 1) << i
+			ct |= (cl >> 4 & 1) << i
+		}
+		m[b] = blockMasks{q, bs, st, sp, ct}
+	}
+}
+
+// escapedBytes returns the bytes of a block which follow an odd number of
+// backslashes, given its backslashes.  carry is 1 if the previous block
+// ended with such a sequence, and is updated for the next block.  This is
+// the carry propagation of simdjson: adding the first backslash of each
+// sequence to the sequence carries just past its end, and whether a
+// sequence starts at an even or odd position and ends at an even or odd one
+// tells its length apart.
+func escapedBytes(backslash uint64, carry *uint64) uint64 {
+	const even = 0x5555555555555555
+	const odd = ^uint64(even)
+	starts := backslash &^ (backslash << 1)
+	evenStartMask := even ^ *carry
+	evenStarts := starts & evenStartMask
+	oddStarts := starts &^ evenStartMask
+	evenCarries := backslash + evenStarts
+	oddCarries, overflow := bits.Add64(backslash, oddStarts, 0)
+	oddCarries |= *carry
+	*carry = overflow
+	evenCarryEnds := evenCarries &^ backslash
+	oddCarryEnds := oddCarries &^ backslash
+	return evenCarryEnds&odd | oddCarryEnds&even
+}
+
+// prefixXOR returns the bits which follow an odd number of set bits in x,
+// counting themselves.
+func prefixXOR(x uint64) uint64 {
+	x ^= x << 1
+	x ^= x << 2
+	x ^= x << 4
+	x ^= x << 8
+	x ^= x << 16
+	x ^= x << 32
+	return x
+}
+
+// classifyBatch is the number of blocks classified at a time.
+const classifyBatch = 64
+
+// indexer holds the index of a document, for the Indexed engine.
+type indexer struct {
+	// index holds the offsets of the tokens: the structural characters
+	// outside strings, both quotes of every string, and the first byte of
+	// everything else outside strings which does not follow a byte of the
+	// same kind, that is numbers, literals and garbage.
+	index []uint32
+	// special has a bit for each byte inside a string which is a backslash
+	// or a control character, so strings without one need no scanning.
+	special []uint64
+	// next is the position in index of the next token to parse.
+	next int
+	// stray is set if there are backslashes outside strings.  The document
+	// is not valid JSON then, and the quotes they escape may be the ones
+	// which delimit strings, so skipped sections are left to skipSection.
+	stray bool
+	masks [classifyBatch]blockMasks
+	tail  [64]byte
+}
+
+// build is the first stage of the Indexed engine, which indexes buf.
+func (x *indexer) build(buf []byte) {
+	index := x.index[:0]
+	special := x.special[:0]
+	var escapeCarry, insideCarry, scalarCarry, stray uint64
+	for at := 0; at < len(buf); {
+		n := (len(buf) - at) / 64
+		s := buf[at:]
+		if n == 0 {
+			// the last bytes are padded with spaces, which index nothing
+			c := copy(x.tail[:], s)
+			for i := c; i < len(x.tail); i++ {
+				x.tail[i] = ' '
+			}
+			s, n = x.tail[:], 1
+		} else if n > classifyBatch {
+			n = classifyBatch
+		}
+		masks := x.masks[:n]
+		classifyBlocks(s, masks)
+		for i := range masks {
+			m := &masks[i]
+			quotes := m.quote
+			if m.backslash|escapeCarry != 0 {
+				quotes &^= escapedBytes(m.backslash, &escapeCarry)
+			}
+			// inside strings, opening quotes included
+			inside := prefixXOR(quotes) ^ insideCarry
+			insideCarry = uint64(int64(inside) >> 63)
+			special = append(special, (m.backslash|m.control)&inside)
+			stray |= m.backslash &^ inside
+			scalar := ^(m.structural | m.space | quotes | inside)
+			starts := scalar &^ (scalar<<1 | scalarCarry)
+			scalarCarry = scalar >> 63
+			b := m.structural&^inside | quotes | starts
+			k := len(index)
+			if c := bits.OnesCount64(b); k+c <= cap(index) {
+				index = index[:k+c]
+			} else {
+				index = append(index, make([]uint32, c)...)
+			}
+			for j := range index[k:] {
+				index[k+j] = uint32(at + bits.TrailingZeros64(b))
+				b &= b - 1
+			}
+			at += 64
+		}
+	}
+	x.index, x.special, x.next, x.stray = index, special, 0, stray != 0
+}
+
+// plain reports whether buf[from:to], inside a string, holds no backslashes
+// or control characters.
+func (x *indexer) plain(from, to int) bool {
+	if from >= to {
+		return true
+	}
+	if from>>6 == (to-1)>>6 {
+		// most strings are within a word
+		return x.special[from>>6]>>uint(from&63)&(1<<uint(to-from)-1) == 0
+	}
+	for from < to {
+		w := x.special[from>>6] >> uint(from&63)
+		if n := to - from; n < 64-from&63 {
+			w &= 1<<uint(n) - 1
+		}
+		if w != 0 {
+			return false
+		}
+		from = (from | 63) + 1
+	}
+	return true
+}
+
+// maxIndexed is the size of the largest document which may be indexed, as
+// offsets are held in 32 bits.  Larger ones are parsed by the state machine.
+const maxIndexed = math.MaxUint32
+
+// useIndex indexes buf if the Indexed engine is selected, and reports
+// whether it did.
+func (p *Parser) useIndex(buf []byte) bool {
+	if p.engine != Indexed || uint64(len(buf)) > maxIndexed {
+		return false
+	}
+	if p.ix == nil {
+		p.ix = new(indexer)
+	}
+	p.ix.build(buf)
+	return true
+}
+
+// sync moves the position in the index past the tokens the state machine
+// consumed.
+func (x *indexer) sync(i int) {
+	for x.next < len(x.index) && int(x.index[x.next]) < i {
+		x.next++
+	}
+}
+
+// handOff has the state machine take the next step from p.i, and keeps the
+// index in step with it.  The Indexed engine leaves it the entities whose
+// parse the index does not speed up, and everything which is not valid
+// JSON, so that the errors are the same.
+func (p *Parser) handOff() (Type, []byte, []byte, error) {
+	t, k, v, err := p.scanNext()
+	p.ix.sync(p.i)
+	return t, k, v, err
+}
+
+// isSpace reports whether c is a JSON space.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// nextIndexed is the second stage of the Indexed engine, the equivalent of
+// next.  Between entities it is in the same state next would be in, so
+// they can take turns.
+func (p *Parser) nextIndexed() (Type, []byte, []byte, error) {
+	buf, x := p.buf, p.ix
+	for x.next < len(x.index) {
+		at := int(x.index[x.next])
+		// anything but spaces before the token is garbage after a number
+		// or literal
+		if p.i != at && !isSpace(buf[p.i]) {
+			return p.handOff()
+		}
+		c := buf[at]
+		switch p.s {
+		case sValueEnd:
+			if len(p.states) == 0 {
+				break
+			}
+			top := p.states[len(p.states)-1]
+			if c == '}' && top == sObject || c == ']' && top == sArray {
+				return p.closeIndexed(at)
+			}
+			if c != ',' {
+				break
+			}
+			p.i = at + 1
+			x.next++
+			if top == sObject {
+				p.s = sKey
+			} else {
+				p.s = sValue
+			}
+			continue
+		case sValue:
+			p.start = at
+			switch c {
+			case '"':
+				v, _, err := p.readIndexedString()
+				if err != nil {
+					return 0, nil, nil, err
+				}
+				p.s = sValueEnd
+				return String, p.key(), v, nil
+			case '{', '[':
+				p.i = at + 1
+				x.next++
+				k := p.key()
+				if c == '[' {
+					p.pushState(sArray)
+					return Array, k, nil, nil
+				}
+				p.pushState(sObject)
+				if p.dups != AllowDuplicates {
+					p.openObject()
+				}
+				return Object, k, nil, nil
+			case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+				p.i = at
+				x.next++
+				v, t, err := p.readNumber()
+				if err != nil {
+					return 0, nil, nil, err
+				}
+				if p.bigNumbers && !fitsLosslessly(t, v) {
+					t |= Big
+				}
+				p.s = sValueEnd
+				return t, p.key(), v, nil
+			}
+		case sArray:
+			if c == ']' {
+				return p.closeIndexed(at)
+			}
+			p.s = sValue
+			continue
+		case sObject, sKey:
+			if c == '}' && p.s == sObject {
+				return p.closeIndexed(at)
+			}
+			if c != '"' {
+				break
+			}
+			p.keyStart = at
+			k, cooked, err := p.readIndexedString()
+			if err != nil {
+				return 0, nil, nil, err
+			}
+			p.keyEnd = p.i
+			if x.next == len(x.index) || buf[x.index[x.next]] != ':' {
+				p.skipSpace()
+				return 0, nil, nil, p.pError("expected ':' to separate key and value")
+			}
+			p.i = int(x.index[x.next]) + 1
+			x.next++
+			if cooked {
+				// as in next, the key must not share the cooked buffer
+				// with the value
+				k = append([]byte(nil), k...)
+			}
+			if p.dups != AllowDuplicates {
+				if err := p.checkKey(k); err != nil {
+					return 0, nil, nil, err
+				}
+			}
+			p.keystack = append(p.keystack, k)
+			p.s = sValue
+			continue
+		}
+		// literals, and what is not valid JSON
+		p.i = at
+		return p.handOff()
+	}
+	// only spaces, or garbage after a number or literal, are left
+	return p.handOff()
+}
+
+// closeIndexed reports the end of the innermost object or array, whose
+// closing brace or bracket is the next token.
+func (p *Parser) closeIndexed(at int) (Type, []byte, []byte, error) {
+	p.start = at
+	p.i = at + 1
+	p.ix.next++
+	t := ArrayEnd
+	if p.states[len(p.states)-1] == sObject {
+		t = ObjectEnd
+		if p.dups != AllowDuplicates {
+			p.closeObject()
+		}
+	}
+	p.popState()
+	p.s = sValueEnd
+	return t, nil, nil, nil
+}
+
+// readIndexedString reads the string whose opening quote is the next token
+// in the index.  Strings with escapes, control characters or no closing
+// quote are left to readString.
+func (p *Parser) readIndexedString() ([]byte, bool, error) {
+	x := p.ix
+	open := int(x.index[x.next])
+	if x.next+1 < len(x.index) {
+		if end := int(x.index[x.next+1]); x.plain(open+1, end) {
+			x.next += 2
+			p.i = end + 1
+			return p.buf[open+1 : end], false, nil
+		}
+	}
+	p.i = open
+	v, cooked, err := p.readString()
+	x.sync(p.i)
+	return v, cooked, err
+}
+
+// skipIndexed is skipSection for the Indexed engine: it finds the end of the
+// object or array whose opening brace or bracket was just consumed in the
+// index, checking the strings inside as skipString would.
+func (p *Parser) skipIndexed(open, close byte) ([]byte, error) {
+	buf, x := p.buf, p.ix
+	if x.stray {
+		scan := scanBraces
+		if open == '[' {
+			scan = scanBrackets
+		}
+		v, err := p.skipSection(scan, open, close)
+		x.sync(p.i)
+		if err == nil && (x.next == 0 || int(x.index[x.next-1]) != p.i-1) {
+			// the index has the section end inside a string, its quotes
+			// are not those of the state machine, which parses the rest
+			p.indexed = false
+		}
+		return v, err
+	}
+	start := p.i - 1
+	in := 1
+	for x.next < len(x.index) {
+		at := int(x.index[x.next])
+		switch buf[at] {
+		case open:
+			in++
+		case close:
+			in--
+		case '"':
+			if x.next+1 < len(x.index) && x.plain(at+1, int(x.index[x.next+1])) {
+				x.next++
+				break
+			}
+			p.i = at
+			if err := p.skipString(); err != nil {
+				return nil, err
+			}
+			x.sync(p.i)
+			continue
+		}
+		x.next++
+		if in == 0 {
+			p.i = at + 1
+			p.start = start
+			p.s = sValueEnd
+			return buf[start:p.i], nil
+		}
+	}
+	p.i = len(buf)
+	return nil, p.pError("premature EOF")
+}
@@ -0,0 +1,77 @@
+package goj
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// naiveIndex indexes buf a byte at a time, as indexer.build should.
+func naiveIndex(buf []byte) (index []uint32, special []int, stray bool) {
+	index = []uint32{}
+	escaped, inside, scalar := false, false, false
+	for i, c := range buf {
+		quote := c == '"' && !escaped
+		escaped = c == '\\' && !escaped
+		switch {
+		case quote:
+			index = append(index, uint32(i))
+			inside = !inside
+			scalar = false
+		case inside:
+			if c == '\\' || c < 0x20 {
+				special = append(special, i)
+			}
+		case c == '{' || c == '}' || c == '[' || c == ']' || c == ':' || c == ',':
+			index = append(index, uint32(i))
+			scalar = false
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			scalar = false
+		default:
+			if !scalar {
+				index = append(index, uint32(i))
+			}
+			scalar = true
+			stray = stray || c == '\\'
+		}
+	}
+	return index, special, stray
+}
+
+func TestIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var x indexer
+	for i := 0; i < 2000; i++ {
+		buf := make([]byte, r.Intn(300))
+		// mostly backslashes and quotes, so that runs of them cross blocks
+		for j := range buf {
+			buf[j] = "\\\\\\\"\"{}[]:, \t\n1a\x01"[r.Intn(17)]
+		}
+		x.build(buf)
+		index, special, stray := naiveIndex(buf)
+		if !assert.Equal(t, index, x.index, "%q", buf) {
+			return
+		}
+		var got []int
+		for j := range buf {
+			if !x.plain(j, j+1) {
+				got = append(got, j)
+			}
+		}
+		assert.Equal(t, special, got, "%q", buf)
+		assert.Equal(t, stray, x.stray, "%q", buf)
+	}
+}
+
+func TestPlain(t *testing.T) {
+	var x indexer
+	x.special = []uint64{1 << 63, 1, 0, 1 << 5}
+	assert.True(t, x.plain(0, 63))
+	assert.False(t, x.plain(0, 64))
+	assert.False(t, x.plain(63, 64))
+	assert.False(t, x.plain(64, 65))
+	assert.True(t, x.plain(65, 128+64+5))
+	assert.False(t, x.plain(65, 128+64+6))
+	assert.True(t, x.plain(10, 10))
+}
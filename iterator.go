@@ -0,0 +1,101 @@
+package goj
+
+// Iterator provides pull style access to the entities of a JSON document,
+// as an alternative to the Callback of Parse.  Each call to Next returns the
+// entity Parse would have passed to its callback, which makes it easy to
+// write parsers for nested types as ordinary recursive functions:
+//
+//	func readPoint(it *goj.Iterator) (p Point, err error) {
+//		for {
+//			t, k, v, err := it.Next()
+//			if err != nil || t == goj.ObjectEnd {
+//				return p, err
+//			}
+//			switch string(k) {
+//			case "x":
+//				p.X, _ = strconv.ParseFloat(string(v), 64)
+//			default:
+//				it.SkipValue()
+//			}
+//		}
+//	}
+//
+// Keys and values returned by Next are only valid until the following call.
+type Iterator struct {
+	p   *Parser
+	t   Type
+	err error
+}
+
+// NewIterator returns an Iterator over the JSON document in buf.
+func NewIterator(buf []byte) *Iterator {
+	it := &Iterator{p: NewParser()}
+	it.Reset(buf)
+	return it
+}
+
+// Reset makes the Iterator start over on the document in buf, so that it
+// may be reused.
+func (it *Iterator) Reset(buf []byte) {
+	it.p.reset(buf)
+	it.t = 0
+	it.err = nil
+}
+
+// Next returns the type, key and value of the next entity in the document.
+// Keys are nil outside of objects.  Once the document is complete, Next
+// returns io.EOF; after an error it keeps returning the same error.
+func (it *Iterator) Next() (Type, []byte, []byte, error) {
+	if it.err != nil {
+		return 0, nil, nil, it.err
+	}
+	t, k, v, err := it.p.next()
+	for err == nil && it.p.dropped() {
+		t, k, v, err = it.p.next()
+	}
+	if err != nil {
+		it.err = err
+		return 0, nil, nil, err
+	}
+	it.t = t
+	return t, k, v, nil
+}
+
+// SkipValue skips the rest of the value last returned by Next.  If that was
+// an Object or Array, all of its contents up to and including the matching
+// ObjectEnd or ArrayEnd are skipped, and their text is returned; for any
+// other entity there is nothing to skip.
+func (it *Iterator) SkipValue() ([]byte, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	if it.t != Object && it.t != Array {
+		return nil, nil
+	}
+	t := it.t
+	it.t = SkippedData
+	v, err := it.p.skip(t)
+	if err != nil {
+		it.err = err
+	}
+	return v, err
+}
+
+// Depth returns the number of objects and arrays which enclose the current
+// position: after Next returns an Object or Array it counts that container,
+// after ObjectEnd or ArrayEnd it no longer does.
+func (it *Iterator) Depth() int {
+	return len(it.p.states)
+}
+
+// Offset returns the position in the document of the entity last returned
+// by Next, or of the text last skipped by SkipValue, as Parser.Offset does.
+func (it *Iterator) Offset() (start, end int) {
+	return it.p.Offset()
+}
+
+// KeyOffset returns the position in the document of the key last returned
+// by Next, as Parser.KeyOffset does.
+func (it *Iterator) KeyOffset() (start, end int) {
+	return it.p.KeyOffset()
+}
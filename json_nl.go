@@ -28,7 +28,8 @@ func ReadJSONNL(s io.Reader, cb func(t Type, key []byte, value []byte, line int6
 			return Cancel
 		})
 		if err != nil {
-			break
+			// stop here, rather than parse the line again below
+			return err
 		}
 		lineNumber++
 	}
@@ -0,0 +1,102 @@
+package goj
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// kernel is a set of scanning routines.  Each scanning routine returns the
+// number of bytes from offset up to the first one it stops at, or to the end
+// of s: numberChars stops at anything but a digit, stringChars at '"', '\\'
+// and control characters, braces at '{', '}' and '"', and brackets at '[',
+// ']' and '"'.  classify fills in the blockMasks of the len(m) blocks of 64
+// bytes at the start of s, for the indexed engine.
+type kernel struct {
+	name        string
+	numberChars func(s []byte, offset int) int
+	stringChars func(s []byte, offset int) int
+	braces      func(s []byte, offset int) int
+	brackets    func(s []byte, offset int) int
+	classify    func(s []byte, m []blockMasks)
+}
+
+var goKernel = kernel{"generic", scanNumberCharsGo, scanNonSpecialStringCharsGo, scanBracesGo, scanBracketsGo, classifyGo}
+
+// kernels lists the kernels this CPU supports, slowest first, as detected
+// once when the package is initialized.  The last of them is used unless
+// GOJDEBUG selects another, see SetKernel.  The scanning routines of the
+// kernel in use are the variables below.
+var (
+	kernels      = supportedKernels()
+	activeKernel = debugKernel(os.Getenv("GOJDEBUG"))
+
+	scanNumberCharsASM           = activeKernel.numberChars
+	scanNonSpecialStringCharsASM = activeKernel.stringChars
+	scanBraces                   = activeKernel.braces
+	scanBrackets                 = activeKernel.brackets
+	classifyBlocks               = activeKernel.classify
+)
+
+// debugKernel returns the kernel which the kernel setting of a GOJDEBUG
+// value names, such as "kernel=generic", or else the fastest one.  Like
+// GODEBUG, it is a comma separated list of settings, and those it doesn't
+// know are ignored.
+func debugKernel(env string) kernel {
+	for _, setting := range strings.Split(env, ",") {
+		if name := strings.TrimPrefix(setting, "kernel="); name != setting {
+			if k, ok := findKernel(name); ok {
+				return k
+			}
+		}
+	}
+	return kernels[len(kernels)-1]
+}
+
+func findKernel(name string) (kernel, bool) {
+	for _, k := range kernels {
+		if k.name == name {
+			return k, true
+		}
+	}
+	return kernel{}, false
+}
+
+// Kernels returns the names of the scanning kernels this CPU supports,
+// slowest first: "generic", the plain Go loops, then on amd64 those of
+// "sse42", "avx2" and "avx512" it supports, and on arm64 "neon".
+func Kernels() []string {
+	names := make([]string, len(kernels))
+	for i, k := range kernels {
+		names[i] = k.name
+	}
+	return names
+}
+
+// Kernel returns the name of the scanning kernel in use.
+func Kernel() string {
+	return activeKernel.name
+}
+
+// SetKernel selects the scanning kernel, one of Kernels.  goj uses the
+// fastest one by default, so this is for debugging and benchmarks: the
+// "generic" kernel rules out vector instructions as the cause of a problem.
+// Setting GOJDEBUG=kernel=name in the environment does the same when the
+// program starts.
+//
+// SetKernel must not be called while documents are being parsed, its effect
+// on them is undefined.
+func SetKernel(name string) error {
+	k, ok := findKernel(name)
+	if !ok {
+		return errors.New("goj: unknown kernel " + strconv.Quote(name) + ", this CPU supports " + strings.Join(Kernels(), ", "))
+	}
+	activeKernel = k
+	scanNumberCharsASM = k.numberChars
+	scanNonSpecialStringCharsASM = k.stringChars
+	scanBraces = k.braces
+	scanBrackets = k.brackets
+	classifyBlocks = k.classify
+	return nil
+}
@@ -0,0 +1,65 @@
+package goj
+
+// SSE4.2 scanning routines, in parse_asm.s.
+func scanNumberCharsSSE42(s []byte, offset int) int
+func scanNonSpecialStringCharsSSE42(s []byte, offset int) int
+func scanBracesSSE42(s []byte, offset int) int
+func scanBracketsSSE42(s []byte, offset int) int
+
+// AVX2 and AVX-512 scanning routines, in kernel_amd64.s.
+func scanNumberCharsAVX2(s []byte, offset int) int
+func scanNonSpecialStringCharsAVX2(s []byte, offset int) int
+func scanBracesAVX2(s []byte, offset int) int
+func scanBracketsAVX2(s []byte, offset int) int
+func scanNumberCharsAVX512(s []byte, offset int) int
+func scanNonSpecialStringCharsAVX512(s []byte, offset int) int
+func scanBracesAVX512(s []byte, offset int) int
+func scanBracketsAVX512(s []byte, offset int) int
+func classifyAVX2(s []byte, m []blockMasks)
+func classifyAVX512(s []byte, m []blockMasks)
+
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+func xgetbv() (eax, edx uint32)
+
+// CPUID and XCR0 bits, as in golang.org/x/sys/cpu.
+const (
+	cpuidSSE42      = 1 << 20 // leaf 1, ECX
+	cpuidOSXSAVE    = 1 << 27 // leaf 1, ECX
+	cpuidAVX        = 1 << 28 // leaf 1, ECX
+	cpuidAVX2       = 1 << 5  // leaf 7, EBX
+	cpuidAVX512F    = 1 << 16 // leaf 7, EBX
+	cpuidAVX512BW   = 1 << 30 // leaf 7, EBX
+	xcr0AVXState    = 0x06    // XMM and YMM registers
+	xcr0AVX512State = 0xe0    // opmask and ZMM registers
+)
+
+func supportedKernels() []kernel {
+	ks := []kernel{goKernel}
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 1 {
+		return ks
+	}
+	_, _, ecx1, _ := cpuid(1, 0)
+	if ecx1&cpuidSSE42 == 0 {
+		return ks
+	}
+	ks = append(ks, kernel{"sse42", scanNumberCharsSSE42, scanNonSpecialStringCharsSSE42, scanBracesSSE42, scanBracketsSSE42, classifyGo})
+
+	// AVX needs support from the OS as well as the CPU, to save the
+	// registers on context switches
+	if maxID < 7 || ecx1&cpuidOSXSAVE == 0 || ecx1&cpuidAVX == 0 {
+		return ks
+	}
+	xcr0, _ := xgetbv()
+	if xcr0&xcr0AVXState != xcr0AVXState {
+		return ks
+	}
+	_, ebx7, _, _ := cpuid(7, 0)
+	if ebx7&cpuidAVX2 != 0 {
+		ks = append(ks, kernel{"avx2", scanNumberCharsAVX2, scanNonSpecialStringCharsAVX2, scanBracesAVX2, scanBracketsAVX2, classifyAVX2})
+	}
+	if ebx7&cpuidAVX512F != 0 && ebx7&cpuidAVX512BW != 0 && xcr0&xcr0AVX512State == xcr0AVX512State {
+		ks = append(ks, kernel{"avx512", scanNumberCharsAVX512, scanNonSpecialStringCharsAVX512, scanBracesAVX512, scanBracketsAVX512, classifyAVX512})
+	}
+	return ks
+}
@@ -0,0 +1,384 @@
+// AVX2 and AVX-512 versions of the scanning routines in parse_asm.s.
+//
+// Rather than PCMPESTRI on 16 bytes, these compare 32 (AVX2) or 64
+// (AVX-512BW) bytes against each stop character, combine the results and
+// move them to a bit mask, one bit per byte, whose trailing zeros count the
+// bytes before the first stop character.
+//
+// Neither reads outside of s.  Once fewer than 32 bytes remain the AVX2
+// routines compare the last 32 bytes of s instead, shifting out the bits of
+// the bytes already scanned, and only slices shorter than that are scanned
+// a byte at a time.  The AVX-512 routines load the last bytes with a mask,
+// which suppresses faults on the bytes it leaves out.
+
+#include "textflag.h"
+
+// SCAN_SETUP loads the arguments: DI holds the start of s, SI the next byte
+// to scan, DX the number of bytes left and R8 where the scan started.
+#define SCAN_SETUP \
+	MOVQ s_base+0(FP), DI; \
+	MOVQ s_len+8(FP), DX; \
+	MOVQ offset+24(FP), BX; \
+	LEAQ (DI)(BX*1), SI; \
+	SUBQ BX, DX; \
+	MOVQ SI, R8
+
+// BROADCAST32 and BROADCAST64 fill a vector register with a byte.
+#define BROADCAST32(c, Y) \
+	MOVL $c, AX; \
+	VMOVQ AX, X15; \
+	VPBROADCASTB X15, Y
+
+#define BROADCAST64(c, Z) \
+	MOVL $c, AX; \
+	VPBROADCASTB AX, Z
+
+// The AVX2 stop characters, for the bytes in Y0, are put in Y4.  Numbers
+// stop at bytes above '9' (Y2) or, compared as signed bytes so that those
+// above 0x7f count, below '0' (Y1).
+#define NUMBER_STOPS_AVX2 \
+	VPCMPGTB Y2, Y0, Y4; \
+	VPCMPGTB Y0, Y1, Y5; \
+	VPOR Y5, Y4, Y4
+
+// Strings stop at '"' (Y1), '\\' (Y2) and at bytes no greater than 0x1f
+// (Y3), which are those whose maximum with 0x1f is 0x1f.
+#define STRING_STOPS_AVX2 \
+	VPCMPEQB Y1, Y0, Y4; \
+	VPCMPEQB Y2, Y0, Y5; \
+	VPMAXUB Y3, Y0, Y6; \
+	VPCMPEQB Y3, Y6, Y6; \
+	VPOR Y5, Y4, Y4; \
+	VPOR Y6, Y4, Y4
+
+// Braces and brackets stop at the characters in Y1, Y2 and Y3.
+#define PAIR_STOPS_AVX2 \
+	VPCMPEQB Y1, Y0, Y4; \
+	VPCMPEQB Y2, Y0, Y5; \
+	VPCMPEQB Y3, Y0, Y6; \
+	VPOR Y5, Y4, Y4; \
+	VPOR Y6, Y4, Y4
+
+// SCAN_AVX2 is the body of an AVX2 routine, given the macro which compares
+// the bytes in Y0, and a prefix for its labels.
+#define SCAN_AVX2(STOPS, loop, tail, bytes, found, end, STOP_BYTE) \
+loop: \
+	CMPQ DX, $32; \
+	JB tail; \
+	VMOVDQU (SI), Y0; \
+	STOPS; \
+	VPMOVMSKB Y4, AX; \
+	TESTL AX, AX; \
+	JNZ found; \
+	ADDQ $32, SI; \
+	SUBQ $32, DX; \
+	JMP loop; \
+tail: \
+	TESTQ DX, DX; \
+	JZ end; \
+	LEAQ -32(SI)(DX*1), R9; \
+	CMPQ R9, DI; \
+	JB bytes; \
+	VMOVDQU (R9), Y0; \
+	STOPS; \
+	VPMOVMSKB Y4, AX; \
+	MOVQ $32, CX; \
+	SUBQ DX, CX; \
+	SHRL CX, AX; \
+	TESTL AX, AX; \
+	JNZ found; \
+	ADDQ DX, SI; \
+	JMP end; \
+bytes: \
+	MOVBLZX (SI), AX; \
+	STOP_BYTE; \
+	INCQ SI; \
+	DECQ DX; \
+	JNZ bytes; \
+	JMP end; \
+found: \
+	BSFL AX, AX; \
+	ADDQ AX, SI; \
+end: \
+	VZEROUPPER; \
+	SUBQ R8, SI; \
+	MOVQ SI, ret+32(FP); \
+	RET
+
+// The byte at a time checks, which jump to end when the byte in AX stops
+// the scan.
+#define NUMBER_STOP_BYTE(end) \
+	SUBL $0x30, AX; \
+	CMPL AX, $9; \
+	JA end
+
+#define STRING_STOP_BYTE(end) \
+	CMPL AX, $0x22; \
+	JEQ end; \
+	CMPL AX, $0x5c; \
+	JEQ end; \
+	CMPL AX, $0x20; \
+	JB end
+
+#define PAIR_STOP_BYTE(open, close, end) \
+	CMPL AX, $open; \
+	JEQ end; \
+	CMPL AX, $close; \
+	JEQ end; \
+	CMPL AX, $0x22; \
+	JEQ end
+
+// The AVX-512 stop characters, for the bytes in Z0 selected by K3, are put
+// in K1.  Numbers stop at bytes which, less '0' (Z1), are above 9 (Z2).
+#define NUMBER_STOPS_AVX512 \
+	VPSUBB Z1, Z0, Z4; \
+	VPCMPUB $6, Z2, Z4, K3, K1
+
+// Strings stop at '"' (Z1), '\\' (Z2) and bytes below 0x20 (Z3).
+#define STRING_STOPS_AVX512 \
+	VPCMPEQB Z1, Z0, K3, K1; \
+	VPCMPEQB Z2, Z0, K3, K2; \
+	KORQ K2, K1, K1; \
+	VPCMPUB $1, Z3, Z0, K3, K2; \
+	KORQ K2, K1, K1
+
+// Braces and brackets stop at the characters in Z1, Z2 and Z3.
+#define PAIR_STOPS_AVX512 \
+	VPCMPEQB Z1, Z0, K3, K1; \
+	VPCMPEQB Z2, Z0, K3, K2; \
+	KORQ K2, K1, K1; \
+	VPCMPEQB Z3, Z0, K3, K2; \
+	KORQ K2, K1, K1
+
+// SCAN_AVX512 is the body of an AVX-512 routine, given the macro which
+// compares the bytes in Z0.
+#define SCAN_AVX512(STOPS, loop, tail, found, end) \
+	KXNORQ K3, K3, K3; \
+loop: \
+	CMPQ DX, $64; \
+	JB tail; \
+	VMOVDQU8 (SI), Z0; \
+	STOPS; \
+	KMOVQ K1, AX; \
+	TESTQ AX, AX; \
+	JNZ found; \
+	ADDQ $64, SI; \
+	SUBQ $64, DX; \
+	JMP loop; \
+tail: \
+	TESTQ DX, DX; \
+	JZ end; \
+	MOVQ $-1, AX; \
+	MOVQ DX, CX; \
+	SHLQ CX, AX; \
+	NOTQ AX; \
+	KMOVQ AX, K3; \
+	VMOVDQU8 (SI), K3, Z0; \
+	STOPS; \
+	KMOVQ K1, AX; \
+	TESTQ AX, AX; \
+	JNZ found; \
+	ADDQ DX, SI; \
+	JMP end; \
+found: \
+	BSFQ AX, AX; \
+	ADDQ AX, SI; \
+end: \
+	VZEROUPPER; \
+	SUBQ R8, SI; \
+	MOVQ SI, ret+32(FP); \
+	RET
+
+// CLASSIFY_AVX2 fills in the masks of the 32 bytes at src, for the Indexed
+// engine, as the low or high halves of the blockMasks at dst.  The
+// characters compared against are in Y5 to Y15, see classifyAVX2.
+// Brackets are found as braces once 0x20 is or'ed in.
+#define CLASSIFY_AVX2(src, dst) \
+	VMOVDQU src, Y0; \
+	VPCMPEQB Y8, Y0, Y1; \
+	VPMOVMSKB Y1, AX; \
+	MOVL AX, 0(dst); \
+	VPCMPEQB Y9, Y0, Y1; \
+	VPMOVMSKB Y1, AX; \
+	MOVL AX, 8(dst); \
+	VPOR Y10, Y0, Y1; \
+	VPCMPEQB Y11, Y1, Y2; \
+	VPCMPEQB Y12, Y1, Y1; \
+	VPOR Y1, Y2, Y2; \
+	VPCMPEQB Y13, Y0, Y1; \
+	VPOR Y1, Y2, Y2; \
+	VPCMPEQB Y14, Y0, Y1; \
+	VPOR Y1, Y2, Y2; \
+	VPMOVMSKB Y2, AX; \
+	MOVL AX, 16(dst); \
+	VPCMPEQB Y10, Y0, Y1; \
+	VPCMPEQB Y5, Y0, Y2; \
+	VPOR Y2, Y1, Y1; \
+	VPCMPEQB Y6, Y0, Y2; \
+	VPOR Y2, Y1, Y1; \
+	VPCMPEQB Y7, Y0, Y2; \
+	VPOR Y2, Y1, Y1; \
+	VPMOVMSKB Y1, AX; \
+	MOVL AX, 24(dst); \
+	VPMAXUB Y15, Y0, Y1; \
+	VPCMPEQB Y15, Y1, Y1; \
+	VPMOVMSKB Y1, AX; \
+	MOVL AX, 32(dst)
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB),NOSPLIT,$0-24
+	MOVL eaxArg+0(FP), AX
+	MOVL ecxArg+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB),NOSPLIT,$0-8
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	MOVL DX, edx+4(FP)
+	RET
+
+TEXT ·scanNumberCharsAVX2(SB),NOSPLIT,$0-40
+	SCAN_SETUP
+	BROADCAST32(0x30, Y1)
+	BROADCAST32(0x39, Y2)
+	SCAN_AVX2(NUMBER_STOPS_AVX2, numberLoop, numberTail, numberBytes, numberFound, numberEnd, NUMBER_STOP_BYTE(numberEnd))
+
+TEXT ·scanNonSpecialStringCharsAVX2(SB),NOSPLIT,$0-40
+	SCAN_SETUP
+	BROADCAST32(0x22, Y1)
+	BROADCAST32(0x5c, Y2)
+	BROADCAST32(0x1f, Y3)
+	SCAN_AVX2(STRING_STOPS_AVX2, stringLoop, stringTail, stringBytes, stringFound, stringEnd, STRING_STOP_BYTE(stringEnd))
+
+TEXT ·scanBracesAVX2(SB),NOSPLIT,$0-40
+	SCAN_SETUP
+	BROADCAST32(0x7b, Y1)
+	BROADCAST32(0x7d, Y2)
+	BROADCAST32(0x22, Y3)
+	SCAN_AVX2(PAIR_STOPS_AVX2, bracesLoop, bracesTail, bracesBytes, bracesFound, bracesEnd, PAIR_STOP_BYTE(0x7b, 0x7d, bracesEnd))
+
+TEXT ·scanBracketsAVX2(SB),NOSPLIT,$0-40
+	SCAN_SETUP
+	BROADCAST32(0x5b, Y1)
+	BROADCAST32(0x5d, Y2)
+	BROADCAST32(0x22, Y3)
+	SCAN_AVX2(PAIR_STOPS_AVX2, bracketsLoop, bracketsTail, bracketsBytes, bracketsFound, bracketsEnd, PAIR_STOP_BYTE(0x5b, 0x5d, bracketsEnd))
+
+TEXT ·scanNumberCharsAVX512(SB),NOSPLIT,$0-40
+	SCAN_SETUP
+	BROADCAST64(0x30, Z1)
+	BROADCAST64(9, Z2)
+	SCAN_AVX512(NUMBER_STOPS_AVX512, numberLoop, numberTail, numberFound, numberEnd)
+
+TEXT ·scanNonSpecialStringCharsAVX512(SB),NOSPLIT,$0-40
+	SCAN_SETUP
+	BROADCAST64(0x22, Z1)
+	BROADCAST64(0x5c, Z2)
+	BROADCAST64(0x20, Z3)
+	SCAN_AVX512(STRING_STOPS_AVX512, stringLoop, stringTail, stringFound, stringEnd)
+
+TEXT ·scanBracesAVX512(SB),NOSPLIT,$0-40
+	SCAN_SETUP
+	BROADCAST64(0x7b, Z1)
+	BROADCAST64(0x7d, Z2)
+	BROADCAST64(0x22, Z3)
+	SCAN_AVX512(PAIR_STOPS_AVX512, bracesLoop, bracesTail, bracesFound, bracesEnd)
+
+TEXT ·scanBracketsAVX512(SB),NOSPLIT,$0-40
+	SCAN_SETUP
+	BROADCAST64(0x5b, Z1)
+	BROADCAST64(0x5d, Z2)
+	BROADCAST64(0x22, Z3)
+	SCAN_AVX512(PAIR_STOPS_AVX512, bracketsLoop, bracketsTail, bracketsFound, bracketsEnd)
+
+// func classifyAVX2(s []byte, m []blockMasks)
+TEXT ·classifyAVX2(SB),NOSPLIT,$0-48
+	MOVQ s_base+0(FP), SI
+	MOVQ m_base+24(FP), DI
+	MOVQ m_len+32(FP), CX
+	BROADCAST32(0x09, Y5)
+	BROADCAST32(0x0a, Y6)
+	BROADCAST32(0x0d, Y7)
+	BROADCAST32(0x22, Y8)
+	BROADCAST32(0x5c, Y9)
+	BROADCAST32(0x20, Y10)
+	BROADCAST32(0x7b, Y11)
+	BROADCAST32(0x7d, Y12)
+	BROADCAST32(0x3a, Y13)
+	BROADCAST32(0x2c, Y14)
+	BROADCAST32(0x1f, Y15)
+	TESTQ CX, CX
+	JZ classifyEnd
+
+classifyLoop:
+	LEAQ 4(DI), R8
+	CLASSIFY_AVX2(0(SI), DI)
+	CLASSIFY_AVX2(32(SI), R8)
+	ADDQ $64, SI
+	ADDQ $40, DI
+	DECQ CX
+	JNZ classifyLoop
+
+classifyEnd:
+	VZEROUPPER
+	RET
+
+// func classifyAVX512(s []byte, m []blockMasks)
+TEXT ·classifyAVX512(SB),NOSPLIT,$0-48
+	MOVQ s_base+0(FP), SI
+	MOVQ m_base+24(FP), DI
+	MOVQ m_len+32(FP), CX
+	BROADCAST64(0x22, Z1)
+	BROADCAST64(0x5c, Z2)
+	BROADCAST64(0x20, Z3)
+	BROADCAST64(0x7b, Z4)
+	BROADCAST64(0x7d, Z5)
+	BROADCAST64(0x3a, Z6)
+	BROADCAST64(0x2c, Z7)
+	BROADCAST64(0x09, Z8)
+	BROADCAST64(0x0a, Z9)
+	BROADCAST64(0x0d, Z10)
+	TESTQ CX, CX
+	JZ classifyEnd
+
+classifyLoop:
+	VMOVDQU64 (SI), Z0
+	VPCMPEQB Z1, Z0, K1
+	KMOVQ K1, 0(DI)
+	VPCMPEQB Z2, Z0, K1
+	KMOVQ K1, 8(DI)
+	// brackets are found as braces once 0x20 is or'ed in
+	VPORQ Z3, Z0, Z11
+	VPCMPEQB Z4, Z11, K1
+	VPCMPEQB Z5, Z11, K2
+	KORQ K2, K1, K1
+	VPCMPEQB Z6, Z0, K2
+	KORQ K2, K1, K1
+	VPCMPEQB Z7, Z0, K2
+	KORQ K2, K1, K1
+	KMOVQ K1, 16(DI)
+	VPCMPEQB Z3, Z0, K1
+	VPCMPEQB Z8, Z0, K2
+	KORQ K2, K1, K1
+	VPCMPEQB Z9, Z0, K2
+	KORQ K2, K1, K1
+	VPCMPEQB Z10, Z0, K2
+	KORQ K2, K1, K1
+	KMOVQ K1, 24(DI)
+	VPCMPUB $1, Z3, Z0, K1
+	KMOVQ K1, 32(DI)
+	ADDQ $64, SI
+	ADDQ $40, DI
+	DECQ CX
+	JNZ classifyLoop
+
+classifyEnd:
+	VZEROUPPER
+	RET
@@ -0,0 +1,15 @@
+package goj
+
+// NEON scanning routines, in parse_arm64.s.
+func scanNumberCharsNEON(s []byte, offset int) int
+func scanNonSpecialStringCharsNEON(s []byte, offset int) int
+func scanBracesNEON(s []byte, offset int) int
+func scanBracketsNEON(s []byte, offset int) int
+
+// NEON is part of ARMv8, so it is always there.
+func supportedKernels() []kernel {
+	return []kernel{
+		goKernel,
+		{"neon", scanNumberCharsNEON, scanNonSpecialStringCharsNEON, scanBracesNEON, scanBracketsNEON, classifyGo},
+	}
+}
@@ -0,0 +1,164 @@
+package goj
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Every kernel agrees with the Go one wherever it stops, starting before,
+// at and after the stop character, in slices of every length up to a few
+// vectors, so that the vector loops, the handling of the last bytes and the
+// byte loops for short slices are all exercised.
+func TestKernelsAgree(t *testing.T) {
+	stops := []byte{'0', '9', 'a', '/', ':', '"', '\\', 0x00, 0x01, 0x1f, 0x20, 0x7f, 0x80, 0xff, '{', '}', '[', ']'}
+	for _, k := range kernels {
+		routines := []struct {
+			name     string
+			fn, want func([]byte, int) int
+			fill     byte
+		}{
+			{"numberChars", k.numberChars, goKernel.numberChars, '5'},
+			{"stringChars", k.stringChars, goKernel.stringChars, 'a'},
+			{"braces", k.braces, goKernel.braces, 'a'},
+			{"brackets", k.brackets, goKernel.brackets, 'a'},
+		}
+		for _, r := range routines {
+			for n := 0; n <= 130; n++ {
+				buf := bytes.Repeat([]byte{r.fill}, n)
+				for _, c := range stops {
+					for at := 0; at <= n; at++ {
+						if at < n {
+							buf[at] = c
+						}
+						for _, offset := range []int{0, 1, at - 1, at, at + 1, n - 1, n} {
+							if offset < 0 || offset > n {
+								continue
+							}
+							if got, want := r.fn(buf, offset), r.want(buf, offset); got != want {
+								t.Fatalf("%s %s: %q from %d: got %d, want %d", k.name, r.name, buf, offset, got, want)
+							}
+						}
+						if at < n {
+							buf[at] = r.fill
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// Every kernel classifies bytes as the Go one does, in batches of blocks.
+func TestKernelsClassify(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	buf := make([]byte, 64*classifyBatch)
+	for i := range buf {
+		buf[i] = byte(i)
+		if r.Intn(2) == 0 {
+			buf[i] = "{}[]:,\"\\ \t\n\r"[r.Intn(12)]
+		}
+	}
+	want := make([]blockMasks, classifyBatch)
+	goKernel.classify(buf, want)
+	for _, k := range kernels {
+		for _, n := range []int{0, 1, 2, classifyBatch} {
+			got := make([]blockMasks, n)
+			k.classify(buf, got)
+			for b := range got {
+				if got[b] != want[b] {
+					t.Fatalf("%s: block %d of %d: got %+v, want %+v", k.name, b, n, got[b], want[b])
+				}
+			}
+		}
+	}
+}
+
+// Every kernel may be selected, and parses as the others do.
+func TestSetKernel(t *testing.T) {
+	defer SetKernel(Kernel())
+	names := Kernels()
+	if names[0] != "generic" || Kernel() != debugKernel(os.Getenv("GOJDEBUG")).name {
+		t.Fatalf("kernel %s of %v in use", Kernel(), names)
+	}
+	doc := []byte(`{"a": [1, 2.5, -3, "` + strings.Repeat("x", 100) + `"], "b": {"c": "\u00e9"}}`)
+	var want string
+	for _, name := range names {
+		if err := SetKernel(name); err != nil {
+			t.Fatal(err)
+		}
+		if Kernel() != name {
+			t.Errorf("kernel %s in use, want %s", Kernel(), name)
+		}
+		var b strings.Builder
+		p := NewParser()
+		err := p.Parse(doc, func(typ Type, k []byte, v []byte) Action {
+			fmt.Fprintf(&b, "%s %s %s\n", typ, k, v)
+			if string(k) == "b" {
+				return Skip
+			}
+			return Continue
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if want == "" {
+			want = b.String()
+		} else if b.String() != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, b.String(), want)
+		}
+	}
+	if err := SetKernel("sse3"); err == nil || !strings.Contains(err.Error(), "generic") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestDebugKernel(t *testing.T) {
+	fastest := kernels[len(kernels)-1].name
+	for env, want := range map[string]string{
+		"":                           fastest,
+		"kernel=generic":             "generic",
+		"gctrace=1,kernel=generic,x": "generic",
+		"kernel=none":                fastest,
+		"kernel":                     fastest,
+		"kernel=" + fastest:          fastest,
+	} {
+		if got := debugKernel(env).name; got != want {
+			t.Errorf("%q: got %s, want %s", env, got, want)
+		}
+	}
+}
+
+// The routines are benchmarked as the parser uses them: each call scans a
+// run of the given length inside a larger document, up to a stop character.
+func BenchmarkKernels(b *testing.B) {
+	for _, run := range []int{8, 64, 1024} {
+		pad := bytes.Repeat([]byte(" "), 128)
+		strs := append(append(bytes.Repeat([]byte("a"), run), '"'), pad...)
+		nums := append(append(bytes.Repeat([]byte("7"), run), ','), pad...)
+		for _, k := range kernels {
+			for _, r := range []struct {
+				name string
+				fn   func([]byte, int) int
+				buf  []byte
+			}{
+				{"numberChars", k.numberChars, nums},
+				{"stringChars", k.stringChars, strs},
+				{"braces", k.braces, strs},
+				{"brackets", k.brackets, strs},
+			} {
+				b.Run(fmt.Sprintf("%s/%s/%d", r.name, k.name, run), func(b *testing.B) {
+					b.SetBytes(int64(run))
+					for i := 0; i < b.N; i++ {
+						if r.fn(r.buf, 0) != run {
+							b.Fatal("wrong result")
+						}
+					}
+				})
+			}
+		}
+	}
+}
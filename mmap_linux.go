@@ -0,0 +1,38 @@
+package goj
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mapFile maps the file at path into memory, read only, and returns its
+// contents and the function which unmaps them.  Reading them after that
+// faults.
+func mapFile(path string) ([]byte, func() error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := fi.Size()
+	if size == 0 || !fi.Mode().IsRegular() {
+		// there is nothing to map, or it can't be mapped
+		data, err := os.ReadFile(path)
+		return data, func() error { return nil }, err
+	}
+	if int64(int(size)) != size {
+		return nil, nil, errors.New("goj: " + path + " is too large to map")
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "mmap", Path: path, Err: err}
+	}
+	// the file is read once from start to end, let the kernel read ahead
+	syscall.Madvise(data, syscall.MADV_SEQUENTIAL)
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package goj
+
+import "os"
+
+// mapFile reads the file at path, where files are not mapped into memory.
+func mapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	return data, func() error { return nil }, err
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+const maxTestBufSize = 17317
+
 func TestScanNumbersGo(t *testing.T) {
 	buf := make([]byte, maxTestBufSize)
 	for i := 0; i < maxTestBufSize; i++ {
@@ -0,0 +1,198 @@
+package goj
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Big is a flag which may be combined with Integer, NegInteger or Float when
+// the parser is in big number mode (see SetBigNumbers).  It marks a number
+// which cannot be represented without loss by an int64, uint64 or float64.
+// Use Type.Base() to strip it.
+const Big Type = 0x80
+
+// Base returns the type with any flags (such as Big) removed.
+func (t Type) Base() Type {
+	return t &^ Big
+}
+
+// IsBig returns true if the Big flag is set on the type.
+func (t Type) IsBig() bool {
+	return t&Big != 0
+}
+
+// SetBigNumbers enables or disables big number mode.  When enabled, every
+// number which does not fit losslessly in an int64 (NegInteger), uint64
+// (Integer) or float64 (Float) is reported to the callback with the Big flag
+// set, so that callers may route it through ParseBigInt, ParseBigFloat or
+// ParseBigRat.  The value bytes are unchanged.
+func (p *Parser) SetBigNumbers(on bool) {
+	p.bigNumbers = on
+}
+
+// ErrNotNumber is returned by the big number helpers when passed bytes which
+// are not a JSON number of the required kind.
+var ErrNotNumber = errors.New("goj: not a valid JSON number")
+
+// ParseBigInt converts the bytes of an Integer or NegInteger token to a
+// *big.Int exactly.
+func ParseBigInt(v []byte) (*big.Int, error) {
+	if !isNumber(v) {
+		return nil, ErrNotNumber
+	}
+	i, ok := new(big.Int).SetString(string(v), 10)
+	if !ok {
+		return nil, ErrNotNumber
+	}
+	return i, nil
+}
+
+// ParseBigRat converts the bytes of any number token to a *big.Rat exactly,
+// which makes it suitable for high precision decimal amounts.
+func ParseBigRat(v []byte) (*big.Rat, error) {
+	if !isNumber(v) {
+		return nil, ErrNotNumber
+	}
+	r, ok := new(big.Rat).SetString(string(v))
+	if !ok {
+		return nil, ErrNotNumber
+	}
+	return r, nil
+}
+
+// ParseBigFloat converts the bytes of any number token to a *big.Float.  If
+// prec is 0, a precision large enough to hold every significant decimal digit
+// of the token is chosen, so that integers of any size are exact and
+// decimal fractions are correctly rounded.
+func ParseBigFloat(v []byte, prec uint) (*big.Float, error) {
+	if !isNumber(v) {
+		return nil, ErrNotNumber
+	}
+	if prec == 0 {
+		// log2(10) bits per digit, plus some slack for rounding
+		prec = uint(float64(len(v))*3.33) + 64
+	}
+	f, _, err := big.ParseFloat(string(v), 10, prec, big.ToNearestEven)
+	if err != nil {
+		return nil, ErrNotNumber
+	}
+	return f, nil
+}
+
+// isNumber reports whether v is exactly one well formed JSON number.  The big
+// package accepts a superset of JSON number syntax (hex, underscores, 'inf'),
+// which we must not let through.
+func isNumber(v []byte) bool {
+	i := 0
+	if i < len(v) && v[i] == '-' {
+		i++
+	}
+	if i >= len(v) {
+		return false
+	}
+	if v[i] == '0' {
+		i++
+	} else {
+		x := scanNumberCharsGo(v, i)
+		if x == 0 {
+			return false
+		}
+		i += x
+	}
+	if i < len(v) && v[i] == '.' {
+		i++
+		x := scanNumberCharsGo(v, i)
+		if x == 0 {
+			return false
+		}
+		i += x
+	}
+	if i < len(v) && (v[i] == 'e' || v[i] == 'E') {
+		i++
+		if i < len(v) && (v[i] == '-' || v[i] == '+') {
+			i++
+		}
+		x := scanNumberCharsGo(v, i)
+		if x == 0 {
+			return false
+		}
+		i += x
+	}
+	return i == len(v)
+}
+
+// fitsLosslessly reports whether the number v of type t can be held in the
+// corresponding Go machine type without loss.
+func fitsLosslessly(t Type, v []byte) bool {
+	switch t {
+	case Integer:
+		// 18446744073709551615 is 20 digits
+		if len(v) < 20 {
+			return true
+		}
+		_, err := strconv.ParseUint(string(v), 10, 64)
+		return err == nil
+	case NegInteger:
+		// -9223372036854775808 is 20 bytes
+		if len(v) < 20 {
+			return true
+		}
+		_, err := strconv.ParseInt(string(v), 10, 64)
+		return err == nil
+	case Float:
+		return floatFitsLosslessly(v)
+	}
+	return true
+}
+
+// floatFitsLosslessly reports whether a float token denotes exactly the
+// decimal value that the nearest float64 prints as in shortest form.  That is,
+// whether a round trip through float64 preserves the number.
+func floatFitsLosslessly(v []byte) bool {
+	digits := 0
+	leading := true
+	exp := 0
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c >= '0' && c <= '9' {
+			if c != '0' {
+				leading = false
+			}
+			if !leading {
+				digits++
+			}
+		} else if c == 'e' || c == 'E' {
+			e, err := strconv.Atoi(string(v[i+1:]))
+			if err != nil {
+				return false
+			}
+			exp = e
+			break
+		}
+	}
+	// fifteen significant decimal digits always survive a round trip through
+	// a float64, as long as we stay far away from the exponent limits (which
+	// long runs of zeros may also approach).
+	if digits <= 15 && exp > -290 && exp < 290 && len(v) < 290 {
+		return true
+	}
+	f, err := strconv.ParseFloat(string(v), 64)
+	if err != nil || math.IsInf(f, 0) {
+		return false
+	}
+	if f == 0 {
+		// underflow of a non-zero value to zero is a loss
+		return digits == 0
+	}
+	want, ok := new(big.Rat).SetString(string(v))
+	if !ok {
+		return false
+	}
+	got, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	if !ok {
+		return false
+	}
+	return want.Cmp(got) == 0
+}
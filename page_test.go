@@ -0,0 +1,126 @@
+//go:build linux
+// +build linux
+
+package goj
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// guardedPage returns a page of memory followed by one which may not be
+// read, so that reading past the end of a slice ending at the end of the
+// page faults.
+func guardedPage(t *testing.T) []byte {
+	size := os.Getpagesize()
+	mem, err := syscall.Mmap(-1, 0, 2*size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		t.Skipf("mmap: %v", err)
+	}
+	t.Cleanup(func() { syscall.Munmap(mem) })
+	if err := syscall.Mprotect(mem[size:], syscall.PROT_NONE); err != nil {
+		t.Fatalf("mprotect: %v", err)
+	}
+	return mem[:size:size]
+}
+
+// atPageEnd copies doc to the end of page.
+func atPageEnd(page []byte, doc []byte) []byte {
+	buf := page[len(page)-len(doc):]
+	copy(buf, doc)
+	return buf
+}
+
+// Every kernel scans up to the very end of a slice at the end of a page,
+// whatever its length and wherever the scan starts, without touching the
+// next page.
+func TestKernelsAtPageEnd(t *testing.T) {
+	page := guardedPage(t)
+	for _, k := range kernels {
+		routines := []struct {
+			name     string
+			fn, want func([]byte, int) int
+			fill     byte
+		}{
+			{"numberChars", k.numberChars, goKernel.numberChars, '5'},
+			{"stringChars", k.stringChars, goKernel.stringChars, 'a'},
+			{"braces", k.braces, goKernel.braces, 'a'},
+			{"brackets", k.brackets, goKernel.brackets, 'a'},
+		}
+		for _, r := range routines {
+			for n := 0; n <= 130; n++ {
+				buf := atPageEnd(page, bytes.Repeat([]byte{r.fill}, n))
+				for offset := 0; offset <= n; offset++ {
+					if got, want := r.fn(buf, offset), r.want(buf, offset); got != want {
+						t.Fatalf("%s %s: %d bytes from %d: got %d, want %d", k.name, r.name, n, offset, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Documents which end at the end of a page are parsed in every way, with
+// the fast kernel.
+func TestParseAtPageEnd(t *testing.T) {
+	page := guardedPage(t)
+	docs := []string{
+		`1`,
+		`-12345678901234567890`,
+		`1.5e300`,
+		`"abc"`,
+		`"` + string(bytes.Repeat([]byte("x"), 100)) + `"`,
+		`"é\n\"\u00e9\ud83d\ude00"`,
+		`true`,
+		`[1,2,3]`,
+		`{"a":[1,{"b":"cdef"},"ghijklmnopqrstuvwxyz0123"],"c":{"d":[[]]}}`,
+		`{"long key with no escapes at all":{"` + string(bytes.Repeat([]byte("y"), 40)) + `":[123456789012]}}`,
+	}
+	for _, d := range docs {
+		for cut := 0; cut <= len(d); cut++ {
+			doc := d[:cut]
+			buf := atPageEnd(page, []byte(doc))
+			for _, a := range []Action{Continue, Skip} {
+				want := parseOutcome([]byte(doc), StateMachine, a)
+				for _, e := range []Engine{StateMachine, Indexed} {
+					if got := parseOutcome(buf, e, a); got != want {
+						t.Errorf("%q, %s, action %d: got\n%s\nwant\n%s", doc, e, a, got, want)
+					}
+				}
+			}
+			if cut == len(d) {
+				tape := NewTape()
+				if err := tape.Parse(buf); err != nil {
+					t.Errorf("%q: Tape: %v", doc, err)
+				}
+				if _, err := NewDoc(buf).Raw(); err != nil {
+					t.Errorf("%q: Doc: %v", doc, err)
+				}
+				if q := appendQuoted(nil, buf); !bytes.Equal(q, appendQuoted(nil, []byte(doc))) {
+					t.Errorf("%q: quoted as %s", doc, q)
+				}
+			}
+		}
+	}
+}
+
+// parseOutcome renders what parsing doc reports, skipping every object and
+// array when the action is Skip.
+func parseOutcome(doc []byte, e Engine, a Action) string {
+	var b bytes.Buffer
+	p := NewParser()
+	p.SetEngine(e)
+	err := p.Parse(doc, func(typ Type, k []byte, v []byte) Action {
+		b.WriteString(typ.String() + " " + string(k) + " " + string(v) + "\n")
+		if typ == Object || typ == Array {
+			return a
+		}
+		return Continue
+	})
+	if err != nil {
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
@@ -2,14 +2,15 @@ package goj
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"reflect"
-	"strconv"
 	"unicode/utf8"
-	"unsafe"
 )
 
 // Global PageSize variable so a sys call is not made each time
+//
+// Deprecated: goj no longer needs the page size, the scanning routines
+// never read past the end of the buffer.
 var PageSize = uintptr(os.Getpagesize())
 
 // Type represents the JSON value type.
@@ -53,11 +54,6 @@ const (
 	Skip
 )
 
-// ASM optimized scanning routines
-func hasAsm() bool
-func scanNumberCharsASM(s []byte, offset int) int
-func scanNonSpecialStringCharsASM(s []byte, offset int) int
-
 //go:nosplit
 func scanNonSpecialStringCharsGo(s []byte, offset int) (x int) {
 	for i, c := range s[offset:] {
@@ -78,9 +74,6 @@ func scanNumberCharsGo(s []byte, offset int) (x int) {
 	return len(s) - offset
 }
 
-func scanBraces(s []byte, offset int) int
-func scanBrackets(s []byte, offset int) int
-
 //go:nosplit
 func scanBracesGo(s []byte, offset int) int {
 	for i, c := range s[offset:] {
@@ -102,6 +95,9 @@ func scanBracketsGo(s []byte, offset int) int {
 }
 
 func (t Type) String() string {
+	if t.IsBig() {
+		return "big " + t.Base().String()
+	}
 	switch t {
 	case String:
 		return "string"
@@ -151,15 +147,9 @@ const (
 	sObject
 	sArray
 	sEnd
-	sClientCancelledParse
-	sClientSkippingObject // will skip an entire value
-	sClientSkippingArray  // will skip an entire value
+	sKey // inside an object, after a ','
 )
 
-func (s state) isSkipping() bool {
-	return s > sClientCancelledParse
-}
-
 // Callback is the signature of the client callback to the parsing routine.
 // The routine is passed the type of entity parsed, a key if relevant
 // (parsing inside an object), and a decoded value.
@@ -169,30 +159,27 @@ type Callback func(what Type, key []byte, value []byte) Action
 // The various parsing routines are provided by this object, but it has no
 // exported fields.
 type Parser struct {
-	buf                       []byte
-	i                         int
-	keystack                  [][]byte
-	states                    []state
-	s                         state
-	_cb                       Callback
-	cookedBuf                 []byte
-	scanNumberChars           func(s []byte, offset int) int
-	scanNonSpecialStringChars func(s []byte, offset int) int
-}
-
-func (p *Parser) cb(t Type, k, v []byte) {
-	ok := p._cb(t, k, v)
-	switch ok {
-	case Continue:
-	case Cancel:
-		p.s = sClientCancelledParse
-	case Skip:
-		if t == Object {
-			p.s = sClientSkippingObject
-		} else if t == Array {
-			p.s = sClientSkippingArray
-		}
-	}
+	buf        []byte
+	i          int
+	keystack   [][]byte
+	states     []state
+	s          state
+	cookedBuf  []byte
+	bigNumbers bool
+	start      int // offset of the token being reported
+	keyStart   int // offset of the key being reported
+	keyEnd     int // offset just past it
+	dupPolicy  DuplicateKeys
+	dups       DuplicateKeys // dupPolicy, as of the last reset
+	keySets    []keySet      // one for each open object, unless duplicates are allowed
+	dropDepth  int           // while dropping a duplicate member, the depth of its object
+	ahead      *Parser       // looks ahead for KeepLast
+	aheadEnd   int           // where it stopped looking
+	dropKeys   []int         // the offsets of the keys it found to drop, in order
+	nextDrop   int           // the first of them the parse has not passed
+	engine     Engine
+	indexed    bool     // engine is Indexed, as of the last reset
+	ix         *indexer // for the Indexed engine
 }
 
 func (p *Parser) end() bool {
@@ -206,7 +193,7 @@ func (p *Parser) skipSpace() {
 outer:
 	for len(p.buf) > offset {
 		switch p.buf[offset] {
-		case '\t', '\n', ' ':
+		case '\t', '\n', '\r', ' ':
 			offset++
 		default:
 			break outer
@@ -215,13 +202,46 @@ outer:
 	p.i = offset
 }
 
+// addToCooked appends the text of the string from start up to the '\\'
+// before offset, and then r, to the cooked buffer.  The text is copied with
+// a single append, whose memmove is itself vectorized, and nothing is
+// allocated once the buffer has grown to the longest string.
 func (p *Parser) addToCooked(start, offset int, r rune) {
-	er := make([]byte, 5, 5)
-	x := utf8.EncodeRune(er, r)
 	p.cookedBuf = append(p.cookedBuf, p.buf[start:offset-1]...)
+	if r < utf8.RuneSelf {
+		p.cookedBuf = append(p.cookedBuf, byte(r))
+		return
+	}
+	var er [utf8.UTFMax]byte
+	x := utf8.EncodeRune(er[:], r)
 	p.cookedBuf = append(p.cookedBuf, er[:x]...)
 }
 
+// hexValue holds the value of each hex digit, and 0xff for the other bytes.
+var hexValue = func() (t [256]byte) {
+	for i := range t {
+		t[i] = 0xff
+	}
+	for i := 0; i < 10; i++ {
+		t['0'+i] = byte(i)
+	}
+	for i := 0; i < 6; i++ {
+		t['a'+i] = byte(10 + i)
+		t['A'+i] = byte(10 + i)
+	}
+	return t
+}()
+
+// hex4 returns the value of the four hex digits which begin b, as in a
+// '\\u' escape, or -1 if they are not all hex digits.
+func hex4(b []byte) rune {
+	a, c, d, e := hexValue[b[0]], hexValue[b[1]], hexValue[b[2]], hexValue[b[3]]
+	if (a|c|d|e)&0xf0 != 0 {
+		return -1
+	}
+	return rune(a)<<12 | rune(c)<<8 | rune(d)<<4 | rune(e)
+}
+
 func (p *Parser) readString() ([]byte, bool, error) {
 	buf := p.buf
 	if buf[p.i] != '"' {
@@ -233,7 +253,7 @@ func (p *Parser) readString() ([]byte, bool, error) {
 	p.cookedBuf = p.cookedBuf[0:0]
 
 	for len(buf) > offset {
-		offset += p.scanNonSpecialStringChars(buf, offset)
+		offset += scanNonSpecialStringCharsASM(buf, offset)
 		if len(buf) <= offset {
 			return nil, false, p.pError("unterminated string found")
 		}
@@ -241,6 +261,9 @@ func (p *Parser) readString() ([]byte, bool, error) {
 		switch c {
 		case '\\':
 			offset++
+			if len(buf) <= offset {
+				break // the string is unterminated, the loop ends
+			}
 			switch buf[offset] {
 			case '\\', '/', '"':
 				p.addToCooked(start, offset, rune(buf[offset]))
@@ -271,8 +294,8 @@ func (p *Parser) readString() ([]byte, bool, error) {
 				if len(buf)-offset < 4 {
 					return nil, false, p.pError("unexpected EOF after '\\u'")
 				}
-				r, err := strconv.ParseInt(string(buf[offset:offset+4]), 16, 0)
-				if err != nil {
+				r := hex4(buf[offset:])
+				if r < 0 {
 					return nil, false, p.pError("invalid (non-hex) character occurs after '\\u' inside string.")
 				}
 				offset--
@@ -287,8 +310,8 @@ func (p *Parser) readString() ([]byte, bool, error) {
 					} else if buf[toff] != '\\' || buf[toff+1] != 'u' {
 						r = '?' // surrogate marker not followed by codepoint
 					} else {
-						surrogate, err := strconv.ParseInt(string(buf[toff+2:toff+6]), 16, 0)
-						if err != nil {
+						surrogate := hex4(buf[toff+2:])
+						if surrogate < 0 {
 							r = '?' // invalid hex in second member of pair
 						} else {
 							surrogateSize = 6
@@ -296,7 +319,7 @@ func (p *Parser) readString() ([]byte, bool, error) {
 						}
 					}
 				}
-				p.addToCooked(start, offset, rune(r))
+				p.addToCooked(start, offset, r)
 				offset += 5 + surrogateSize
 				start = offset
 			default:
@@ -307,7 +330,9 @@ func (p *Parser) readString() ([]byte, bool, error) {
 		case '"':
 			p.i = offset + 1
 			if len(p.cookedBuf) > 0 {
-				return append(p.cookedBuf, buf[start:offset]...), true, nil
+				// kept, so that the grown buffer is reused
+				p.cookedBuf = append(p.cookedBuf, buf[start:offset]...)
+				return p.cookedBuf, true, nil
 			}
 			return buf[start:offset], false, nil
 		default:
@@ -342,7 +367,7 @@ func (p *Parser) readNumber() ([]byte, Type, error) {
 		case '-':
 			t = NegInteger
 			p.i++
-			x := p.scanNumberChars(p.buf, p.i)
+			x := scanNumberCharsASM(p.buf, p.i)
 			if x == 0 {
 				return nil, t, p.pError("malformed number, a digit is required after the minus sign")
 			}
@@ -350,7 +375,7 @@ func (p *Parser) readNumber() ([]byte, Type, error) {
 		case '0':
 			p.i++
 		case '1', '2', '3', '4', '5', '6', '7', '8', '9':
-			p.i += p.scanNumberChars(p.buf, p.i)
+			p.i += scanNumberCharsASM(p.buf, p.i)
 		}
 		if p.i == start {
 			return nil, t, p.pError("number expected")
@@ -358,7 +383,7 @@ func (p *Parser) readNumber() ([]byte, Type, error) {
 		if len(p.buf) > p.i && p.buf[p.i] == '.' {
 			t = Float
 			p.i++
-			x := p.scanNumberChars(p.buf, p.i)
+			x := scanNumberCharsASM(p.buf, p.i)
 			if x == 0 {
 				return nil, t, p.pError("digit expected after decimal point")
 			}
@@ -372,7 +397,7 @@ func (p *Parser) readNumber() ([]byte, Type, error) {
 			if len(p.buf) > p.i && (p.buf[p.i] == '-' || p.buf[p.i] == '+') {
 				p.i++
 			}
-			x := p.scanNumberChars(p.buf, p.i)
+			x := scanNumberCharsASM(p.buf, p.i)
 			if x == 0 {
 				return nil, t, p.pError("digits expected after exponent marker (e)")
 			}
@@ -392,7 +417,7 @@ func (p *Parser) skipString() error {
 	offset := p.i
 
 	for len(buf) > offset {
-		offset += p.scanNonSpecialStringChars(buf, offset)
+		offset += scanNonSpecialStringCharsASM(buf, offset)
 		if len(buf) <= offset {
 			return p.pError("unterminated string found")
 		}
@@ -400,6 +425,9 @@ func (p *Parser) skipString() error {
 		switch c {
 		case '\\':
 			offset++
+			if len(buf) <= offset {
+				break // the string is unterminated, the loop ends
+			}
 			switch buf[offset] {
 			case '\\', '/', '"':
 				offset++
@@ -418,8 +446,8 @@ func (p *Parser) skipString() error {
 				if len(buf)-offset < 4 {
 					return p.pError("unexpected EOF after '\\u'")
 				}
-				r, err := strconv.ParseInt(string(buf[offset:offset+4]), 16, 0)
-				if err != nil {
+				r := hex4(buf[offset:])
+				if r < 0 {
 					return p.pError("invalid (non-hex) character occurs after '\\u' inside string.")
 				}
 				offset--
@@ -434,8 +462,8 @@ func (p *Parser) skipString() error {
 					} else if buf[toff] != '\\' || buf[toff+1] != 'u' {
 						r = '?' // surrogate marker not followed by codepoint
 					} else {
-						surrogate, err := strconv.ParseInt(string(buf[toff+2:toff+6]), 16, 0)
-						if err != nil {
+						surrogate := hex4(buf[toff+2:])
+						if surrogate < 0 {
 							r = '?' // invalid hex in second member of pair
 						} else {
 							surrogateSize = 6
@@ -515,15 +543,8 @@ func (p *Parser) popState() {
 	}
 }
 
-func (p *Parser) restoreState() {
-	if len(p.states) > 0 {
-		p.s = p.states[len(p.states)-1]
-	} else {
-		p.s = sEnd
-	}
-}
-
-func (p *Parser) send(t Type, v []byte) {
+// key pops the key of the value being reported, if it is inside an object.
+func (p *Parser) key() []byte {
 	states := p.states
 	slen := len(states)
 	if slen > 0 && states[slen-1] == sObject {
@@ -531,13 +552,12 @@ func (p *Parser) send(t Type, v []byte) {
 		off := len(keystack) - 1
 		k := keystack[off]
 		p.keystack = keystack[:off]
-		p.cb(t, k, v)
-	} else {
-		p.cb(t, nil, v)
+		return k
 	}
+	return nil
 }
 
-func (p *Parser) skipSection(scan func([]byte, int) int, open,close byte) error {
+func (p *Parser) skipSection(scan func([]byte, int) int, open, close byte) ([]byte, error) {
 	// we just skipped the '{'
 	start := p.i - 1
 	p.skipSpace()
@@ -546,7 +566,9 @@ func (p *Parser) skipSection(scan func([]byte, int) int, open,close byte) error
 	buf := p.buf
 	for len(buf) > offset && in > 0 {
 		offset += scan(buf, offset)
-		if buf[offset] == open {
+		if len(buf) <= offset {
+			break
+		} else if buf[offset] == open {
 			offset++
 			in++
 		} else if buf[offset] == close {
@@ -555,24 +577,38 @@ func (p *Parser) skipSection(scan func([]byte, int) int, open,close byte) error
 		} else if buf[offset] == '"' {
 			p.i = offset
 			if err := p.skipString(); err != nil {
-				return err
+				return nil, err
 			}
 			offset = p.i
 		}
 	}
 
 	p.i = offset
-	p.cb(SkippedData, nil, buf[start:offset])
+	if in > 0 {
+		return nil, p.pError("premature EOF")
+	}
+	p.start = start
 	p.s = sValueEnd
-	return nil
-}
-
-func (p *Parser) skipObject() error {
-	return p.skipSection(scanBraces, '{','}')
+	return buf[start:offset], nil
 }
 
-func (p *Parser) skipArray() error {
-	return p.skipSection(scanBrackets, '[',']')
+// skip skips the remainder of the object or array which the most recent
+// entity opened, returning all of its text.
+func (p *Parser) skip(t Type) ([]byte, error) {
+	p.states = p.states[:len(p.states)-1]
+	if t == Object {
+		if p.dups != AllowDuplicates {
+			p.closeObject()
+		}
+		if p.indexed {
+			return p.skipIndexed('{', '}')
+		}
+		return p.skipSection(scanBraces, '{', '}')
+	}
+	if p.indexed {
+		return p.skipIndexed('[', ']')
+	}
+	return p.skipSection(scanBrackets, '[', ']')
 }
 
 // NewParser - Allocate a new JSON Scanner that may be re-used.
@@ -584,37 +620,100 @@ func NewParser() *Parser {
 		make([]state, 0, 4),
 		sValue,
 		nil,
+		false,
+		0,
+		0,
+		0,
+		AllowDuplicates,
+		AllowDuplicates,
+		nil,
+		0,
+		nil,
+		0,
+		nil,
+		0,
+		StateMachine,
+		false,
 		nil,
-		scanNumberCharsGo,
-		scanNonSpecialStringCharsGo,
 	}
 }
 
-// recordNearPage returns true if the end of the record is within 15 bytes of the end of a page
-func recordNearPage(buf []byte) bool {
-	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&buf))
-	return (hdr.Data+uintptr(hdr.Len)-1)&(PageSize-1) >= PageSize-15
-}
-
 // Parse parses a complete JSON document. Callback will be invoked once
 // for each JSON entity found.
-func (p *Parser) Parse(buf []byte, cb Callback) (err error) {
+func (p *Parser) Parse(buf []byte, cb Callback) error {
+	p.reset(buf)
+	for {
+		t, k, v, err := p.next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if p.dropped() {
+			continue
+		}
+		switch cb(t, k, v) {
+		case Cancel:
+			return ClientCancelledParse
+		case Skip:
+			if t == Object || t == Array {
+				if v, err = p.skip(t); err != nil {
+					return err
+				}
+				if cb(SkippedData, nil, v) == Cancel {
+					return ClientCancelledParse
+				}
+			}
+		}
+	}
+}
+
+// Offset returns the position in the document of the entity last passed to
+// the callback, from its first byte to just past its last.  For Object and
+// Array that is the opening brace or bracket, for ObjectEnd and ArrayEnd the
+// closing one, and for SkippedData all of the skipped text.  The key of a
+// member is not included, see KeyOffset.
+func (p *Parser) Offset() (start, end int) {
+	return p.start, p.i
+}
+
+// KeyOffset returns the position in the document of the key, quotes
+// included, of the entity last passed to the callback.  It is only
+// meaningful when the callback was passed a key.
+func (p *Parser) KeyOffset() (start, end int) {
+	return p.keyStart, p.keyEnd
+}
+
+// reset prepares the parser to scan buf from the beginning.
+func (p *Parser) reset(buf []byte) {
 	p.buf = buf
 	p.i = 0
 	p.s = sValue
 	p.keystack = p.keystack[:0]
 	p.states = p.states[:0]
-	p._cb = cb
-	depth := 0
-	if hasAsm() {
-		if recordNearPage(buf) {
-			p.scanNonSpecialStringChars = scanNonSpecialStringCharsGo
-			p.scanNumberChars = scanNumberCharsGo
-		} else {
-			p.scanNonSpecialStringChars = scanNonSpecialStringCharsASM
-			p.scanNumberChars = scanNumberCharsASM
-		}
-	} // else we don't have to ever worry about that.
+	p.dups = p.dupPolicy
+	p.keySets = p.keySets[:0]
+	p.dropDepth = 0
+	p.aheadEnd = 0
+	p.indexed = p.useIndex(buf)
+}
+
+// next scans up to the next JSON entity and returns it.  It is the step
+// function of the parser, Parse and Iterator are both driven by it.  Once
+// the document is complete, next returns io.EOF.
+// Entities of duplicate members which are dropped are still returned, see
+// dropped.
+func (p *Parser) next() (Type, []byte, []byte, error) {
+	if p.indexed {
+		return p.nextIndexed()
+	}
+	return p.scanNext()
+}
+
+// scanNext is next for the StateMachine engine.
+func (p *Parser) scanNext() (Type, []byte, []byte, error) {
+	buf := p.buf
 scan:
 	for len(buf) > p.i {
 		switch p.s {
@@ -626,31 +725,38 @@ scan:
 				case sObject:
 					p.skipSpace()
 					if len(buf) <= p.i {
-						return p.pError("premature EOF")
+						return 0, nil, nil, p.pError("premature EOF")
 					} else if buf[p.i] == ',' {
-						p.s = sObject
+						p.i++
+						p.s = sKey
 					} else if buf[p.i] == '}' {
+						p.start = p.i
+						p.i++
 						p.popState()
 						p.s = sValueEnd
-						p.cb(ObjectEnd, nil, nil)
+						if p.dups != AllowDuplicates {
+							p.closeObject()
+						}
+						return ObjectEnd, nil, nil, nil
 					} else {
-						return p.pError("after key and value, inside map, I expect ',' or '}'")
+						return 0, nil, nil, p.pError("after key and value, inside map, I expect ',' or '}'")
 					}
-					p.i++
 				case sArray:
 					p.skipSpace()
 					if len(buf) <= p.i {
-						return p.pError("premature EOF")
+						return 0, nil, nil, p.pError("premature EOF")
 					} else if buf[p.i] == ',' {
+						p.i++
 						p.s = sValue
 					} else if buf[p.i] == ']' {
+						p.start = p.i
+						p.i++
 						p.popState()
 						p.s = sValueEnd
-						p.cb(ArrayEnd, nil, nil)
+						return ArrayEnd, nil, nil, nil
 					} else {
-						return p.pError("2 unexpected character")
+						return 0, nil, nil, p.pError("2 unexpected character")
 					}
-					p.i++
 				default:
 					panic("internal inconsistency")
 				}
@@ -659,113 +765,100 @@ scan:
 			// eat whitespace
 			p.skipSpace()
 			if len(buf) <= p.i {
-				return p.pError("unexpected end of buffer")
+				return 0, nil, nil, p.pError("unexpected end of buffer")
 			}
+			p.start = p.i
 			switch buf[p.i] {
 			case '{':
-				depth++
 				p.i++
-				p.send(Object, nil)
-				if !p.s.isSkipping() {
-					p.pushState(sObject)
+				k := p.key()
+				p.pushState(sObject)
+				if p.dups != AllowDuplicates {
+					p.openObject()
 				}
+				return Object, k, nil, nil
 			case '[':
-				depth++
 				p.i++
-				p.send(Array, nil)
-				if !p.s.isSkipping() {
-					p.pushState(sArray)
-				}
+				k := p.key()
+				p.pushState(sArray)
+				return Array, k, nil, nil
 			case '"':
-				var v []byte
-				var err error
-				if v, _, err = p.readString(); err != nil {
-					return err
-				}
-				p.restoreState()
-				p.send(String, v)
-				if p.s != sClientCancelledParse {
-					p.s = sValueEnd
+				v, _, err := p.readString()
+				if err != nil {
+					return 0, nil, nil, err
 				}
+				p.s = sValueEnd
+				return String, p.key(), v, nil
 			case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-				var t Type
-				var v []byte
-				var err error
-				if v, t, err = p.readNumber(); err != nil {
-					return err
+				v, t, err := p.readNumber()
+				if err != nil {
+					return 0, nil, nil, err
 				}
-				p.restoreState()
-				p.send(t, v)
-				if p.s != sClientCancelledParse {
-					p.s = sValueEnd
+				if p.bigNumbers && !fitsLosslessly(t, v) {
+					t |= Big
 				}
+				p.s = sValueEnd
+				return t, p.key(), v, nil
 			case 'n':
 				if len("null") <= len(buf)-p.i && buf[p.i+1] == 'u' && buf[p.i+2] == 'l' && buf[p.i+3] == 'l' {
 					p.i += len("null")
-					p.restoreState()
-					p.send(Null, nil)
-					if p.s != sClientCancelledParse {
-						p.s = sValueEnd
-					}
-				} else {
-					return p.pError("invalid string in json text.")
+					p.s = sValueEnd
+					return Null, p.key(), nil, nil
 				}
+				return 0, nil, nil, p.pError("invalid string in json text.")
 			case 't':
 				if len("true") <= len(buf)-p.i && buf[p.i+1] == 'r' && buf[p.i+2] == 'u' && buf[p.i+3] == 'e' {
 					p.i += len("true")
-					p.restoreState()
-					p.send(True, nil)
-					if p.s != sClientCancelledParse {
-						p.s = sValueEnd
-					}
-				} else {
-					return p.pError("invalid string in json text.")
+					p.s = sValueEnd
+					return True, p.key(), nil, nil
 				}
+				return 0, nil, nil, p.pError("invalid string in json text.")
 			case 'f':
 				if len("false") <= len(buf)-p.i && buf[p.i+1] == 'a' && buf[p.i+2] == 'l' && buf[p.i+3] == 's' && buf[p.i+4] == 'e' {
 					p.i += len("false")
-					p.restoreState()
-					p.send(False, nil)
-					if p.s != sClientCancelledParse {
-						p.s = sValueEnd
-					}
-				} else {
-					return p.pError("invalid string in json text.")
+					p.s = sValueEnd
+					return False, p.key(), nil, nil
 				}
+				return 0, nil, nil, p.pError("invalid string in json text.")
 			default:
-				return p.pError("unallowed token at this point in JSON text")
+				return 0, nil, nil, p.pError("unallowed token at this point in JSON text")
 			}
 		case sArray:
 			p.skipSpace()
 			if len(buf) <= p.i {
-				return p.pError("premature EOF")
+				return 0, nil, nil, p.pError("premature EOF")
 			} else if buf[p.i] == ']' {
+				p.start = p.i
 				p.i++
 				p.popState()
 				p.s = sValueEnd
-				p.cb(ArrayEnd, nil, nil)
+				return ArrayEnd, nil, nil, nil
 			} else {
 				p.s = sValue
 			}
-		case sObject:
+		case sObject, sKey:
 			p.skipSpace()
 			if len(buf) <= p.i {
-				return p.pError("premature EOF")
-			} else if buf[p.i] == '}' {
+				return 0, nil, nil, p.pError("premature EOF")
+			} else if buf[p.i] == '}' && p.s == sObject {
+				p.start = p.i
 				p.i++
 				p.popState()
 				p.s = sValueEnd
-				p.cb(ObjectEnd, nil, nil)
+				if p.dups != AllowDuplicates {
+					p.closeObject()
+				}
+				return ObjectEnd, nil, nil, nil
 			} else {
-				var k []byte
-				var err error
-				var cooked bool
-				if k, cooked, err = p.readString(); err != nil {
-					return err
+				p.keyStart = p.i
+				k, cooked, err := p.readString()
+				if err != nil {
+					return 0, nil, nil, err
 				}
+				p.keyEnd = p.i
 				p.skipSpace()
 				if len(buf) <= p.i || buf[p.i] != ':' {
-					return p.pError("expected ':' to separate key and value")
+					return 0, nil, nil, p.pError("expected ':' to separate key and value")
 				}
 				p.i++
 				// Stash k, and enter value state
@@ -780,31 +873,26 @@ scan:
 					copy(buf, k)
 					k = buf
 				}
+				if p.dups != AllowDuplicates {
+					if err := p.checkKey(k); err != nil {
+						return 0, nil, nil, err
+					}
+				}
 				p.keystack = append(p.keystack, k)
 				p.s = sValue
 			}
-		case sClientCancelledParse:
-			return ClientCancelledParse
-		case sClientSkippingObject:
-			if err = p.skipObject(); err != nil {
-				return err
-			}
-		case sClientSkippingArray:
-			if err = p.skipArray(); err != nil {
-				return err
-			}
 		default:
-			return p.pError(fmt.Sprintf("hit unimplemented state: %v", p.s))
+			return 0, nil, nil, p.pError(fmt.Sprintf("hit unimplemented state: %v", p.s))
 		}
 	}
 	p.skipSpace()
 	if !p.end() {
-		return p.pError("trailing garbage")
+		return 0, nil, nil, p.pError("trailing garbage")
 	}
 	// is the parse complete?
 	if len(p.states) > 0 {
-		return p.pError("premature EOF")
+		return 0, nil, nil, p.pError("premature EOF")
 	}
 
-	return nil
+	return 0, nil, nil, io.EOF
 }
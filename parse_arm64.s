@@ -0,0 +1,278 @@
+// NEON versions of the scanning routines in parse_asm.s.
+//
+// Each routine compares 16 bytes at a time against its stop characters,
+// which gives a vector of 0x00 or 0xff bytes.  Shifting it right by 4 and
+// narrowing (SHRN) packs it into 64 bits, 4 per byte, so the index of the
+// first stop character is the number of trailing zeros divided by 4.
+//
+// Nor do these read outside of s: once fewer than 16 bytes remain, the last
+// 16 bytes of s are compared instead and the bits of the bytes already
+// scanned are shifted out.  Only slices shorter than 16 bytes are scanned a
+// byte at a time.
+
+#include "textflag.h"
+
+// SCAN_SETUP loads the arguments: R3 holds the start of s, R0 the next byte
+// to scan, R1 the number of bytes left and R5 where the scan started.
+#define SCAN_SETUP \
+	MOVD s_base+0(FP), R3; \
+	MOVD s_len+8(FP), R1; \
+	MOVD offset+24(FP), R2; \
+	ADD R2, R3, R0; \
+	SUB R2, R1, R1; \
+	MOVD R0, R5
+
+// MASK packs the comparison results in V4 into R6.
+#define MASK \
+	VSHRN $4, V4.H8, V4.B8; \
+	VMOV V4.D[0], R6
+
+// The stop characters of scanNumberChars are those outside '0'...'9': V4
+// gets 0xff for each byte of V0 which, less '0', is above 9.
+#define NUMBER_STOPS \
+	VSUB V1.B16, V0.B16, V3.B16; \
+	VCMHI V2.B16, V3.B16, V4.B16
+
+// The stop characters of scanNonSpecialStringChars are '"', '\\' and the
+// control characters below 0x20.
+#define STRING_STOPS \
+	VCMEQ V1.B16, V0.B16, V4.B16; \
+	VCMEQ V2.B16, V0.B16, V5.B16; \
+	VCMHI V0.B16, V3.B16, V6.B16; \
+	VORR V5.B16, V4.B16, V4.B16; \
+	VORR V6.B16, V4.B16, V4.B16
+
+// The stop characters of scanBraces and scanBrackets are the characters in
+// V1 and V2, and '"' in V3.
+#define PAIR_STOPS \
+	VCMEQ V1.B16, V0.B16, V4.B16; \
+	VCMEQ V2.B16, V0.B16, V5.B16; \
+	VCMEQ V3.B16, V0.B16, V6.B16; \
+	VORR V5.B16, V4.B16, V4.B16; \
+	VORR V6.B16, V4.B16, V4.B16
+
+TEXT ·scanNumberCharsNEON(SB),NOSPLIT,$0-40
+	SCAN_SETUP
+	VMOVI $0x30, V1.B16
+	VMOVI $9, V2.B16
+
+numberLoop:
+	CMP $16, R1
+	BLT numberTail
+	VLD1 (R0), [V0.B16]
+	NUMBER_STOPS
+	MASK
+	CBNZ R6, numberFound
+	ADD $16, R0
+	SUB $16, R1
+	B numberLoop
+
+numberTail:
+	CBZ R1, numberEnd
+	// compare the last 16 bytes of s, if it has that many
+	ADD R1, R0, R7
+	SUB $16, R7
+	CMP R3, R7
+	BLO numberBytes
+	VLD1 (R7), [V0.B16]
+	NUMBER_STOPS
+	MASK
+	// drop the bits of the 16-R1 bytes before R0
+	MOVD $16, R8
+	SUB R1, R8
+	LSL $2, R8
+	LSR R8, R6
+	CBNZ R6, numberFound
+	ADD R1, R0
+	B numberEnd
+
+numberBytes:
+	MOVBU (R0), R6
+	SUB $0x30, R6
+	CMP $9, R6
+	BHI numberEnd
+	ADD $1, R0
+	SUB $1, R1
+	CBNZ R1, numberBytes
+	B numberEnd
+
+numberFound:
+	RBIT R6, R6
+	CLZ R6, R6
+	ADD R6>>2, R0
+
+numberEnd:
+	SUB R5, R0
+	MOVD R0, ret+32(FP)
+	RET
+
+TEXT ·scanNonSpecialStringCharsNEON(SB),NOSPLIT,$0-40
+	SCAN_SETUP
+	VMOVI $0x22, V1.B16
+	VMOVI $0x5c, V2.B16
+	VMOVI $0x20, V3.B16
+
+stringLoop:
+	CMP $16, R1
+	BLT stringTail
+	VLD1 (R0), [V0.B16]
+	STRING_STOPS
+	MASK
+	CBNZ R6, stringFound
+	ADD $16, R0
+	SUB $16, R1
+	B stringLoop
+
+stringTail:
+	CBZ R1, stringEnd
+	ADD R1, R0, R7
+	SUB $16, R7
+	CMP R3, R7
+	BLO stringBytes
+	VLD1 (R7), [V0.B16]
+	STRING_STOPS
+	MASK
+	MOVD $16, R8
+	SUB R1, R8
+	LSL $2, R8
+	LSR R8, R6
+	CBNZ R6, stringFound
+	ADD R1, R0
+	B stringEnd
+
+stringBytes:
+	MOVBU (R0), R6
+	CMP $0x22, R6
+	BEQ stringEnd
+	CMP $0x5c, R6
+	BEQ stringEnd
+	CMP $0x20, R6
+	BLO stringEnd
+	ADD $1, R0
+	SUB $1, R1
+	CBNZ R1, stringBytes
+	B stringEnd
+
+stringFound:
+	RBIT R6, R6
+	CLZ R6, R6
+	ADD R6>>2, R0
+
+stringEnd:
+	SUB R5, R0
+	MOVD R0, ret+32(FP)
+	RET
+
+TEXT ·scanBracesNEON(SB),NOSPLIT,$0-40
+	SCAN_SETUP
+	VMOVI $0x7b, V1.B16 // '{'
+	VMOVI $0x7d, V2.B16 // '}'
+	VMOVI $0x22, V3.B16
+
+bracesLoop:
+	CMP $16, R1
+	BLT bracesTail
+	VLD1 (R0), [V0.B16]
+	PAIR_STOPS
+	MASK
+	CBNZ R6, bracesFound
+	ADD $16, R0
+	SUB $16, R1
+	B bracesLoop
+
+bracesTail:
+	CBZ R1, bracesEnd
+	ADD R1, R0, R7
+	SUB $16, R7
+	CMP R3, R7
+	BLO bracesBytes
+	VLD1 (R7), [V0.B16]
+	PAIR_STOPS
+	MASK
+	MOVD $16, R8
+	SUB R1, R8
+	LSL $2, R8
+	LSR R8, R6
+	CBNZ R6, bracesFound
+	ADD R1, R0
+	B bracesEnd
+
+bracesBytes:
+	MOVBU (R0), R6
+	CMP $0x7b, R6
+	BEQ bracesEnd
+	CMP $0x7d, R6
+	BEQ bracesEnd
+	CMP $0x22, R6
+	BEQ bracesEnd
+	ADD $1, R0
+	SUB $1, R1
+	CBNZ R1, bracesBytes
+	B bracesEnd
+
+bracesFound:
+	RBIT R6, R6
+	CLZ R6, R6
+	ADD R6>>2, R0
+
+bracesEnd:
+	SUB R5, R0
+	MOVD R0, ret+32(FP)
+	RET
+
+TEXT ·scanBracketsNEON(SB),NOSPLIT,$0-40
+	SCAN_SETUP
+	VMOVI $0x5b, V1.B16 // '['
+	VMOVI $0x5d, V2.B16 // ']'
+	VMOVI $0x22, V3.B16
+
+bracketsLoop:
+	CMP $16, R1
+	BLT bracketsTail
+	VLD1 (R0), [V0.B16]
+	PAIR_STOPS
+	MASK
+	CBNZ R6, bracketsFound
+	ADD $16, R0
+	SUB $16, R1
+	B bracketsLoop
+
+bracketsTail:
+	CBZ R1, bracketsEnd
+	ADD R1, R0, R7
+	SUB $16, R7
+	CMP R3, R7
+	BLO bracketsBytes
+	VLD1 (R7), [V0.B16]
+	PAIR_STOPS
+	MASK
+	MOVD $16, R8
+	SUB R1, R8
+	LSL $2, R8
+	LSR R8, R6
+	CBNZ R6, bracketsFound
+	ADD R1, R0
+	B bracketsEnd
+
+bracketsBytes:
+	MOVBU (R0), R6
+	CMP $0x5b, R6
+	BEQ bracketsEnd
+	CMP $0x5d, R6
+	BEQ bracketsEnd
+	CMP $0x22, R6
+	BEQ bracketsEnd
+	ADD $1, R0
+	SUB $1, R1
+	CBNZ R1, bracketsBytes
+	B bracketsEnd
+
+bracketsFound:
+	RBIT R6, R6
+	CLZ R6, R6
+	ADD R6>>2, R0
+
+bracketsEnd:
+	SUB R5, R0
+	MOVD R0, ret+32(FP)
+	RET
@@ -1,202 +1,99 @@
 // +build amd64
 
-// fast scanning in assembly is designed around the SSE4v2 PCMPISTRI instruction,
+// fast scanning in assembly is designed around the SSE4v2 PCMPESTRI instruction,
 // which (in one of its operational modes) takes an up to 16 byte vector of bytes.
 // Each pair comprises a value range.  scanning proceeds until it finds a byte
 // inside this value range.
-
-// FIXME: Detect presence of SSE4.
-TEXT ·hasAsm(SB),$0-1
-    MOVQ $1, AX
-    CPUID
-    SHRQ $23, CX
-    ANDQ $1, CX
-    MOVB CX, ret+0(FP)
-RET
-
-TEXT ·scanNumberCharsASM(SB),4,$0-40
-    // load range 0-9
-    MOVQ $0x000000FF3a2F01, BX
-    MOVQ BX, X0
-    MOVQ $4, AX
-
-    // first argument is the byte array we're scanning
-    MOVQ s+0(FP), SI
-    // second argument is the offset into the array
-    MOVQ offset+24(FP), BX
-    ADDQ BX, SI
-
-    // now load the string length into DX, we'll use this
-    // both as an argument to PCMPESTRI and as loop control
-    MOVQ s_len+8(FP), DX
-    SUBQ BX, DX
-
-    // AX holds $4 - byte len of our range (argument to PCMPESTRI)
-    // X0 holds numeric byte ranges that should cause us to halt scanning
-    // DX holds the number of bytes remaining (argument to PCMPESTRI)
-    // SI holds the memory address of slice + offset
-    // BX holds the number of bytes processed
-
-    MOVQ $0, BX
-    TESTQ DX,DX
-    JZ scanNumberCharsEnd
-scanNumberCharsLoop:
-    PCMPESTRI $0x04, 0(SI), X0
-    JC scanNumberCharsFound
-    CMPQ DX, $16
-    JLE scanNumberCharsEnd
-    ADDQ $16, SI
-    ADDQ $16, BX
-    SUBQ $16, DX
-    JMP scanNumberCharsLoop
-
-scanNumberCharsEnd:
-    ADDQ DX, BX
-    MOVQ BX, ret+32(FP)
-    RET
-
-scanNumberCharsFound:
-    ADDQ CX, BX
-    MOVQ BX, ret+32(FP)
-    RET
-
-TEXT ·scanNonSpecialStringCharsASM(SB),4,$0-40
-    // load range (control, '"', and '\')
-    MOVQ $0x5c5c22221f01, BX
-    MOVQ BX, X0
-    MOVQ $6, AX
-
-    // first argument is the byte array we're scanning
-    MOVQ s+0(FP), SI
-    // second argument is the offset into the array
-    MOVQ offset+24(FP), BX
-    ADDQ BX, SI
-
-    // now load the string length into DX, we'll use this
-    // both as an argument to PCMPESTRI and as loop control
-    MOVQ s_len+8(FP), DX
-    SUBQ BX, DX
-
-    // AX holds $6 - len of our range (argument to PCMPESTRI)
-    // X0 holds numeric byte ranges that should cause us to halt scanning
-    // DX holds the number of bytes remaining (argument to PCMPESTRI)
-    // SI holds the memory address of slice + offset
-    // BX holds the number of bytes processed
-
-    MOVQ $0, BX
-    TESTQ DX,DX
-    JZ scanNonSpecialStringCharsEnd
-scanNonSpecialStringCharsLoop:
-    PCMPESTRI $0x04, 0(SI), X0
-    JC scanNonSpecialStringCharsFound
-    CMPQ DX, $16
-    JLE scanNonSpecialStringCharsEnd
-    ADDQ $16, SI
-    ADDQ $16, BX
-    SUBQ $16, DX
-    JMP scanNonSpecialStringCharsLoop
-
-scanNonSpecialStringCharsEnd:
-    ADDQ DX, BX
-    MOVQ BX, ret+32(FP)
-    RET
-
-scanNonSpecialStringCharsFound:
-    ADDQ CX, BX
-    MOVQ BX, ret+32(FP)
+//
+// PCMPESTRI always loads 16 bytes, however few it is told to compare, so it
+// is only used while 16 bytes or more remain.  The last bytes are loaded 16
+// at a time from aligned addresses, which can't cross into the next page and
+// so can't fault, and compared with PCMPESTRM, whose bit mask lets the bytes
+// outside of s be left out.
+
+// SCAN_SSE42 is the body of each scanning routine, given the byte ranges
+// which stop it and their length in bytes, and a prefix for its labels.
+//
+// AX holds the length of the ranges (argument to PCMPESTRI and PCMPESTRM)
+// X1 holds the byte ranges that should cause us to halt scanning
+// DX holds the number of bytes remaining (argument to PCMPESTRI)
+// SI holds the memory address of slice + offset
+// BX holds the number of bytes processed
+#define SCAN_SSE42(ranges, rangesLen, loop, tail, tailMask, tailEnd, found, end) \
+    MOVQ $ranges, BX; \
+    MOVQ BX, X1; \
+    MOVQ $rangesLen, AX; \
+    MOVQ s_base+0(FP), SI; \
+    MOVQ offset+24(FP), BX; \
+    ADDQ BX, SI; \
+    MOVQ s_len+8(FP), DX; \
+    SUBQ BX, DX; \
+    MOVQ $0, BX; \
+loop: \
+    CMPQ DX, $16; \
+    JB tail; \
+    PCMPESTRI $0x04, 0(SI), X1; \
+    JC found; \
+    ADDQ $16, SI; \
+    ADDQ $16, BX; \
+    SUBQ $16, DX; \
+    JMP loop; \
+tail: \
+    /* R9 is the aligned block holding SI, R10 the bytes of it before SI */ \
+    TESTQ DX, DX; \
+    JZ end; \
+    MOVQ DX, R11; \
+    MOVQ SI, R9; \
+    ANDQ $-16, R9; \
+    MOVQ SI, R10; \
+    SUBQ R9, R10; \
+    MOVQ $16, DX; \
+    PCMPESTRM $0x04, 0(R9), X1; \
+    MOVQ X0, R12; \
+    /* the remaining bytes may spill over into the next block */ \
+    LEAQ (R10)(R11*1), CX; \
+    CMPQ CX, $16; \
+    JBE tailMask; \
+    PCMPESTRM $0x04, 16(R9), X1; \
+    MOVQ X0, R13; \
+    SHLQ $16, R13; \
+    ORQ R13, R12; \
+tailMask: \
+    /* keep the bits of the R11 bytes from SI */ \
+    MOVQ R10, CX; \
+    SHRQ CX, R12; \
+    MOVQ $1, R13; \
+    MOVQ R11, CX; \
+    SHLQ CX, R13; \
+    DECQ R13; \
+    ANDQ R13, R12; \
+    JZ tailEnd; \
+    BSFQ R12, CX; \
+    ADDQ CX, BX; \
+    MOVQ BX, ret+32(FP); \
+    RET; \
+tailEnd: \
+    ADDQ R11, BX; \
+end: \
+    MOVQ BX, ret+32(FP); \
+    RET; \
+found: \
+    ADDQ CX, BX; \
+    MOVQ BX, ret+32(FP); \
     RET
 
-TEXT ·scanBraces(SB),4,$0-40
-    // load range ('{','}','"')  // we could do single byte instead
-    MOVQ $0x7b7b7d7d2222, BX
-    MOVQ BX, X0
-    MOVQ $6, AX
+TEXT ·scanNumberCharsSSE42(SB),4,$0-40
+    // range 0-9, as the complement of 0x00-'/' and ':'-0xff
+    SCAN_SSE42(0x000000FF3a2F00, 4, numberLoop, numberTail, numberTailMask, numberTailEnd, numberFound, numberEnd)
 
-    // first argument is the byte array we're scanning
-    MOVQ s+0(FP), SI
-    // second argument is the offset into the array
-    MOVQ offset+24(FP), BX
-    ADDQ BX, SI
+TEXT ·scanNonSpecialStringCharsSSE42(SB),4,$0-40
+    // range (control, '"', and '\')
+    SCAN_SSE42(0x5c5c22221f00, 6, stringLoop, stringTail, stringTailMask, stringTailEnd, stringFound, stringEnd)
 
-    // now load the string length into DX, we'll use this
-    // both as an argument to PCMPESTRI and as loop control
-    MOVQ s_len+8(FP), DX
-    SUBQ BX, DX
+TEXT ·scanBracesSSE42(SB),4,$0-40
+    // range ('{','}','"')  // we could do single byte instead
+    SCAN_SSE42(0x7b7b7d7d2222, 6, bracesLoop, bracesTail, bracesTailMask, bracesTailEnd, bracesFound, bracesEnd)
 
-    // AX holds $6 - len of our range (argument to PCMPESTRI)
-    // X0 holds numeric byte ranges that should cause us to halt scanning
-    // DX holds the number of bytes remaining (argument to PCMPESTRI)
-    // SI holds the memory address of slice + offset
-    // BX holds the number of bytes processed
-
-    MOVQ $0, BX
-    TESTQ DX,DX
-    JZ scanBracesEnd
-scanBracesLoop:
-    PCMPESTRI $0x04, 0(SI), X0
-    JC scanBracesFound
-    CMPQ DX, $16
-    JLE scanBracesEnd
-    ADDQ $16, SI
-    ADDQ $16, BX
-    SUBQ $16, DX
-    JMP scanBracesLoop
-
-scanBracesEnd:
-    ADDQ DX, BX
-    MOVQ BX, ret+32(FP)
-    RET
-
-scanBracesFound:
-    ADDQ CX, BX
-    MOVQ BX, ret+32(FP)
-    RET
-
-
-
-
-TEXT ·scanBrackets(SB),4,$0-40
-    // load range ('[',']','"')  // we could do single byte instead
-    MOVQ $0x5b5b5d5d2222, BX
-    MOVQ BX, X0
-    MOVQ $6, AX
-
-    // first argument is the byte array we're scanning
-    MOVQ s+0(FP), SI
-    // second argument is the offset into the array
-    MOVQ offset+24(FP), BX
-    ADDQ BX, SI
-
-    // now load the string length into DX, we'll use this
-    // both as an argument to PCMPESTRI and as loop control
-    MOVQ s_len+8(FP), DX
-    SUBQ BX, DX
-
-    // AX holds $6 - len of our range (argument to PCMPESTRI)
-    // X0 holds numeric byte ranges that should cause us to halt scanning
-    // DX holds the number of bytes remaining (argument to PCMPESTRI)
-    // SI holds the memory address of slice + offset
-    // BX holds the number of bytes processed
-
-    MOVQ $0, BX
-    TESTQ DX,DX
-    JZ scanBracketsEnd
-scanBracketsLoop:
-    PCMPESTRI $0x04, 0(SI), X0
-    JC scanBracketsFound
-    CMPQ DX, $16
-    JLE scanBracketsEnd
-    ADDQ $16, SI
-    ADDQ $16, BX
-    SUBQ $16, DX
-    JMP scanBracketsLoop
-
-scanBracketsEnd:
-    ADDQ DX, BX
-    MOVQ BX, ret+32(FP)
-    RET
-
-scanBracketsFound:
-    ADDQ CX, BX
-    MOVQ BX, ret+32(FP)
-    RET
+TEXT ·scanBracketsSSE42(SB),4,$0-40
+    // range ('[',']','"')  // we could do single byte instead
+    SCAN_SSE42(0x5b5b5d5d2222, 6, bracketsLoop, bracketsTail, bracketsTailMask, bracketsTailEnd, bracketsFound, bracketsEnd)
@@ -1,7 +1,9 @@
-// +build !amd64
+//go:build !amd64 && !arm64
+// +build !amd64,!arm64
 
 package goj
 
-func hasAsm() bool {
-	return false
+// Without assembly the scanning routines are the Go loops in parse.go.
+func supportedKernels() []kernel {
+	return []kernel{goKernel}
 }
@@ -0,0 +1,107 @@
+package goj
+
+// Filter inspects an entity on its way through a Reencoder.  It returns the
+// entity to write in its place, which may have another key (to rename an
+// object member) or another type and value, along with an action: Continue
+// writes it, Skip drops it, with all of its contents if it is an object or
+// array, and Cancel stops the parse.
+//
+// Keys returned for members of objects must not be nil.  The type of an
+// Object or Array can not be changed, and ObjectEnd and ArrayEnd are always
+// written whatever the filter returns for them.
+type Filter func(t Type, key []byte, value []byte) (Type, []byte, []byte, Action)
+
+// Reencoder turns the entities of a parse back into JSON text.  Its Callback
+// method is passed to Parse, and writes every entity it receives to a
+// Writer, optionally through a Filter:
+//
+//	w := goj.NewWriter(os.Stdout)
+//	r := goj.NewReencoder(w, func(t goj.Type, k, v []byte) (goj.Type, []byte, []byte, goj.Action) {
+//		if string(k) == "password" {
+//			return t, k, v, goj.Skip
+//		}
+//		return t, k, v, goj.Continue
+//	})
+//	err := parser.Parse(buf, r.Callback)
+//
+// Strings are re-escaped and numbers written as they appeared, so without a
+// filter the output is the input with insignificant whitespace removed.
+type Reencoder struct {
+	w      *Writer
+	filter Filter
+}
+
+// NewReencoder returns a Reencoder which writes to w.  filter may be nil.
+func NewReencoder(w *Writer, filter Filter) *Reencoder {
+	return &Reencoder{w: w, filter: filter}
+}
+
+// Reencode parses the JSON document in buf and writes it to w through
+// filter, which may be nil.  It does not flush w.
+func Reencode(buf []byte, w *Writer, filter Filter) error {
+	err := NewParser().Parse(buf, NewReencoder(w, filter).Callback)
+	if err == ClientCancelledParse && w.err != nil {
+		err = w.err
+	}
+	return err
+}
+
+// Depth returns the number of objects and arrays enclosing the entity being
+// filtered.  Containers which were dropped are not counted, as their
+// contents never reach the filter.
+func (r *Reencoder) Depth() int {
+	return len(r.w.stack)
+}
+
+// Callback writes an entity, and has the signature of a Callback.  If the
+// Writer fails, it cancels the parse.
+func (r *Reencoder) Callback(t Type, k []byte, v []byte) Action {
+	if t == SkippedData {
+		return Continue
+	}
+	if r.filter != nil {
+		nt, nk, nv, a := r.filter(t, k, v)
+		switch t {
+		case ArrayEnd, ObjectEnd:
+			if a == Cancel {
+				return Cancel
+			}
+		default:
+			if a != Continue {
+				return a
+			}
+			if t != Object && t != Array {
+				t = nt
+			}
+			k, v = nk, nv
+		}
+	}
+	w := r.w
+	if k != nil {
+		w.KeyBytes(k)
+	}
+	switch t.Base() {
+	case String:
+		w.StringBytes(v)
+	case Integer, NegInteger, Float:
+		w.Number(v)
+	case True:
+		w.Bool(true)
+	case False:
+		w.Bool(false)
+	case Null:
+		w.Null()
+	case Array:
+		w.BeginArray()
+	case ArrayEnd:
+		w.EndArray()
+	case Object:
+		w.BeginObject()
+	case ObjectEnd:
+		w.EndObject()
+	}
+	if w.err != nil {
+		return Cancel
+	}
+	return Continue
+}
@@ -0,0 +1,489 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lloyd/goj"
+)
+
+// Shape is what was observed of the values at one place in a set of sample
+// documents: the root, a member of the objects at a place or the elements of
+// the arrays at one.
+type Shape struct {
+	// Count is the number of values seen.
+	Count int64
+	// Types counts the values of each type, indexed by goj.Type, so that
+	// Types[goj.Integer] is the number of non-negative integers.  The
+	// entries for ArrayEnd and ObjectEnd stay zero.
+	Types [goj.SkippedData]int64
+	// Big counts the numbers which had the goj.Big flag, and the integers
+	// which fit in neither an int64 nor a uint64, which the flag marks only
+	// when the parser is in big number mode.
+	Big int64
+	// Unsigned counts the integers above math.MaxInt64 which fit in a
+	// uint64.
+	Unsigned int64
+
+	// Min and Max bound the numbers.
+	Min, Max float64
+	// MinLength and MaxLength bound the lengths of the strings, in
+	// characters, and TotalLength is their sum.
+	MinLength, MaxLength int
+	TotalLength          int64
+	// MinItems and MaxItems bound the lengths of the arrays, and TotalItems
+	// is their sum.
+	MinItems, MaxItems int
+	TotalItems         int64
+
+	// Items is the shape of the elements of the arrays, or nil if they
+	// were all empty.
+	Items *Shape
+	// Properties holds the shapes of the members of the objects, and Keys
+	// their keys in the order they were first seen.
+	Properties map[string]*Shape
+	Keys       []string
+}
+
+// Objects returns the number of objects seen.
+func (s *Shape) Objects() int64 {
+	return s.Types[goj.Object]
+}
+
+// Numbers returns the number of numbers seen.
+func (s *Shape) Numbers() int64 {
+	return s.Types[goj.Integer] + s.Types[goj.NegInteger] + s.Types[goj.Float]
+}
+
+// Strings returns the number of strings seen.
+func (s *Shape) Strings() int64 {
+	return s.Types[goj.String]
+}
+
+// Arrays returns the number of arrays seen.
+func (s *Shape) Arrays() int64 {
+	return s.Types[goj.Array]
+}
+
+// Optional reports whether the member with key k was missing from some of
+// the objects.
+func (s *Shape) Optional(k string) bool {
+	p := s.Properties[k]
+	return p == nil || p.Count < s.Objects()
+}
+
+// Walk calls fn for s and every shape within it, depth first, with their
+// paths.  A path is a JSON pointer, with "*" standing for every element of
+// an array.
+func (s *Shape) Walk(fn func(path string, s *Shape)) {
+	s.walk("", fn)
+}
+
+func (s *Shape) walk(path string, fn func(string, *Shape)) {
+	fn(path, s)
+	for _, k := range s.Keys {
+		s.Properties[k].walk(path+"/"+escapePointer(k), fn)
+	}
+	if s.Items != nil {
+		s.Items.walk(path+"/*", fn)
+	}
+}
+
+func (s *Shape) property(k []byte) *Shape {
+	if p, ok := s.Properties[string(k)]; ok {
+		return p
+	}
+	if s.Properties == nil {
+		s.Properties = make(map[string]*Shape)
+	}
+	p := &Shape{}
+	s.Properties[string(k)] = p
+	s.Keys = append(s.Keys, string(k))
+	return p
+}
+
+func (s *Shape) observe(t goj.Type, val []byte) {
+	big := t.IsBig()
+	if big {
+		s.Big++
+		t = t.Base()
+	}
+	s.Count++
+	s.Types[t]++
+	switch t {
+	case goj.Integer, goj.NegInteger, goj.Float:
+		if !big {
+			s.observeInteger(t, val)
+		}
+		f, _ := strconv.ParseFloat(string(val), 64)
+		if s.Numbers() == 1 || f < s.Min {
+			s.Min = f
+		}
+		if s.Numbers() == 1 || f > s.Max {
+			s.Max = f
+		}
+	case goj.String:
+		n := utf8.RuneCount(val)
+		if s.Strings() == 1 || n < s.MinLength {
+			s.MinLength = n
+		}
+		if s.Strings() == 1 || n > s.MaxLength {
+			s.MaxLength = n
+		}
+		s.TotalLength += int64(n)
+	}
+}
+
+// observeInteger counts the integers which an int64 can't hold, which the
+// parser did not flag as big.
+func (s *Shape) observeInteger(t goj.Type, val []byte) {
+	switch t {
+	case goj.Integer:
+		if n, err := strconv.ParseUint(string(val), 10, 64); err != nil {
+			s.Big++
+		} else if n > math.MaxInt64 {
+			s.Unsigned++
+		}
+	case goj.NegInteger:
+		if _, err := strconv.ParseInt(string(val), 10, 64); err != nil {
+			s.Big++
+		}
+	}
+}
+
+func (s *Shape) endArray(n int) {
+	if s.Arrays() == 1 || n < s.MinItems {
+		s.MinItems = n
+	}
+	if s.Arrays() == 1 || n > s.MaxItems {
+		s.MaxItems = n
+	}
+	s.TotalItems += int64(n)
+}
+
+// Inferrer merges the shapes of sample documents.  Like a Validator's, its
+// Callback method may be passed to Parse or called from another callback,
+// and it sees documents one after another.
+type Inferrer struct {
+	root  Shape
+	stack []inferFrame
+}
+
+// inferFrame is an open object or array.
+type inferFrame struct {
+	s     *Shape
+	array bool
+	n     int // elements seen so far
+}
+
+// NewInferrer returns an Inferrer which has seen no documents.
+func NewInferrer() *Inferrer {
+	return &Inferrer{}
+}
+
+// Callback records an entity, and has the signature of a goj.Callback.  It
+// always returns Continue.
+func (in *Inferrer) Callback(t goj.Type, k []byte, val []byte) goj.Action {
+	switch t.Base() {
+	case goj.SkippedData:
+		return goj.Continue
+	case goj.ObjectEnd, goj.ArrayEnd:
+		f := in.stack[len(in.stack)-1]
+		if f.array {
+			f.s.endArray(f.n)
+		}
+		in.stack = in.stack[:len(in.stack)-1]
+		return goj.Continue
+	}
+
+	s := &in.root
+	if n := len(in.stack); n > 0 {
+		f := &in.stack[n-1]
+		if f.array {
+			if f.s.Items == nil {
+				f.s.Items = &Shape{}
+			}
+			s = f.s.Items
+			f.n++
+		} else {
+			s = f.s.property(k)
+		}
+	}
+	s.observe(t, val)
+	switch t {
+	case goj.Object:
+		in.stack = append(in.stack, inferFrame{s: s})
+	case goj.Array:
+		in.stack = append(in.stack, inferFrame{s: s, array: true})
+	}
+	return goj.Continue
+}
+
+// Shape returns the merged shape of the documents seen so far.  It goes on
+// changing as more are seen.
+func (in *Inferrer) Shape() *Shape {
+	return &in.root
+}
+
+// Infer reads newline separated JSON documents from r with
+// goj.ReadJSONNL, and returns their merged shape.
+func Infer(r io.Reader) (*Shape, error) {
+	in := NewInferrer()
+	err := goj.ReadJSONNL(r, func(t goj.Type, k []byte, val []byte, line int64) bool {
+		in.Callback(t, k, val)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return in.Shape(), nil
+}
+
+// JSONSchema returns an indented JSON Schema (draft 2020-12) which every
+// value seen matches.  It gives the observed types, bounds on numbers and on
+// the lengths of strings and arrays, and requires the members present in
+// every object.
+func (s *Shape) JSONSchema() []byte {
+	w := goj.NewWriter(nil)
+	w.SetIndent("", "  ")
+	w.BeginObject()
+	w.Key("$schema")
+	w.String("https://json-schema.org/draft/2020-12/schema")
+	s.writeSchema(w)
+	w.EndObject()
+	return append(w.Bytes(), '\n')
+}
+
+// writeSchema writes the keywords of the schema for s, into an object the
+// caller opened.
+func (s *Shape) writeSchema(w *goj.Writer) {
+	if names := s.typeNames(); len(names) == 1 {
+		w.Key("type")
+		w.String(names[0])
+	} else if len(names) > 1 {
+		w.Key("type")
+		w.BeginArray()
+		for _, n := range names {
+			w.String(n)
+		}
+		w.EndArray()
+	}
+	if s.Numbers() > 0 {
+		w.Key("minimum")
+		w.Float(s.Min)
+		w.Key("maximum")
+		w.Float(s.Max)
+	}
+	if s.Strings() > 0 {
+		w.Key("minLength")
+		w.Int(int64(s.MinLength))
+		w.Key("maxLength")
+		w.Int(int64(s.MaxLength))
+	}
+	if s.Arrays() > 0 {
+		if s.Items != nil {
+			w.Key("items")
+			w.BeginObject()
+			s.Items.writeSchema(w)
+			w.EndObject()
+		}
+		w.Key("minItems")
+		w.Int(int64(s.MinItems))
+		w.Key("maxItems")
+		w.Int(int64(s.MaxItems))
+	}
+	if len(s.Keys) > 0 {
+		w.Key("properties")
+		w.BeginObject()
+		for _, k := range s.Keys {
+			w.Key(k)
+			w.BeginObject()
+			s.Properties[k].writeSchema(w)
+			w.EndObject()
+		}
+		w.EndObject()
+		var required []string
+		for _, k := range s.Keys {
+			if !s.Optional(k) {
+				required = append(required, k)
+			}
+		}
+		if len(required) > 0 {
+			w.Key("required")
+			w.BeginArray()
+			for _, k := range required {
+				w.String(k)
+			}
+			w.EndArray()
+		}
+	}
+}
+
+// typeNames returns the JSON Schema names of the types seen, in the order
+// typeNames lists them.  Integers are numbers, so "integer" is only given if
+// every number was one.
+func (s *Shape) typeNames() []string {
+	var bits int
+	if s.Types[goj.Null] > 0 {
+		bits |= typeNull
+	}
+	if s.Types[goj.True]+s.Types[goj.False] > 0 {
+		bits |= typeBoolean
+	}
+	if s.Objects() > 0 {
+		bits |= typeObject
+	}
+	if s.Arrays() > 0 {
+		bits |= typeArray
+	}
+	if s.Types[goj.Float] > 0 {
+		bits |= typeNumber
+	} else if s.Numbers() > 0 {
+		bits |= typeInteger
+	}
+	if s.Strings() > 0 {
+		bits |= typeString
+	}
+	var names []string
+	for i, n := range typeNames {
+		if bits&(1<<i) != 0 {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// GoStruct returns the declaration of a Go struct type with the given name
+// which the documents seen can be unmarshaled into.  Nested objects become
+// anonymous structs, members missing from some objects get omitempty, and
+// nullable scalars become pointers.  Values seen with more than one type,
+// and objects and arrays which were always empty, are left as interface{}.
+// Integers which neither an int64 nor a uint64 can hold all of become
+// json.Number, so the caller imports encoding/json if any are seen.  The root must have been an object.
+func (s *Shape) GoStruct(name string) ([]byte, error) {
+	if s.Objects() == 0 || s.Objects() != s.Count {
+		return nil, fmt.Errorf("schema: the documents are not all objects")
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "type %s ", name)
+	s.writeStruct(&buf)
+	buf.WriteString("\n")
+	return format.Source(buf.Bytes())
+}
+
+func (s *Shape) writeStruct(buf *bytes.Buffer) {
+	buf.WriteString("struct {\n")
+	used := make(map[string]bool)
+	for _, k := range s.Keys {
+		if strings.ContainsAny(k, "\"`,") || !utf8.ValidString(k) {
+			fmt.Fprintf(buf, "// %s cannot be named in a struct tag\n", strconv.Quote(k))
+			continue
+		}
+		field := fieldName(k)
+		for i := 2; used[field]; i++ {
+			field = fieldName(k) + strconv.Itoa(i)
+		}
+		used[field] = true
+		tag := k
+		if s.Optional(k) {
+			tag += ",omitempty"
+		}
+		buf.WriteString(field)
+		buf.WriteByte(' ')
+		s.Properties[k].writeType(buf)
+		fmt.Fprintf(buf, " `json:%s`\n", strconv.Quote(tag))
+	}
+	buf.WriteString("}")
+}
+
+// writeType writes the Go type for the values of s.
+func (s *Shape) writeType(buf *bytes.Buffer) {
+	nulls := s.Types[goj.Null]
+	bools := s.Types[goj.True] + s.Types[goj.False]
+	kinds := 0
+	for _, n := range []int64{bools, s.Numbers(), s.Strings(), s.Objects(), s.Arrays()} {
+		if n > 0 {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		buf.WriteString("interface{}")
+		return
+	}
+	switch {
+	case s.Objects() > 0:
+		if len(s.Keys) == 0 {
+			buf.WriteString("map[string]interface{}")
+			return
+		}
+		if nulls > 0 {
+			buf.WriteByte('*')
+		}
+		s.writeStruct(buf)
+	case s.Arrays() > 0:
+		buf.WriteString("[]")
+		if s.Items == nil {
+			buf.WriteString("interface{}")
+		} else {
+			s.Items.writeType(buf)
+		}
+	default:
+		if nulls > 0 {
+			buf.WriteByte('*')
+		}
+		buf.WriteString(s.scalarType())
+	}
+}
+
+func (s *Shape) scalarType() string {
+	switch {
+	case s.Strings() > 0:
+		return "string"
+	case s.Numbers() == 0:
+		return "bool"
+	case s.Types[goj.Float] > 0:
+		return "float64"
+	case s.Big > 0, s.Unsigned > 0 && s.Types[goj.NegInteger] > 0:
+		return "json.Number"
+	case s.Unsigned > 0:
+		return "uint64"
+	}
+	return "int64"
+}
+
+// fieldName turns a key into an exported Go identifier, so "user_id" and
+// "user-id" become UserID.
+func fieldName(k string) string {
+	words := strings.FieldsFunc(k, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, w := range words {
+		if up := strings.ToUpper(w); initialisms[up] {
+			b.WriteString(up)
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(w)
+		b.WriteRune(unicode.ToUpper(r))
+		b.WriteString(w[n:])
+	}
+	name := b.String()
+	if r, _ := utf8.DecodeRuneInString(name); name == "" || !unicode.IsUpper(r) {
+		name = "X" + name
+	}
+	return name
+}
+
+// initialisms are written in capitals, as golint would have them.
+var initialisms = map[string]bool{
+	"API": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true,
+	"IP": true, "JSON": true, "SQL": true, "URI": true, "URL": true,
+	"UUID": true, "XML": true,
+}
@@ -0,0 +1,169 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+const samples = `{"id": 1, "name": "ann", "score": 2.5, "tags": ["a", "bc"], "user_id": -3, "addr": {"zip": "12345"}}
+{"id": 2, "name": "bob", "score": null, "tags": [], "addr": {"zip": "54321", "city": "Paris"}}
+{"id": 18446744073709551615, "name": "", "score": 7, "tags": ["def"], "user_id": 4, "addr": null, "extra": [1, "x"]}
+`
+
+func TestInfer(t *testing.T) {
+	s, err := Infer(strings.NewReader(samples))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	s.Walk(func(path string, s *Shape) {
+		paths = append(paths, fmt.Sprintf("%s %d", path, s.Count))
+	})
+	want := "[ 3 /id 3 /name 3 /score 3 /tags 3 /tags/* 3 /user_id 2 /addr 3 /addr/zip 2 /addr/city 1 /extra 1 /extra/* 2]"
+	if got := fmt.Sprint(paths); got != want {
+		t.Errorf("want %s\ngot  %s", want, got)
+	}
+
+	id := s.Properties["id"]
+	if id.Types[goj.Integer] != 3 || id.Min != 1 || id.Max != 18446744073709551615 {
+		t.Errorf("unexpected id shape %+v", id)
+	}
+	if u := s.Properties["user_id"]; u.Types[goj.NegInteger] != 1 || u.Min != -3 || !s.Optional("user_id") {
+		t.Errorf("unexpected user_id shape %+v", u)
+	}
+	name := s.Properties["name"]
+	if name.MinLength != 0 || name.MaxLength != 3 || name.TotalLength != 6 || s.Optional("name") {
+		t.Errorf("unexpected name shape %+v", name)
+	}
+	tags := s.Properties["tags"]
+	if tags.MinItems != 0 || tags.MaxItems != 2 || tags.TotalItems != 3 || tags.Items.MaxLength != 3 {
+		t.Errorf("unexpected tags shape %+v", tags)
+	}
+
+	// the inferred schema accepts the samples
+	sch, err := Compile(s.JSONSchema())
+	if err != nil {
+		t.Fatalf("%s\n%s", err, s.JSONSchema())
+	}
+	for _, doc := range strings.Split(strings.TrimSpace(samples), "\n") {
+		if err := sch.Validate([]byte(doc)); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := sch.Validate([]byte(`{"id": 1, "name": "ann", "score": 1, "tags": [], "addr": {}}`)); err == nil {
+		t.Error("expected addr/zip to be required")
+	}
+}
+
+func TestInferJSONSchema(t *testing.T) {
+	in := NewInferrer()
+	p := goj.NewParser()
+	for _, doc := range []string{`{"a": [1, 2.5], "b": true}`, `{"a": [], "b": null}`} {
+		if err := p.Parse([]byte(doc), in.Callback); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "properties": {
+    "a": {
+      "type": "array",
+      "items": {
+        "type": "number",
+        "minimum": 1,
+        "maximum": 2.5
+      },
+      "minItems": 0,
+      "maxItems": 2
+    },
+    "b": {
+      "type": [
+        "null",
+        "boolean"
+      ]
+    }
+  },
+  "required": [
+    "a",
+    "b"
+  ]
+}
+`
+	if got := string(in.Shape().JSONSchema()); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestInferGoStruct(t *testing.T) {
+	s, err := Infer(strings.NewReader(samples))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GoStruct("Record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "type Record struct {\n" +
+		"\tID     uint64   `json:\"id\"`\n" +
+		"\tName   string   `json:\"name\"`\n" +
+		"\tScore  *float64 `json:\"score\"`\n" +
+		"\tTags   []string `json:\"tags\"`\n" +
+		"\tUserID int64    `json:\"user_id,omitempty\"`\n" +
+		"\tAddr   *struct {\n" +
+		"\t\tZip  string `json:\"zip\"`\n" +
+		"\t\tCity string `json:\"city,omitempty\"`\n" +
+		"\t} `json:\"addr\"`\n" +
+		"\tExtra []interface{} `json:\"extra,omitempty\"`\n" +
+		"}\n"
+	if string(got) != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	// integers beyond uint64, or both negative and beyond int64
+	s, err = Infer(strings.NewReader(`{"a": 1, "b": -1, "c": 1, "d": 1.5}
+{"a": 123456789012345678901234567890, "b": -9223372036854775809, "c": 9223372036854775808, "d": 1}
+{"a": 2, "b": 9223372036854775808, "c": 18446744073709551615, "d": 123456789012345678901234567890}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.GoStruct("Big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "type Big struct {\n" +
+		"\tA json.Number `json:\"a\"`\n" +
+		"\tB json.Number `json:\"b\"`\n" +
+		"\tC uint64      `json:\"c\"`\n" +
+		"\tD float64     `json:\"d\"`\n" +
+		"}\n"
+	if string(got) != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	if a, b := s.Properties["a"], s.Properties["b"]; a.Big != 1 || b.Big != 1 || b.Unsigned != 1 {
+		t.Errorf("unexpected shapes %+v %+v", a, b)
+	}
+
+	// a parser in big number mode flags them itself, and they are counted once
+	in := NewInferrer()
+	p := goj.NewParser()
+	p.SetBigNumbers(true)
+	if err := p.Parse([]byte(`{"a": 123456789012345678901234567890}`), in.Callback); err != nil {
+		t.Fatal(err)
+	}
+	if a := in.Shape().Properties["a"]; a.Big != 1 || a.Types[goj.Integer] != 1 {
+		t.Errorf("unexpected shape %+v", a)
+	}
+
+	if _, err := Infer(strings.NewReader("{\"a\": 1}\n{\"a\": \n")); err == nil {
+		t.Error("expected a parse error")
+	}
+	s, _ = Infer(strings.NewReader("[1]\n"))
+	if _, err := s.GoStruct("T"); err == nil {
+		t.Error("expected an error for an array")
+	}
+}
@@ -0,0 +1,700 @@
+// Package schema validates JSON documents against JSON Schema (draft
+// 2020-12).  Schemas are compiled once, and documents are then validated in
+// a single pass over the entities goj's parser produces, without building a
+// tree of the document:
+//
+//	s, err := schema.Compile(schemaJSON)
+//	...
+//	if err := s.Validate(doc); err != nil {
+//		for _, e := range err.(*schema.ValidationError).Errors {
+//			fmt.Println(e.InstanceLocation, e.Message)
+//		}
+//	}
+//
+// The core, applicator and validation vocabularies are supported.  "format"
+// is treated as an annotation and not checked, patterns are Go regular
+// expressions (RE2) rather than ECMA 262 ones, and $dynamicRef is resolved
+// like $ref.  Schemas using unevaluatedProperties or unevaluatedItems are
+// rejected, as those need the annotations of every other keyword.
+package schema
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lloyd/goj"
+	"github.com/lloyd/goj/value"
+)
+
+// Type bits for the "type" keyword.
+const (
+	typeNull = 1 << iota
+	typeBoolean
+	typeObject
+	typeArray
+	typeNumber
+	typeString
+	typeInteger
+)
+
+var typeNames = []string{"null", "boolean", "object", "array", "number", "string", "integer"}
+
+// applies says how a schema applied to the same value as its parent
+// contributes to the parent's result.
+type applies uint8
+
+const (
+	byRef applies = iota
+	byAllOf
+	byAnyOf
+	byOneOf
+	byNot
+	byIf
+	byThen
+	byElse
+	byDependentSchema
+)
+
+// inPlace is a subschema which applies to the same value as its parent.
+type inPlace struct {
+	n    *node
+	by   applies
+	name string // for dependentSchemas, the property it depends on
+}
+
+type patternNode struct {
+	re *regexp.Regexp
+	n  *node
+}
+
+type dependency struct {
+	name     string
+	required []string
+}
+
+// node is a compiled schema.  Keywords which are absent have their zero
+// value, or -1 for counts.
+type node struct {
+	loc string // the location of the schema, as a URI with a JSON Pointer fragment
+
+	isBool  bool // a boolean schema, which allows everything or nothing
+	boolVal bool
+
+	types    int
+	enum     []string // canonical forms
+	hasConst bool
+	constVal string // canonical form
+
+	minimum, maximum, exclusiveMinimum, exclusiveMaximum float64
+	hasMin, hasMax, hasExclusiveMin, hasExclusiveMax     bool
+	multipleOf                                           *big.Rat
+
+	minLength, maxLength int
+	pattern              *regexp.Regexp
+
+	prefixItems              []*node
+	items                    *node
+	contains                 *node
+	minContains, maxContains int
+	minItems, maxItems       int
+	uniqueItems              bool
+
+	properties           map[string]*node
+	patternProperties    []patternNode
+	additionalProperties *node
+	propertyNames        *node
+	required             []string
+	dependentRequired    []dependency
+	minProperties        int
+	maxProperties        int
+	watch                map[string]int // property names whose presence matters
+
+	inPlace []inPlace
+}
+
+// Schema is a compiled schema.  It is safe for concurrent use.
+type Schema struct {
+	root       *node
+	validators sync.Pool
+}
+
+// Compile compiles the schema in buf.  References to other documents must
+// be made available with a Compiler instead.
+func Compile(buf []byte) (*Schema, error) {
+	c := NewCompiler()
+	if err := c.AddResource("", buf); err != nil {
+		return nil, err
+	}
+	return c.Compile("")
+}
+
+// MustCompile is like Compile but panics if the schema cannot be compiled.
+func MustCompile(buf []byte) *Schema {
+	s, err := Compile(buf)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// location is a schema found in a document, along with the base URI and
+// JSON Pointer it is found under.  Those are as seen from outside of the
+// schema, that is, before any $id of its own is applied.
+type location struct {
+	v    interface{}
+	base string
+	ptr  string
+}
+
+// Compiler compiles schemas which may refer to each other.  Each document
+// is added with AddResource under the URI it is known by, and then any of
+// them compiled.
+type Compiler struct {
+	resources map[string]location // by absolute URI, without fragment
+	anchors   map[string]location // by URI with the anchor as fragment
+	nodes     map[string]*node    // by location
+}
+
+// NewCompiler returns a Compiler with no resources.
+func NewCompiler() *Compiler {
+	return &Compiler{
+		resources: make(map[string]location),
+		anchors:   make(map[string]location),
+		nodes:     make(map[string]*node),
+	}
+}
+
+// AddResource adds the schema document in buf, which is known by the given
+// URI.  Schemas within it which declare an $id are known by that as well.
+func (c *Compiler) AddResource(uri string, buf []byte) error {
+	d := value.NewDecoder()
+	d.SetNumberMode(value.UseNumber)
+	v, err := d.Decode(buf)
+	if err != nil {
+		return err
+	}
+	base, err := resolve("", uri)
+	if err != nil {
+		return err
+	}
+	c.resources[base] = location{v, base, ""}
+	return c.index(v, base, "")
+}
+
+// index registers the resources and anchors declared by the schema v and
+// its subschemas.
+func (c *Compiler) index(v interface{}, base, ptr string) error {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	l := location{v, base, ptr}
+	if id, ok := m["$id"].(string); ok {
+		var err error
+		if base, err = resolve(base, id); err != nil {
+			return err
+		}
+		ptr = ""
+		c.resources[base] = l
+	}
+	for _, kw := range []string{"$anchor", "$dynamicAnchor"} {
+		if a, ok := m[kw].(string); ok {
+			c.anchors[base+"#"+a] = l
+		}
+	}
+	for kw, sub := range m {
+		switch kw {
+		case "additionalProperties", "propertyNames", "items", "contains", "not", "if", "then", "else",
+			"unevaluatedItems", "unevaluatedProperties", "contentSchema":
+			if err := c.index(sub, base, ptr+"/"+kw); err != nil {
+				return err
+			}
+		case "properties", "patternProperties", "$defs", "definitions", "dependentSchemas":
+			if subs, ok := sub.(map[string]interface{}); ok {
+				for k, s := range subs {
+					if err := c.index(s, base, ptr+"/"+kw+"/"+escapePointer(k)); err != nil {
+						return err
+					}
+				}
+			}
+		case "allOf", "anyOf", "oneOf", "prefixItems":
+			if subs, ok := sub.([]interface{}); ok {
+				for i, s := range subs {
+					if err := c.index(s, base, ptr+"/"+kw+"/"+strconv.Itoa(i)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Compile compiles the schema known by uri, which may have a fragment.
+func (c *Compiler) Compile(uri string) (*Schema, error) {
+	n, err := c.resolveRef("", uri)
+	if err != nil {
+		return nil, err
+	}
+	visits := make(map[*node]int)
+	for _, n := range c.nodes {
+		if err := checkCycles(n, visits); err != nil {
+			return nil, err
+		}
+	}
+	return &Schema{root: n}, nil
+}
+
+// resolve resolves ref against base, and drops any empty fragment.
+func resolve(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	u := b.ResolveReference(r)
+	if u.Fragment == "" {
+		u.RawFragment = ""
+		return strings.TrimSuffix(u.String(), "#"), nil
+	}
+	return u.String(), nil
+}
+
+// resolveRef returns the node for the schema ref refers to, relative to
+// base.
+func (c *Compiler) resolveRef(base, ref string) (*node, error) {
+	abs, err := resolve(base, ref)
+	if err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(abs)
+	frag := u.Fragment
+	u.Fragment, u.RawFragment = "", ""
+	doc := u.String()
+
+	if frag != "" && frag[0] != '/' {
+		l, ok := c.anchors[doc+"#"+frag]
+		if !ok {
+			return nil, errors.New("schema: cannot resolve " + strconv.Quote(abs))
+		}
+		return c.compile(l.v, l.base, l.ptr)
+	}
+	l, ok := c.resources[doc]
+	if !ok {
+		return nil, errors.New("schema: cannot resolve " + strconv.Quote(abs))
+	}
+	v, base, ptr := l.v, l.base, l.ptr
+	if frag != "" {
+		for _, tok := range strings.Split(frag[1:], "/") {
+			tok = strings.Replace(strings.Replace(tok, "~1", "/", -1), "~0", "~", -1)
+			// a schema along the way may start a resource of its own
+			if m, isMap := v.(map[string]interface{}); isMap {
+				if id, hasID := m["$id"].(string); hasID {
+					if base, err = resolve(base, id); err != nil {
+						return nil, err
+					}
+					ptr = ""
+				}
+			}
+			switch x := v.(type) {
+			case map[string]interface{}:
+				v, ok = x[tok]
+			case []interface{}:
+				i, err := strconv.Atoi(tok)
+				ok = err == nil && i >= 0 && i < len(x)
+				if ok {
+					v = x[i]
+				}
+			default:
+				ok = false
+			}
+			if !ok {
+				return nil, errors.New("schema: cannot resolve " + strconv.Quote(abs))
+			}
+			ptr += "/" + escapePointer(tok)
+		}
+	}
+	return c.compile(v, base, ptr)
+}
+
+func escapePointer(s string) string {
+	if strings.ContainsAny(s, "~/") {
+		s = strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+	}
+	return s
+}
+
+// schemaError reports a keyword which is not valid in a schema.
+func schemaError(loc, kw, msg string) error {
+	return errors.New("schema: " + loc + "/" + kw + ": " + msg)
+}
+
+// compile compiles the schema v, found at the JSON Pointer ptr from base.
+func (c *Compiler) compile(v interface{}, base, ptr string) (*node, error) {
+	if m, ok := v.(map[string]interface{}); ok {
+		if id, ok := m["$id"].(string); ok {
+			var err error
+			if base, err = resolve(base, id); err != nil {
+				return nil, err
+			}
+			ptr = ""
+		}
+	}
+	loc := base + "#" + ptr
+	if n, ok := c.nodes[loc]; ok {
+		return n, nil
+	}
+	n := &node{loc: loc, minLength: -1, maxLength: -1, minItems: -1, maxItems: -1,
+		minContains: 1, maxContains: -1, minProperties: -1, maxProperties: -1}
+	c.nodes[loc] = n
+
+	switch x := v.(type) {
+	case bool:
+		n.isBool, n.boolVal = true, x
+		return n, nil
+	case map[string]interface{}:
+		return n, c.keywords(n, x, base, ptr)
+	}
+	return nil, errors.New("schema: " + loc + ": a schema must be an object or a boolean")
+}
+
+func (c *Compiler) keywords(n *node, m map[string]interface{}, base, ptr string) error {
+	sub := func(kw string, v interface{}) (*node, error) {
+		return c.compile(v, base, ptr+"/"+kw)
+	}
+	subs := func(kw string) ([]*node, error) {
+		list, ok := m[kw].([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, schemaError(n.loc, kw, "must be a non-empty array of schemas")
+		}
+		var nodes []*node
+		for i, v := range list {
+			s, err := sub(kw+"/"+strconv.Itoa(i), v)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, s)
+		}
+		return nodes, nil
+	}
+	count := func(kw string) (int, error) {
+		num, ok := m[kw].(value.Number)
+		f, err := num.Float64()
+		if !ok || err != nil || f < 0 || f != math.Trunc(f) || f > math.MaxInt32 {
+			return 0, schemaError(n.loc, kw, "must be a non-negative integer")
+		}
+		return int(f), nil
+	}
+	number := func(kw string) (float64, error) {
+		num, ok := m[kw].(value.Number)
+		f, err := num.Float64()
+		if !ok || err != nil {
+			return 0, schemaError(n.loc, kw, "must be a number")
+		}
+		return f, nil
+	}
+	var err error
+
+	for kw, v := range m {
+		switch kw {
+		case "unevaluatedProperties", "unevaluatedItems":
+			return schemaError(n.loc, kw, "is not supported")
+		case "$ref", "$dynamicRef":
+			ref, ok := v.(string)
+			if !ok {
+				return schemaError(n.loc, kw, "must be a string")
+			}
+			r, err := c.resolveRef(base, ref)
+			if err != nil {
+				return err
+			}
+			n.inPlace = append(n.inPlace, inPlace{n: r, by: byRef})
+
+		case "type":
+			names, ok := v.([]interface{})
+			if !ok {
+				names = []interface{}{v}
+			}
+			for _, name := range names {
+				i := 0
+				for i < len(typeNames) && typeNames[i] != name {
+					i++
+				}
+				if i == len(typeNames) {
+					return schemaError(n.loc, kw, "unknown type")
+				}
+				n.types |= 1 << uint(i)
+			}
+		case "enum":
+			list, ok := v.([]interface{})
+			if !ok {
+				return schemaError(n.loc, kw, "must be an array")
+			}
+			n.enum = make([]string, 0, len(list))
+			for _, e := range list {
+				n.enum = append(n.enum, canonicalValue(e))
+			}
+		case "const":
+			n.hasConst, n.constVal = true, canonicalValue(v)
+
+		case "minimum":
+			n.minimum, err = number(kw)
+			n.hasMin = true
+		case "maximum":
+			n.maximum, err = number(kw)
+			n.hasMax = true
+		case "exclusiveMinimum":
+			n.exclusiveMinimum, err = number(kw)
+			n.hasExclusiveMin = true
+		case "exclusiveMaximum":
+			n.exclusiveMaximum, err = number(kw)
+			n.hasExclusiveMax = true
+		case "multipleOf":
+			num, _ := v.(value.Number)
+			if n.multipleOf, err = goj.ParseBigRat([]byte(num)); err != nil || n.multipleOf.Sign() <= 0 {
+				return schemaError(n.loc, kw, "must be a number greater than 0")
+			}
+
+		case "minLength":
+			n.minLength, err = count(kw)
+		case "maxLength":
+			n.maxLength, err = count(kw)
+		case "pattern":
+			s, _ := v.(string)
+			if n.pattern, err = regexp.Compile(s); err != nil {
+				return schemaError(n.loc, kw, err.Error())
+			}
+
+		case "prefixItems":
+			n.prefixItems, err = subs(kw)
+		case "items":
+			n.items, err = sub(kw, v)
+		case "contains":
+			n.contains, err = sub(kw, v)
+		case "minContains":
+			n.minContains, err = count(kw)
+		case "maxContains":
+			n.maxContains, err = count(kw)
+		case "minItems":
+			n.minItems, err = count(kw)
+		case "maxItems":
+			n.maxItems, err = count(kw)
+		case "uniqueItems":
+			n.uniqueItems, _ = v.(bool)
+
+		case "properties":
+			props, ok := v.(map[string]interface{})
+			if !ok {
+				return schemaError(n.loc, kw, "must be an object")
+			}
+			n.properties = make(map[string]*node, len(props))
+			for k, s := range props {
+				if n.properties[k], err = sub(kw+"/"+escapePointer(k), s); err != nil {
+					return err
+				}
+			}
+		case "patternProperties":
+			props, ok := v.(map[string]interface{})
+			if !ok {
+				return schemaError(n.loc, kw, "must be an object")
+			}
+			for k, s := range props {
+				re, err := regexp.Compile(k)
+				if err != nil {
+					return schemaError(n.loc, kw, err.Error())
+				}
+				p, err := sub(kw+"/"+escapePointer(k), s)
+				if err != nil {
+					return err
+				}
+				n.patternProperties = append(n.patternProperties, patternNode{re, p})
+			}
+		case "additionalProperties":
+			n.additionalProperties, err = sub(kw, v)
+		case "propertyNames":
+			n.propertyNames, err = sub(kw, v)
+		case "required":
+			if n.required, err = stringList(v); err != nil {
+				return schemaError(n.loc, kw, err.Error())
+			}
+		case "dependentRequired":
+			deps, ok := v.(map[string]interface{})
+			if !ok {
+				return schemaError(n.loc, kw, "must be an object")
+			}
+			for k, list := range deps {
+				names, err := stringList(list)
+				if err != nil {
+					return schemaError(n.loc, kw, err.Error())
+				}
+				n.dependentRequired = append(n.dependentRequired, dependency{k, names})
+			}
+		case "minProperties":
+			n.minProperties, err = count(kw)
+		case "maxProperties":
+			n.maxProperties, err = count(kw)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// schemas which apply in place, in the order they are combined
+	for _, kw := range []string{"allOf", "anyOf", "oneOf"} {
+		if _, ok := m[kw]; !ok {
+			continue
+		}
+		list, err := subs(kw)
+		if err != nil {
+			return err
+		}
+		by := map[string]applies{"allOf": byAllOf, "anyOf": byAnyOf, "oneOf": byOneOf}[kw]
+		for _, s := range list {
+			n.inPlace = append(n.inPlace, inPlace{n: s, by: by})
+		}
+	}
+	for _, kw := range []string{"not", "if", "then", "else"} {
+		v, ok := m[kw]
+		if !ok {
+			continue
+		}
+		if _, hasIf := m["if"]; !hasIf && kw != "not" {
+			continue
+		}
+		_, hasThen := m["then"]
+		_, hasElse := m["else"]
+		if kw == "if" && !hasThen && !hasElse {
+			continue
+		}
+		s, err := sub(kw, v)
+		if err != nil {
+			return err
+		}
+		by := map[string]applies{"not": byNot, "if": byIf, "then": byThen, "else": byElse}[kw]
+		n.inPlace = append(n.inPlace, inPlace{n: s, by: by})
+	}
+	if deps, ok := m["dependentSchemas"]; ok {
+		props, ok := deps.(map[string]interface{})
+		if !ok {
+			return schemaError(n.loc, "dependentSchemas", "must be an object")
+		}
+		for k, v := range props {
+			s, err := sub("dependentSchemas/"+escapePointer(k), v)
+			if err != nil {
+				return err
+			}
+			n.inPlace = append(n.inPlace, inPlace{n: s, by: byDependentSchema, name: k})
+		}
+	}
+
+	// the properties whose presence is looked for
+	watch := func(name string) {
+		if n.watch == nil {
+			n.watch = make(map[string]int)
+		}
+		if _, ok := n.watch[name]; !ok {
+			n.watch[name] = len(n.watch)
+		}
+	}
+	for _, name := range n.required {
+		watch(name)
+	}
+	for _, d := range n.dependentRequired {
+		watch(d.name)
+		for _, name := range d.required {
+			watch(name)
+		}
+	}
+	for _, ip := range n.inPlace {
+		if ip.by == byDependentSchema {
+			watch(ip.name)
+		}
+	}
+	return nil
+}
+
+func stringList(v interface{}) ([]string, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("must be an array of strings")
+	}
+	names := make([]string, 0, len(list))
+	for _, s := range list {
+		name, ok := s.(string)
+		if !ok {
+			return nil, errors.New("must be an array of strings")
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// checkCycles fails if n can apply itself to a value without going through
+// a subschema for a member or element, which would never terminate.  visits
+// holds 1 for the nodes being checked and 2 for those found to be fine.
+func checkCycles(n *node, visits map[*node]int) error {
+	switch visits[n] {
+	case 1:
+		return errors.New("schema: " + n.loc + ": $ref applies the schema to itself")
+	case 2:
+		return nil
+	}
+	visits[n] = 1
+	for _, ip := range n.inPlace {
+		if err := checkCycles(ip.n, visits); err != nil {
+			return err
+		}
+	}
+	visits[n] = 2
+	return nil
+}
+
+// canonicalValue returns the RFC 8785 form of a value decoded from a schema,
+// which is how values are compared.
+func canonicalValue(v interface{}) string {
+	w := goj.NewWriter(nil)
+	writeValue(w, v)
+	return canonical(w.Bytes())
+}
+
+func canonical(buf []byte) string {
+	if c, err := goj.Canonicalize(buf); err == nil {
+		return string(c)
+	}
+	return string(buf)
+}
+
+func writeValue(w *goj.Writer, v interface{}) {
+	switch x := v.(type) {
+	case nil:
+		w.Null()
+	case bool:
+		w.Bool(x)
+	case string:
+		w.String(x)
+	case value.Number:
+		w.Number([]byte(x))
+	case []interface{}:
+		w.BeginArray()
+		for _, e := range x {
+			writeValue(w, e)
+		}
+		w.EndArray()
+	case map[string]interface{}:
+		w.BeginObject()
+		for k, e := range x {
+			w.Key(k)
+			writeValue(w, e)
+		}
+		w.EndObject()
+	}
+}
@@ -0,0 +1,224 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+type suiteGroup struct {
+	Description string
+	Schema      json.RawMessage
+	Tests       []struct {
+		Data  json.RawMessage
+		Valid bool
+	}
+}
+
+// testdata/keywords.json follows the layout of the JSON Schema Test Suite
+func TestKeywords(t *testing.T) {
+	buf, err := ioutil.ReadFile("testdata/keywords.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var groups []suiteGroup
+	if err := json.Unmarshal(buf, &groups); err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range groups {
+		s, err := Compile(g.Schema)
+		if err != nil {
+			t.Errorf("%s: %v", g.Description, err)
+			continue
+		}
+		for _, c := range g.Tests {
+			err := s.Validate(c.Data)
+			if _, ok := err.(*ValidationError); err != nil && !ok {
+				t.Errorf("%s: %s: unexpected error %v", g.Description, c.Data, err)
+			} else if (err == nil) != c.Valid {
+				t.Errorf("%s: %s: expected valid=%v, got %v", g.Description, c.Data, c.Valid, err)
+			}
+		}
+	}
+}
+
+func TestErrorLocations(t *testing.T) {
+	s := MustCompile([]byte(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "uniqueItems": true},
+			"a/b~c": {"type": "null"}
+		},
+		"required": ["id"],
+		"$defs": {"tag": {"type": "string", "pattern": "^[a-z]+$"}}
+	}`))
+	err := s.Validate([]byte(`{"name": "", "tags": ["ok", "Bad", 3, "ok"], "a/b~c": 1}`))
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	var got []string
+	for _, e := range verr.Errors {
+		got = append(got, e.InstanceLocation+" "+e.SchemaLocation)
+	}
+	want := []string{
+		"/name #/properties/name/minLength",
+		"/tags/1 #/$defs/tag/pattern",
+		"/tags/2 #/$defs/tag/type",
+		"/tags/3 #/properties/tags/uniqueItems",
+		"/a~1b~0c #/properties/a~1b~0c/type",
+		" #/required",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	if msg := verr.Errors[5].Error(); msg != `(root): missing required property "id" (#/required)` {
+		t.Errorf("unexpected message %s", msg)
+	}
+}
+
+// Errors in branches which did not need to match are not reported
+func TestCombinatorErrors(t *testing.T) {
+	s := MustCompile([]byte(`{"anyOf": [{"type": "string"}, {"type": "array", "items": {"type": "integer"}}]}`))
+	if err := s.Validate([]byte(`[1, 2]`)); err != nil {
+		t.Error(err)
+	}
+	err := s.Validate([]byte(`[1, "2"]`))
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Errors) != 1 || verr.Errors[0].SchemaLocation != "#/anyOf" || verr.Errors[0].InstanceLocation != "" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCompiler(t *testing.T) {
+	c := NewCompiler()
+	err := c.AddResource("https://example.com/schemas/address.json", []byte(`{
+		"type": "object",
+		"properties": {"zip": {"$ref": "#/$defs/zip"}},
+		"$defs": {"zip": {"type": "string", "pattern": "^[0-9]{5}$"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.AddResource("https://example.com/schemas/person.json", []byte(`{
+		"properties": {"home": {"$ref": "address.json"}, "zip": {"$ref": "address.json#/$defs/zip"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.Compile("https://example.com/schemas/person.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate([]byte(`{"home": {"zip": "12345"}, "zip": "54321"}`)); err != nil {
+		t.Error(err)
+	}
+	err = s.Validate([]byte(`{"home": {"zip": "1234"}}`))
+	verr, ok := err.(*ValidationError)
+	if !ok || verr.Errors[0].SchemaLocation != "https://example.com/schemas/address.json#/$defs/zip/pattern" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if _, err := c.Compile("https://example.com/schemas/missing.json"); err == nil {
+		t.Error("expected an error for a missing resource")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, doc := range []string{
+		`{"type": "integr"}`,
+		`{"minLength": -1}`,
+		`{"minLength": 1.5}`,
+		`{"pattern": "("}`,
+		`{"multipleOf": 0}`,
+		`{"allOf": []}`,
+		`{"required": [1]}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"$ref": "#"}`,
+		`{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"allOf": [{"$ref": "#/$defs/a"}]}}, "$ref": "#/$defs/a"}`,
+		`{"unevaluatedProperties": false}`,
+		`[]`,
+		`{"a": `,
+	} {
+		if _, err := Compile([]byte(doc)); err == nil {
+			t.Errorf("%s: expected an error", doc)
+		}
+	}
+	// recursion through a member is fine
+	if _, err := Compile([]byte(`{"properties": {"next": {"$ref": "#"}}}`)); err != nil {
+		t.Error(err)
+	}
+}
+
+// A Validator can share a parse with other processing, and be reused
+func TestValidatorCallback(t *testing.T) {
+	s := MustCompile([]byte(`{"items": {"properties": {"n": {"type": "integer"}}}}`))
+	v := s.NewValidator()
+	p := goj.NewParser()
+	for i, c := range []struct {
+		doc   string
+		valid bool
+	}{{`[{"n": 1}, {"n": 2}]`, true}, {`[{"n": 1}, {"n": "2"}]`, false}, {`[]`, true}} {
+		v.Reset()
+		sum := 0
+		err := p.Parse([]byte(c.doc), func(t goj.Type, k []byte, val []byte) goj.Action {
+			v.Callback(t, k, val)
+			if t == goj.Integer {
+				sum++
+			}
+			return goj.Continue
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Err(); (err == nil) != c.valid {
+			t.Errorf("%d: expected valid=%v, got %v", i, c.valid, err)
+		}
+	}
+
+	v.Reset()
+	v.Callback(goj.Array, nil, nil)
+	if v.Err() == nil {
+		t.Error("expected an error for an incomplete document")
+	}
+	if err := v.Validate([]byte(`[{"n": 1},`)); err == nil {
+		t.Error("expected a parse error")
+	}
+	if err := v.Validate([]byte(`[{"n": 1}]`)); err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkValidate(b *testing.B) {
+	s := MustCompile([]byte(`{
+		"type": "array",
+		"items": {
+			"type": "object",
+			"required": ["id", "name", "tags"],
+			"properties": {
+				"id": {"type": "integer", "minimum": 0},
+				"name": {"type": "string", "maxLength": 64},
+				"tags": {"type": "array", "items": {"enum": ["a", "b", "c"]}, "uniqueItems": true},
+				"score": {"anyOf": [{"type": "number"}, {"type": "null"}]}
+			},
+			"additionalProperties": false
+		}
+	}`))
+	var items []string
+	for i := 0; i < 1000; i++ {
+		items = append(items, fmt.Sprintf(`{"id": %d, "name": "item %d", "tags": ["a", "c"], "score": %d.5}`, i, i, i))
+	}
+	doc := []byte("[" + strings.Join(items, ",") + "]")
+	b.SetBytes(int64(len(doc)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := s.Validate(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
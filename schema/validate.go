@@ -0,0 +1,755 @@
+package schema
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lloyd/goj"
+)
+
+// Error is a single violation of a schema.
+type Error struct {
+	// InstanceLocation is a JSON Pointer to the offending value in the
+	// document.
+	InstanceLocation string
+	// SchemaLocation is the URI of the keyword which failed, with a JSON
+	// Pointer to it as fragment.
+	SchemaLocation string
+	Message        string
+}
+
+func (e *Error) Error() string {
+	loc := e.InstanceLocation
+	if loc == "" {
+		loc = "(root)"
+	}
+	return loc + ": " + e.Message + " (" + e.SchemaLocation + ")"
+}
+
+// ValidationError is returned for a document which does not validate, and
+// lists every violation found.
+type ValidationError struct {
+	Errors []*Error
+}
+
+func (e *ValidationError) Error() string {
+	msg := "schema: " + e.Errors[0].Error()
+	if len(e.Errors) > 1 {
+		msg += " (and " + strconv.Itoa(len(e.Errors)-1) + " more errors)"
+	}
+	return msg
+}
+
+// role says how the result of an eval reaches its parent.
+type role uint8
+
+const (
+	roleRoot     role = iota
+	roleChild         // a member or element must be valid for the parent to be
+	roleContains      // counts towards the parent's contains
+	roleKey           // propertyNames, applied to a key
+	roleInPlace       // applies to the parent's value, see inPlace
+)
+
+type result struct {
+	ok   bool
+	errs []*Error
+}
+
+// eval is the application of a schema to a value, which lasts until the
+// end of the value.  Evals live on a stack in the Validator, and refer to
+// their parents by index.
+type eval struct {
+	n        *node
+	parent   int
+	role     role
+	slot     int  // for roleInPlace, the index in the parent's inPlace
+	quiet    bool // its errors would be discarded, so are not made
+	ok       bool
+	errs     []*Error
+	results  []result // of the inPlace schemas
+	count    int      // members or elements seen so far
+	contains int      // elements which matched contains
+	present  []bool   // for the properties in n.watch
+	seen     items    // for uniqueItems
+}
+
+// items is a set of the canonical forms of elements.
+type items struct {
+	buf  []byte
+	ends []int
+	m    map[string]struct{} // once there are many
+}
+
+// with more elements than this, a map beats comparing against them all
+const maxItemScan = 16
+
+func (s *items) reset() {
+	s.buf, s.ends, s.m = s.buf[:0], s.ends[:0], nil
+}
+
+func (s *items) add(c []byte) (dup bool) {
+	if s.m != nil {
+		if _, dup = s.m[string(c)]; !dup {
+			s.m[string(c)] = struct{}{}
+		}
+		return dup
+	}
+	start := 0
+	for _, end := range s.ends {
+		if string(s.buf[start:end]) == string(c) {
+			return true
+		}
+		start = end
+	}
+	s.buf = append(s.buf, c...)
+	s.ends = append(s.ends, len(s.buf))
+	if len(s.ends) > maxItemScan {
+		s.m = make(map[string]struct{}, 2*len(s.ends))
+		start = 0
+		for _, end := range s.ends {
+			s.m[string(s.buf[start:end])] = struct{}{}
+			start = end
+		}
+	}
+	return false
+}
+
+// level is a value being validated, which is an open object or array
+// unless it is the last one.
+type level struct {
+	first    int // the index of its first eval, the rest follow
+	t        goj.Type
+	key      []byte // its key, for a member of an object
+	inObject bool
+	index    int      // its index, for an element of an array
+	children int      // members or elements seen so far
+	val      []byte   // for a scalar
+	capture  *capture // records the text of an object or array
+	canon    []byte   // see canonical
+	hasCanon bool
+}
+
+type capture struct {
+	w *goj.Writer
+	r *goj.Reencoder
+}
+
+// Validator checks documents against a Schema, one entity at a time.  Its
+// Callback method is passed to Parse, directly or from another callback,
+// so that validation can share the parse with other processing:
+//
+//	v := s.NewValidator()
+//	err := parser.Parse(buf, func(t goj.Type, k, val []byte) goj.Action {
+//		v.Callback(t, k, val)
+//		...
+//	})
+//	if err == nil {
+//		err = v.Err()
+//	}
+//
+// The Validator must see every entity, so callbacks may not skip values.  A
+// Validator may be reused after Reset, but is not safe for concurrent use.
+type Validator struct {
+	s        *Schema
+	levels   []level
+	evals    []eval
+	captures []*capture
+	active   int // levels with a capture
+	scratch  *goj.Writer
+	parser   *goj.Parser
+	errs     []*Error
+}
+
+// NewValidator returns a Validator for the schema.
+func (s *Schema) NewValidator() *Validator {
+	return &Validator{s: s, scratch: goj.NewWriter(nil)}
+}
+
+// Validate validates the JSON document in buf.  It returns a
+// *ValidationError if the document does not match the schema, and the
+// parse error if it is not valid JSON.
+func (s *Schema) Validate(buf []byte) error {
+	v, _ := s.validators.Get().(*Validator)
+	if v == nil {
+		v = s.NewValidator()
+	}
+	err := v.Validate(buf)
+	s.validators.Put(v)
+	return err
+}
+
+// Validate resets the Validator and validates the JSON document in buf.
+func (v *Validator) Validate(buf []byte) error {
+	if v.parser == nil {
+		v.parser = goj.NewParser()
+	}
+	v.Reset()
+	if err := v.parser.Parse(buf, v.Callback); err != nil {
+		v.Reset()
+		return err
+	}
+	return v.Err()
+}
+
+// Reset prepares the Validator for another document.
+func (v *Validator) Reset() {
+	for len(v.levels) > 0 {
+		v.pop()
+	}
+	v.errs = nil
+}
+
+// Err returns the result of validating the entities passed to Callback
+// since the last Reset: nil if they form documents which match the schema,
+// and otherwise a *ValidationError.
+func (v *Validator) Err() error {
+	if len(v.levels) > 0 {
+		return errors.New("schema: incomplete document")
+	}
+	if len(v.errs) > 0 {
+		return &ValidationError{Errors: v.errs}
+	}
+	return nil
+}
+
+// Callback validates an entity, and has the signature of a goj.Callback.
+// It always returns Continue.
+func (v *Validator) Callback(t goj.Type, k []byte, val []byte) goj.Action {
+	t = t.Base()
+	switch t {
+	case goj.SkippedData:
+		return goj.Continue
+	case goj.ObjectEnd, goj.ArrayEnd:
+		v.record(t, k, val, len(v.levels)-1)
+		v.finish()
+		return goj.Continue
+	}
+
+	lv := v.push()
+	lv.t = t
+	lv.val = val
+	if len(v.levels) == 1 {
+		v.spawn(v.s.root, -1, roleRoot, 0)
+	} else {
+		parent := &v.levels[len(v.levels)-2]
+		lv.inObject = parent.t == goj.Object
+		lv.key = k
+		lv.index = parent.children
+		parent.children++
+		if lv.inObject {
+			v.checkKey(parent.first, lv.first, k)
+		}
+		for i := parent.first; i < lv.first; i++ {
+			v.member(i, lv)
+		}
+	}
+
+	// objects and arrays are recorded if they are compared as a whole
+	if t == goj.Object || t == goj.Array {
+		need := false
+		for i := lv.first; i < len(v.evals); i++ {
+			need = need || v.evals[i].n.enum != nil || v.evals[i].n.hasConst
+		}
+		if len(v.levels) > 1 && !lv.inObject {
+			for i := v.levels[len(v.levels)-2].first; i < lv.first; i++ {
+				need = need || v.evals[i].n.uniqueItems
+			}
+		}
+		if need {
+			lv.capture = v.newCapture()
+			v.active++
+		}
+	}
+	v.record(t, k, val, len(v.levels)-1)
+
+	for i := lv.first; i < len(v.evals); i++ {
+		v.check(&v.evals[i], t, val)
+	}
+	if t != goj.Object && t != goj.Array {
+		v.finish()
+	}
+	return goj.Continue
+}
+
+func (v *Validator) push() *level {
+	n := len(v.levels)
+	if n < cap(v.levels) {
+		v.levels = v.levels[:n+1]
+	} else {
+		v.levels = append(v.levels, level{})
+	}
+	lv := &v.levels[n]
+	*lv = level{first: len(v.evals)}
+	return lv
+}
+
+// pop drops the last level and its evals, which must be finished with.
+func (v *Validator) pop() {
+	lv := &v.levels[len(v.levels)-1]
+	if lv.capture != nil {
+		v.captures = append(v.captures, lv.capture)
+		v.active--
+	}
+	v.evals = v.evals[:lv.first]
+	*lv = level{}
+	v.levels = v.levels[:len(v.levels)-1]
+}
+
+func (v *Validator) newCapture() *capture {
+	if n := len(v.captures); n > 0 {
+		c := v.captures[n-1]
+		v.captures = v.captures[:n-1]
+		c.w.Reset(nil)
+		return c
+	}
+	w := goj.NewWriter(nil)
+	return &capture{w: w, r: goj.NewReencoder(w, nil)}
+}
+
+// record writes an entity to the captures of the levels which contain it.
+// own is the level of the value it opens or closes, which gets no key.
+func (v *Validator) record(t goj.Type, k, val []byte, own int) {
+	if v.active == 0 {
+		return
+	}
+	for i := range v.levels {
+		if c := v.levels[i].capture; c != nil {
+			if i == own {
+				c.r.Callback(t, nil, val)
+			} else {
+				c.r.Callback(t, k, val)
+			}
+		}
+	}
+}
+
+// spawn starts applying n to a value, along with the schemas which apply
+// in place, by pushing evals for them.
+func (v *Validator) spawn(n *node, parent int, r role, slot int) {
+	i := len(v.evals)
+	if i < cap(v.evals) {
+		// the slot keeps its slices from before, for reuse
+		v.evals = v.evals[:i+1]
+	} else {
+		v.evals = append(v.evals, eval{})
+	}
+	e := &v.evals[i]
+	e.n, e.parent, e.role, e.slot = n, parent, r, slot
+	e.quiet = false
+	if parent >= 0 {
+		p := &v.evals[parent]
+		switch {
+		case p.quiet, r == roleContains:
+			e.quiet = true
+		case r == roleInPlace:
+			switch p.n.inPlace[slot].by {
+			case byAnyOf, byOneOf, byNot, byIf:
+				e.quiet = true
+			}
+		}
+	}
+	e.ok = true
+	e.errs = e.errs[:0]
+	e.count, e.contains = 0, 0
+	e.seen.reset()
+	e.results = e.results[:0]
+	for range n.inPlace {
+		e.results = append(e.results, result{})
+	}
+	e.present = e.present[:0]
+	for range n.watch {
+		e.present = append(e.present, false)
+	}
+	for j, ip := range n.inPlace {
+		v.spawn(ip.n, i, roleInPlace, j)
+	}
+}
+
+// member applies the subschemas of the object or array which the eval at
+// index p is validating to a member or element of it.
+func (v *Validator) member(p int, lv *level) {
+	pe := &v.evals[p]
+	n := pe.n
+	pe.count++
+	if lv.inObject {
+		if len(n.watch) > 0 {
+			if i, ok := n.watch[string(lv.key)]; ok {
+				pe.present[i] = true
+			}
+		}
+		matched := false
+		if c, ok := n.properties[string(lv.key)]; ok {
+			v.spawn(c, p, roleChild, 0)
+			matched = true
+		}
+		for _, pp := range n.patternProperties {
+			if pp.re.Match(lv.key) {
+				v.spawn(pp.n, p, roleChild, 0)
+				matched = true
+			}
+		}
+		if !matched && n.additionalProperties != nil {
+			v.spawn(n.additionalProperties, p, roleChild, 0)
+		}
+		return
+	}
+	if lv.index < len(n.prefixItems) {
+		v.spawn(n.prefixItems[lv.index], p, roleChild, 0)
+	} else if n.items != nil {
+		v.spawn(n.items, p, roleChild, 0)
+	}
+	if n.contains != nil {
+		v.spawn(n.contains, p, roleContains, 0)
+	}
+}
+
+// checkKey applies propertyNames to the key of a member of the object
+// whose evals are those from first up to end.
+func (v *Validator) checkKey(first, end int, k []byte) {
+	start := len(v.evals)
+	for p := first; p < end; p++ {
+		if pn := v.evals[p].n.propertyNames; pn != nil {
+			v.spawn(pn, p, roleKey, 0)
+		}
+	}
+	if len(v.evals) == start {
+		return
+	}
+	kl := level{t: goj.String, val: k}
+	for i := start; i < len(v.evals); i++ {
+		v.check(&v.evals[i], goj.String, k)
+	}
+	for i := len(v.evals) - 1; i >= start; i-- {
+		v.finalize(&v.evals[i], &kl)
+		v.report(&v.evals[i])
+	}
+	v.evals = v.evals[:start]
+}
+
+// check applies the keywords of e which concern the value itself.
+func (v *Validator) check(e *eval, t goj.Type, val []byte) {
+	n := e.n
+	if n.isBool {
+		if !n.boolVal {
+			v.fail(e, "", "no value is allowed here")
+		}
+		return
+	}
+	if n.types != 0 && n.types&typeOf(t, val) == 0 {
+		v.fail(e, "type", "expected "+describeTypes(n.types)+", got "+describeTypes(typeOf(t, val)&^typeInteger))
+	}
+	switch t {
+	case goj.String:
+		if n.minLength >= 0 || n.maxLength >= 0 {
+			l := utf8.RuneCount(val)
+			if n.minLength >= 0 && l < n.minLength {
+				v.fail(e, "minLength", "must be at least "+strconv.Itoa(n.minLength)+" characters long")
+			}
+			if n.maxLength >= 0 && l > n.maxLength {
+				v.fail(e, "maxLength", "must be at most "+strconv.Itoa(n.maxLength)+" characters long")
+			}
+		}
+		if n.pattern != nil && !n.pattern.Match(val) {
+			v.fail(e, "pattern", "does not match the pattern "+strconv.Quote(n.pattern.String()))
+		}
+	case goj.Integer, goj.NegInteger, goj.Float:
+		if n.hasMin || n.hasMax || n.hasExclusiveMin || n.hasExclusiveMax {
+			f, _ := strconv.ParseFloat(string(val), 64)
+			if n.hasMin && f < n.minimum {
+				v.fail(e, "minimum", "must be at least "+formatFloat(n.minimum))
+			}
+			if n.hasMax && f > n.maximum {
+				v.fail(e, "maximum", "must be at most "+formatFloat(n.maximum))
+			}
+			if n.hasExclusiveMin && f <= n.exclusiveMinimum {
+				v.fail(e, "exclusiveMinimum", "must be greater than "+formatFloat(n.exclusiveMinimum))
+			}
+			if n.hasExclusiveMax && f >= n.exclusiveMaximum {
+				v.fail(e, "exclusiveMaximum", "must be less than "+formatFloat(n.exclusiveMaximum))
+			}
+		}
+		if n.multipleOf != nil && !isMultiple(val, n.multipleOf) {
+			v.fail(e, "multipleOf", "must be a multiple of "+n.multipleOf.RatString())
+		}
+	}
+}
+
+// finish completes the value of the last level, and drops it.
+func (v *Validator) finish() {
+	lv := &v.levels[len(v.levels)-1]
+	for i := len(v.evals) - 1; i >= lv.first; i-- {
+		v.finalize(&v.evals[i], lv)
+		v.report(&v.evals[i])
+	}
+	if len(v.levels) > 1 && !lv.inObject {
+		for p := v.levels[len(v.levels)-2].first; p < lv.first; p++ {
+			if pe := &v.evals[p]; pe.n.uniqueItems && pe.seen.add(v.canonical(lv)) {
+				v.fail(pe, "uniqueItems", "duplicates an earlier item")
+			}
+		}
+	}
+	v.pop()
+}
+
+// finalize applies the keywords of e which need the whole value, and
+// combines the results of the schemas which applied in place.
+func (v *Validator) finalize(e *eval, lv *level) {
+	n := e.n
+	if n.isBool {
+		return
+	}
+	switch lv.t {
+	case goj.Object:
+		if n.minProperties >= 0 && e.count < n.minProperties {
+			v.fail(e, "minProperties", "must have at least "+strconv.Itoa(n.minProperties)+" properties")
+		}
+		if n.maxProperties >= 0 && e.count > n.maxProperties {
+			v.fail(e, "maxProperties", "must have at most "+strconv.Itoa(n.maxProperties)+" properties")
+		}
+		for _, name := range n.required {
+			if !e.present[n.watch[name]] {
+				v.fail(e, "required", "missing required property "+strconv.Quote(name))
+			}
+		}
+		for _, d := range n.dependentRequired {
+			if !e.present[n.watch[d.name]] {
+				continue
+			}
+			for _, name := range d.required {
+				if !e.present[n.watch[name]] {
+					v.fail(e, "dependentRequired", "missing property "+strconv.Quote(name)+
+						", which is required when "+strconv.Quote(d.name)+" is present")
+				}
+			}
+		}
+	case goj.Array:
+		if n.minItems >= 0 && e.count < n.minItems {
+			v.fail(e, "minItems", "must have at least "+strconv.Itoa(n.minItems)+" items")
+		}
+		if n.maxItems >= 0 && e.count > n.maxItems {
+			v.fail(e, "maxItems", "must have at most "+strconv.Itoa(n.maxItems)+" items")
+		}
+		if n.contains != nil {
+			if e.contains < n.minContains {
+				kw := "contains"
+				if n.minContains != 1 {
+					kw = "minContains"
+				}
+				v.fail(e, kw, "must contain at least "+strconv.Itoa(n.minContains)+" matching items")
+			}
+			if n.maxContains >= 0 && e.contains > n.maxContains {
+				v.fail(e, "maxContains", "must contain at most "+strconv.Itoa(n.maxContains)+" matching items")
+			}
+		}
+	}
+	if n.enum != nil {
+		c, found := v.canonical(lv), false
+		for _, x := range n.enum {
+			found = found || x == string(c)
+		}
+		if !found {
+			v.fail(e, "enum", "must be one of the values in enum")
+		}
+	}
+	if n.hasConst && string(v.canonical(lv)) != n.constVal {
+		v.fail(e, "const", "must be the value in const")
+	}
+
+	anyOf, anyOK, oneOf, ifOK := 0, false, 0, false
+	for i, ip := range n.inPlace {
+		r := e.results[i]
+		switch ip.by {
+		case byRef, byAllOf:
+			v.failWith(e, r)
+		case byAnyOf:
+			anyOf++
+			anyOK = anyOK || r.ok
+		case byOneOf:
+			if r.ok {
+				oneOf++
+			}
+		case byNot:
+			if r.ok {
+				v.fail(e, "not", "must not match the schema in not")
+			}
+		case byIf:
+			ifOK = r.ok
+		case byThen:
+			if ifOK {
+				v.failWith(e, r)
+			}
+		case byElse:
+			if !ifOK {
+				v.failWith(e, r)
+			}
+		case byDependentSchema:
+			if e.present[n.watch[ip.name]] {
+				v.failWith(e, r)
+			}
+		}
+	}
+	if anyOf > 0 && !anyOK {
+		v.fail(e, "anyOf", "must match at least one of the schemas in anyOf")
+	}
+	if oneOf != 1 && n.hasOneOf() {
+		v.fail(e, "oneOf", "must match exactly one of the schemas in oneOf, but matches "+strconv.Itoa(oneOf))
+	}
+}
+
+func (n *node) hasOneOf() bool {
+	for _, ip := range n.inPlace {
+		if ip.by == byOneOf {
+			return true
+		}
+	}
+	return false
+}
+
+// report passes the result of e to its parent.
+func (v *Validator) report(e *eval) {
+	if e.role == roleRoot {
+		v.errs = append(v.errs, e.errs...)
+		return
+	}
+	p := &v.evals[e.parent]
+	switch e.role {
+	case roleChild, roleKey:
+		v.failWith(p, result{e.ok, e.errs})
+	case roleContains:
+		if e.ok {
+			p.contains++
+		}
+	case roleInPlace:
+		p.results[e.slot] = result{e.ok, e.errs}
+	}
+}
+
+func (v *Validator) failWith(e *eval, r result) {
+	if !r.ok {
+		e.ok = false
+		e.errs = append(e.errs, r.errs...)
+	}
+}
+
+func (v *Validator) fail(e *eval, kw, msg string) {
+	e.ok = false
+	if e.quiet {
+		return
+	}
+	loc := e.n.loc
+	if kw != "" {
+		loc += "/" + kw
+	}
+	e.errs = append(e.errs, &Error{InstanceLocation: v.pointer(), SchemaLocation: loc, Message: msg})
+}
+
+// pointer returns a JSON Pointer to the value of the last level.
+func (v *Validator) pointer() string {
+	var b strings.Builder
+	for _, lv := range v.levels[1:] {
+		b.WriteByte('/')
+		if lv.inObject {
+			b.WriteString(escapePointer(string(lv.key)))
+		} else {
+			b.WriteString(strconv.Itoa(lv.index))
+		}
+	}
+	return b.String()
+}
+
+// canonical returns the RFC 8785 form of the value of a level, which is
+// how values are compared.  For a scalar it is only valid until the next
+// call.
+func (v *Validator) canonical(lv *level) []byte {
+	if lv.hasCanon {
+		return lv.canon
+	}
+	if lv.capture != nil {
+		lv.canon = []byte(canonical(lv.capture.w.Bytes()))
+	} else {
+		// the Writer writes strings as RFC 8785 does, and numbers once
+		// they are floats
+		w := v.scratch
+		w.Reset(nil)
+		switch lv.t {
+		case goj.String:
+			w.StringBytes(lv.val)
+		case goj.True:
+			w.Bool(true)
+		case goj.False:
+			w.Bool(false)
+		case goj.Null:
+			w.Null()
+		default:
+			f, _ := strconv.ParseFloat(string(lv.val), 64)
+			if f == 0 {
+				f = 0 // no negative zero
+			}
+			if math.IsInf(f, 0) {
+				w.Number(lv.val)
+			} else {
+				w.Float(f)
+			}
+		}
+		lv.canon = w.Bytes()
+	}
+	lv.hasCanon = true
+	return lv.canon
+}
+
+// typeOf returns the type bits which describe a value: those of number and
+// integer for a number without a fractional part.
+func typeOf(t goj.Type, val []byte) int {
+	switch t {
+	case goj.String:
+		return typeString
+	case goj.Integer, goj.NegInteger:
+		return typeNumber | typeInteger
+	case goj.Float:
+		if f, err := strconv.ParseFloat(string(val), 64); err == nil && f == math.Trunc(f) {
+			return typeNumber | typeInteger
+		}
+		return typeNumber
+	case goj.True, goj.False:
+		return typeBoolean
+	case goj.Null:
+		return typeNull
+	case goj.Object:
+		return typeObject
+	case goj.Array:
+		return typeArray
+	}
+	return 0
+}
+
+func describeTypes(types int) string {
+	var names []string
+	for i, name := range typeNames {
+		if types&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func isMultiple(val []byte, m *big.Rat) bool {
+	if m.IsInt() && m.Num().IsInt64() {
+		if i, err := strconv.ParseInt(string(val), 10, 64); err == nil {
+			return i%m.Num().Int64() == 0
+		}
+	}
+	r, err := goj.ParseBigRat(val)
+	if err != nil {
+		return false
+	}
+	return r.Quo(r, m).IsInt()
+}
@@ -0,0 +1,196 @@
+//go:build go1.23
+// +build go1.23
+
+package goj
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"iter"
+)
+
+// Event is a single entity of a JSON document, as yielded by Events.  Key and
+// Value are only valid until the loop body returns.
+type Event struct {
+	Type  Type
+	Key   []byte
+	Value []byte
+	Depth int // the Iterator's Depth after reading this entity
+}
+
+// Events returns an iterator over the entities of the JSON document in buf:
+//
+//	for ev, err := range goj.Events(buf) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// A syntax error is yielded once, and ends the iteration.
+func Events(buf []byte) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		events(NewIterator(buf), yield)
+	}
+}
+
+func events(it *Iterator, yield func(Event, error) bool) {
+	for {
+		t, k, v, err := it.Next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			yield(Event{}, err)
+			return
+		}
+		if !yield(Event{Type: t, Key: k, Value: v, Depth: it.Depth()}, nil) {
+			return
+		}
+	}
+}
+
+// Record is a single document of newline separated JSON, as yielded by Lines.
+// It is only valid until the loop body returns.
+type Record struct {
+	Raw  []byte // the text of the line, without its line ending
+	Line int64  // line offset in the input, starting at 0 as in ReadJSONNL
+	it   *Iterator
+}
+
+// Events parses the record, returning an iterator over its entities.
+func (r Record) Events() iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		r.it.Reset(r.Raw)
+		events(r.it, yield)
+	}
+}
+
+// Unmarshal parses the record and stores the result in the value pointed to
+// by v, see Unmarshal.
+func (r Record) Unmarshal(v interface{}) error {
+	return Unmarshal(r.Raw, v)
+}
+
+// Lines returns an iterator over the documents of newline separated JSON read
+// from s.  Records are not parsed until asked, so lines may also be filtered
+// or passed on untouched cheaply.  Blank lines are skipped, though they are
+// counted in line offsets.  An error reading s is yielded once, and ends the
+// iteration.
+func Lines(s io.Reader) iter.Seq2[Record, error] {
+	return func(yield func(Record, error) bool) {
+		reader := bufio.NewReaderSize(s, bufSize)
+		rec := Record{it: NewIterator(nil)}
+		var long []byte
+		for line := int64(0); ; line++ {
+			raw, err := reader.ReadSlice('\n')
+			if err == bufio.ErrBufferFull {
+				// lines longer than the buffer are rare, copy them
+				long = append(long[:0], raw...)
+				for err == bufio.ErrBufferFull {
+					raw, err = reader.ReadSlice('\n')
+					long = append(long, raw...)
+				}
+				raw = long
+			}
+			if err != nil && err != io.EOF {
+				yield(Record{}, err)
+				return
+			}
+			rec.Raw = bytes.TrimRight(raw, "\r\n")
+			rec.Line = line
+			if len(bytes.TrimSpace(rec.Raw)) > 0 && !yield(rec, nil) {
+				return
+			}
+			if err == io.EOF {
+				return
+			}
+		}
+	}
+}
+
+// LinesFile returns an iterator over the documents of newline separated
+// JSON in the file at path, as Lines does.  On Linux the file is mapped into
+// memory rather than read, see ParseFile, and Raw points into the mapping,
+// which is removed when the iteration ends: Raw must be copied to be kept
+// past the loop.
+func LinesFile(path string) iter.Seq2[Record, error] {
+	return func(yield func(Record, error) bool) {
+		data, unmap, err := mapFile(path)
+		if err != nil {
+			yield(Record{}, err)
+			return
+		}
+		defer unmap()
+		rec := Record{it: NewIterator(nil)}
+		for line := int64(0); len(data) > 0; line++ {
+			raw := data
+			if i := bytes.IndexByte(data, '\n'); i >= 0 {
+				raw, data = data[:i], data[i+1:]
+			} else {
+				data = nil
+			}
+			rec.Raw = bytes.TrimRight(raw, "\r")
+			rec.Line = line
+			if len(bytes.TrimSpace(rec.Raw)) > 0 && !yield(rec, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Children returns an iterator over the elements of an array, or the values
+// of the members of an object, whose keys are given by Key.
+func (n Node) Children() iter.Seq[Node] {
+	return func(yield func(Node) bool) {
+		for c, ok := n.First(); ok; c, ok = c.Next() {
+			if !yield(c) {
+				return
+			}
+		}
+	}
+}
+
+// Members returns an iterator over the keys and values of the members of an
+// object, which scans it as it goes.  Should the Doc not be an object, or
+// the object be malformed, the last pair has a nil key and a Doc holding the
+// error.
+func (d Doc) Members() iter.Seq2[[]byte, Doc] {
+	return func(yield func([]byte, Doc) bool) {
+		o := d.Object()
+		if o.err != nil {
+			yield(nil, o)
+			return
+		}
+		c := o.c
+		for i := 0; i < len(c.vals) || o.d.more(o.off, c); i++ {
+			if !yield(c.keys[i], Doc{d: o.d, off: c.vals[i]}) {
+				return
+			}
+		}
+		if c.err != nil {
+			yield(nil, Doc{d: o.d, err: c.err})
+		}
+	}
+}
+
+// Elements returns an iterator over the indices and values of the elements
+// of an array, as Members does.  An error comes with the index -1.
+func (d Doc) Elements() iter.Seq2[int, Doc] {
+	return func(yield func(int, Doc) bool) {
+		a := d.Array()
+		if a.err != nil {
+			yield(-1, a)
+			return
+		}
+		c := a.c
+		for i := 0; i < len(c.vals) || a.d.more(a.off, c); i++ {
+			if !yield(i, Doc{d: a.d, off: c.vals[i]}) {
+				return
+			}
+		}
+		if c.err != nil {
+			yield(-1, Doc{d: a.d, err: c.err})
+		}
+	}
+}
@@ -0,0 +1,314 @@
+// Package stats profiles the shape of JSON documents, to find out where
+// their bytes go.  An Analyzer parses documents one at a time and reports,
+// for each of them and for all of them together, how deep they nest, how
+// many entities of each type they hold, how often each key appears, which
+// strings are largest, how many strings contain escapes, and how many bytes
+// are spent under each path:
+//
+//	a := stats.NewAnalyzer()
+//	for _, doc := range docs {
+//		if _, err := a.Analyze(doc); err != nil {
+//			return err
+//		}
+//	}
+//	total := a.Total()
+//
+// Paths are JSON pointers, with "*" standing for every element of an array,
+// so the bytes of {"a": [{"b": 1}, {"b": 2}]} are spread over "", "/a",
+// "/a/*" and "/a/*/b".
+package stats
+
+import (
+	"sort"
+	"unicode/utf8"
+
+	"github.com/lloyd/goj"
+)
+
+// Stats describes one or more documents.
+type Stats struct {
+	// Documents is the number of documents described, and Bytes the length
+	// of their text.
+	Documents int64
+	Bytes     int64
+	// MaxDepth is the deepest nesting of objects and arrays.
+	MaxDepth int
+	// Tokens counts the entities of each type, indexed by goj.Type.
+	Tokens [goj.SkippedData]int64
+	// Keys counts the members with each key.
+	Keys map[string]int64
+	// Strings counts the strings, keys included, and Escaped those of them
+	// which contain escape sequences, so had to be cooked when parsed.
+	Strings int64
+	Escaped int64
+	// Largest holds the largest string values, largest first.
+	Largest []String
+	// PathBytes gives the bytes spent on the values at each path.  The
+	// bytes of a member include its key, and those of an object or array
+	// include its contents, so each path accounts for everything below it.
+	PathBytes map[string]int64
+}
+
+// String is a string value found in a document.
+type String struct {
+	Path     string
+	Document int64 // its index among the documents analyzed
+	Offset   int   // of its opening quote in the document
+	Length   int   // of its text, quotes and escapes included
+	Prefix   string
+}
+
+// prefixLength bounds String.Prefix, as the strings of interest are large.
+const prefixLength = 40
+
+// EscapedRatio returns the fraction of strings which contain escapes.
+func (s *Stats) EscapedRatio() float64 {
+	if s.Strings == 0 {
+		return 0
+	}
+	return float64(s.Escaped) / float64(s.Strings)
+}
+
+// Merge adds the documents described by o to those described by s.  Largest
+// keeps at most top strings.
+func (s *Stats) Merge(o *Stats, top int) {
+	s.Documents += o.Documents
+	s.Bytes += o.Bytes
+	if o.MaxDepth > s.MaxDepth {
+		s.MaxDepth = o.MaxDepth
+	}
+	for i, n := range o.Tokens {
+		s.Tokens[i] += n
+	}
+	s.Keys = addCounts(s.Keys, o.Keys)
+	s.Strings += o.Strings
+	s.Escaped += o.Escaped
+	for _, str := range o.Largest {
+		s.Largest = insertLargest(s.Largest, str, top)
+	}
+	s.PathBytes = addCounts(s.PathBytes, o.PathBytes)
+}
+
+func addCounts(dst, src map[string]int64) map[string]int64 {
+	if dst == nil && len(src) > 0 {
+		dst = make(map[string]int64, len(src))
+	}
+	for k, n := range src {
+		dst[k] += n
+	}
+	return dst
+}
+
+// insertLargest adds str to the list of the top largest strings, if it
+// belongs there.
+func insertLargest(list []String, str String, top int) []String {
+	i := sort.Search(len(list), func(i int) bool { return list[i].Length < str.Length })
+	if i >= top {
+		return list
+	}
+	if len(list) < top {
+		list = append(list, String{})
+	}
+	copy(list[i+1:], list[i:])
+	list[i] = str
+	return list
+}
+
+// Analyzer gathers the Stats of documents.
+type Analyzer struct {
+	// Top is how many of the largest strings are kept, 10 by default.
+	Top int
+	// MaxPathDepth limits the paths in PathBytes to that many components,
+	// so deeper values are only accounted for by their ancestors.  Zero
+	// means no limit.
+	MaxPathDepth int
+
+	parser *goj.Parser
+	total  Stats
+	doc    Stats
+	keys   map[string]*int64
+	paths  map[string]*int64
+	stack  []frame
+	path   []byte
+}
+
+// frame is an open object or array.
+type frame struct {
+	start   int // of the container, or of its key
+	pathLen int // of its path, in Analyzer.path
+	array   bool
+}
+
+// NewAnalyzer returns an Analyzer which has seen no documents.
+func NewAnalyzer() *Analyzer {
+	return &Analyzer{
+		Top:    10,
+		parser: goj.NewParser(),
+		keys:   make(map[string]*int64),
+		paths:  make(map[string]*int64),
+	}
+}
+
+// Analyze parses the document in buf, adds its Stats to the total and
+// returns them.  If the document is not valid JSON the parse error is
+// returned and the total is unchanged.
+func (a *Analyzer) Analyze(buf []byte) (*Stats, error) {
+	a.doc = Stats{Documents: 1, Bytes: int64(len(buf))}
+	for k := range a.keys {
+		delete(a.keys, k)
+	}
+	for k := range a.paths {
+		delete(a.paths, k)
+	}
+	a.stack = a.stack[:0]
+	a.path = a.path[:0]
+	if err := a.parser.Parse(buf, a.callback); err != nil {
+		return nil, err
+	}
+
+	doc := a.doc
+	doc.Keys = counts(a.keys)
+	doc.PathBytes = counts(a.paths)
+	for i := range doc.Largest {
+		doc.Largest[i].Document = a.total.Documents
+	}
+	a.total.Merge(&doc, a.Top)
+	return &doc, nil
+}
+
+// Total returns the Stats of all the documents analyzed.
+func (a *Analyzer) Total() *Stats {
+	return &a.total
+}
+
+func counts(m map[string]*int64) map[string]int64 {
+	c := make(map[string]int64, len(m))
+	for k, n := range m {
+		c[k] = *n
+	}
+	return c
+}
+
+// add adds n to the count of k in m.  Looking k up with string(k) does not
+// allocate, so only keys seen for the first time in a document do.
+func add(m map[string]*int64, k []byte, n int64) {
+	if c, ok := m[string(k)]; ok {
+		*c += n
+		return
+	}
+	m[string(k)] = &n
+}
+
+func (a *Analyzer) callback(t goj.Type, k []byte, v []byte) goj.Action {
+	d := &a.doc
+	d.Tokens[t.Base()]++
+	start, end := a.parser.Offset()
+
+	switch t.Base() {
+	case goj.ObjectEnd, goj.ArrayEnd:
+		f := a.stack[len(a.stack)-1]
+		a.stack = a.stack[:len(a.stack)-1]
+		a.addPath(f.pathLen, int64(end-f.start))
+		a.path = a.path[:a.parentPathLen()]
+		return goj.Continue
+	}
+
+	// the path of this value
+	a.path = a.path[:a.parentPathLen()]
+	if n := len(a.stack); n > 0 {
+		if a.stack[n-1].array {
+			a.path = append(a.path, "/*"...)
+		} else {
+			a.path = append(a.path, '/')
+			a.path = appendEscaped(a.path, k)
+		}
+	}
+	// a member's bytes include its key
+	from := start
+	if k != nil {
+		ks, ke := a.parser.KeyOffset()
+		from = ks
+		add(a.keys, k, 1)
+		d.Strings++
+		if ke-ks-2 != len(k) {
+			d.Escaped++
+		}
+	}
+
+	switch t.Base() {
+	case goj.Object, goj.Array:
+		a.stack = append(a.stack, frame{start: from, pathLen: len(a.path), array: t == goj.Array})
+		if len(a.stack) > d.MaxDepth {
+			d.MaxDepth = len(a.stack)
+		}
+		return goj.Continue
+	case goj.String:
+		d.Strings++
+		if end-start-2 != len(v) {
+			d.Escaped++
+		}
+		if len(d.Largest) < a.Top || len(d.Largest) > 0 && end-start > d.Largest[len(d.Largest)-1].Length {
+			str := String{Path: string(a.path), Offset: start, Length: end - start}
+			str.Prefix = string(prefix(v))
+			d.Largest = insertLargest(d.Largest, str, a.Top)
+		}
+	}
+	a.addPath(len(a.path), int64(end-from))
+	return goj.Continue
+}
+
+// prefix returns at most prefixLength bytes from the start of v, without
+// splitting a character.
+func prefix(v []byte) []byte {
+	if len(v) <= prefixLength {
+		return v
+	}
+	n := prefixLength
+	for n > 0 && !utf8.RuneStart(v[n]) {
+		n--
+	}
+	return v[:n]
+}
+
+// parentPathLen returns the length of the path of the innermost open
+// container.
+func (a *Analyzer) parentPathLen() int {
+	if n := len(a.stack); n > 0 {
+		return a.stack[n-1].pathLen
+	}
+	return 0
+}
+
+// addPath adds n bytes to the path a.path[:pathLen], unless it is too deep.
+func (a *Analyzer) addPath(pathLen int, n int64) {
+	path := a.path[:pathLen]
+	if a.MaxPathDepth > 0 && depth(path) > a.MaxPathDepth {
+		return
+	}
+	add(a.paths, path, n)
+}
+
+// depth returns the number of components of a path.
+func depth(path []byte) (n int) {
+	for _, c := range path {
+		if c == '/' {
+			n++
+		}
+	}
+	return n
+}
+
+// appendEscaped appends k escaped as a JSON pointer component.
+func appendEscaped(dst, k []byte) []byte {
+	for _, c := range k {
+		switch c {
+		case '~':
+			dst = append(dst, "~0"...)
+		case '/':
+			dst = append(dst, "~1"...)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,87 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+func TestAnalyze(t *testing.T) {
+	doc := `{"id": 1, "tags": ["a", "b\n"], "nested": {"deep": [[{"x": "a long string"}]]}, "a/b": null}`
+	a := NewAnalyzer()
+	a.Top = 2
+	s, err := a.Analyze([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Documents != 1 || s.Bytes != int64(len(doc)) || s.MaxDepth != 5 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if s.Tokens[goj.String] != 3 || s.Tokens[goj.Object] != 3 || s.Tokens[goj.ArrayEnd] != 3 || s.Tokens[goj.Integer] != 1 {
+		t.Errorf("unexpected tokens %v", s.Tokens)
+	}
+	if fmt.Sprint(s.Keys) != "map[a/b:1 deep:1 id:1 nested:1 tags:1 x:1]" {
+		t.Errorf("unexpected keys %v", s.Keys)
+	}
+	// six keys and three strings, of which one is escaped
+	if s.Strings != 9 || s.Escaped != 1 || s.EscapedRatio() != 1.0/9 {
+		t.Errorf("unexpected strings %d %d", s.Strings, s.Escaped)
+	}
+	if len(s.Largest) != 2 || s.Largest[0].Path != "/nested/deep/*/*/x" || s.Largest[0].Prefix != "a long string" ||
+		doc[s.Largest[0].Offset:s.Largest[0].Offset+s.Largest[0].Length] != `"a long string"` || s.Largest[1].Length != 5 {
+		t.Errorf("unexpected largest strings %+v", s.Largest)
+	}
+
+	want := map[string]string{
+		"":                   doc,
+		"/id":                `"id": 1`,
+		"/tags":              `"tags": ["a", "b\n"]`,
+		"/tags/*":            `"a""b\n"`,
+		"/nested":            `"nested": {"deep": [[{"x": "a long string"}]]}`,
+		"/nested/deep/*/*/x": `"x": "a long string"`,
+		"/a~1b":              `"a/b": null`,
+	}
+	for path, text := range want {
+		if s.PathBytes[path] != int64(len(text)) {
+			t.Errorf("%s: want %d bytes, got %d", path, len(text), s.PathBytes[path])
+		}
+	}
+	if len(s.PathBytes) != 10 {
+		t.Errorf("unexpected paths %v", s.PathBytes)
+	}
+}
+
+func TestAnalyzeTotals(t *testing.T) {
+	a := NewAnalyzer()
+	a.MaxPathDepth = 1
+	docs := []string{`{"a": {"b": "xx"}}`, `[1, 2, 3]`, `{"a": 1, "c": "yyy"}`}
+	for _, doc := range docs {
+		if _, err := a.Analyze([]byte(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := a.Analyze([]byte(`{"a": `)); err == nil {
+		t.Error("expected a parse error")
+	}
+	s := a.Total()
+	if s.Documents != 3 || s.Bytes != int64(len(strings.Join(docs, ""))) || s.MaxDepth != 2 {
+		t.Errorf("unexpected totals %+v", s)
+	}
+	if s.Keys["a"] != 2 || s.Keys["b"] != 1 || s.Tokens[goj.Integer] != 4 {
+		t.Errorf("unexpected totals %+v", s)
+	}
+	var paths []string
+	for p := range s.PathBytes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	if fmt.Sprint(paths) != "[ /* /a /c]" || s.PathBytes["/a"] != int64(len(`"a": {"b": "xx"}`)+len(`"a": 1`)) {
+		t.Errorf("unexpected paths %v", s.PathBytes)
+	}
+	if len(s.Largest) != 2 || s.Largest[0].Document != 2 || s.Largest[1].Document != 0 {
+		t.Errorf("unexpected largest strings %+v", s.Largest)
+	}
+}
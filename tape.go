@@ -0,0 +1,348 @@
+package goj
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Tape is a flat index of a JSON document, built in one pass, which gives
+// random access to its values without parsing it again:
+//
+//	t := goj.NewTape()
+//	if err := t.Parse(buf); err != nil {
+//		return err
+//	}
+//	if n, ok := t.Get("/user/id"); ok {
+//		id, err := n.Int64()
+//		...
+//	}
+//
+// The Tape holds one entry for each value of the document, and one for each
+// key, in document order.  Each entry gives the type and the position of
+// the text of its value in the buffer, and the entry which follows the
+// value and all of its contents, so that whole objects and arrays are
+// stepped over at once.  Strings are only unescaped when they are read.
+//
+// The buffer must not be modified while the Tape refers to it.  A Tape may
+// be reused, but is not safe for concurrent use.
+type Tape struct {
+	buf     []byte
+	entries []tapeEntry
+	stack   []int // the open objects and arrays, while parsing
+	p       *Parser
+}
+
+// tapeEntry is a value, or a key.  Entries hold offsets in 32 bits, which
+// limits a Tape to documents of 4GB.
+type tapeEntry struct {
+	t      Type
+	flags  uint8
+	start  uint32 // of the text of the value, quotes included
+	length uint32
+	next   uint32 // the index of the entry after the value and its contents
+}
+
+// tapeEntry flags
+const (
+	tapeKey    = 1 << iota // the entry is the key of the member which follows
+	tapeCooked             // the string has escapes
+)
+
+// NewTape returns an empty Tape.
+func NewTape() *Tape {
+	return &Tape{p: NewParser()}
+}
+
+// SetEngine selects the engine of the Tape's Parser, see Parser.SetEngine.
+func (t *Tape) SetEngine(e Engine) {
+	t.p.SetEngine(e)
+}
+
+// SetDuplicateKeys sets the policy of the Tape's Parser for keys which
+// repeat within an object, see Parser.SetDuplicateKeys.  Otherwise all the
+// members are kept, and lookups find the first of them.
+func (t *Tape) SetDuplicateKeys(policy DuplicateKeys) {
+	t.p.SetDuplicateKeys(policy)
+}
+
+// Parse builds the Tape of the JSON document in buf, replacing what the Tape
+// held.  An empty document, without a value, is an error.
+func (t *Tape) Parse(buf []byte) error {
+	t.buf = buf
+	t.entries = t.entries[:0]
+	t.stack = t.stack[:0]
+	if uint64(len(buf)) > math.MaxUint32 {
+		return &Error{e: "document too large for a Tape", buf: buf}
+	}
+	p := t.p
+	p.reset(buf)
+	for {
+		typ, k, v, err := p.next()
+		if err != nil {
+			if err != io.EOF {
+				t.entries = t.entries[:0]
+				return err
+			}
+			break
+		}
+		if p.dropped() {
+			continue
+		}
+		if k != nil {
+			var flags uint8 = tapeKey
+			if len(k) != p.keyEnd-p.keyStart-2 {
+				flags |= tapeCooked
+			}
+			t.add(String, flags, p.keyStart, p.keyEnd)
+		}
+		switch typ {
+		case Object, Array:
+			t.stack = append(t.stack, len(t.entries))
+			t.add(typ, 0, p.start, p.i)
+		case ObjectEnd, ArrayEnd:
+			open := t.stack[len(t.stack)-1]
+			t.stack = t.stack[:len(t.stack)-1]
+			e := &t.entries[open]
+			e.length = uint32(p.i) - e.start
+			e.next = uint32(len(t.entries))
+		case String:
+			var flags uint8
+			if len(v) != p.i-p.start-2 {
+				flags = tapeCooked
+			}
+			t.add(String, flags, p.start, p.i)
+		default:
+			t.add(typ, 0, p.start, p.i)
+		}
+	}
+	if len(t.entries) == 0 {
+		return &Error{e: "no JSON value found", buf: buf}
+	}
+	return nil
+}
+
+func (t *Tape) add(typ Type, flags uint8, start, end int) {
+	t.entries = append(t.entries, tapeEntry{typ, flags, uint32(start), uint32(end - start), uint32(len(t.entries) + 1)})
+}
+
+// Root returns the value of the whole document.  The Tape must hold one.
+func (t *Tape) Root() Node {
+	return Node{t, 0, len(t.entries)}
+}
+
+// Get returns the value at path in the document, see Node.Get.
+func (t *Tape) Get(path string) (Node, bool) {
+	if len(t.entries) == 0 {
+		return Node{}, false
+	}
+	return t.Root().Get(path)
+}
+
+// Node is a value in a Tape.  The zero Node is not a value, and is only
+// returned along with false.
+type Node struct {
+	t   *Tape
+	i   int // its entry
+	end int // the entry after its parent's contents
+}
+
+func (n Node) entry() *tapeEntry {
+	return &n.t.entries[n.i]
+}
+
+// Type returns the type of the value: String, Integer, NegInteger, Float,
+// True, False, Null, Array or Object.
+func (n Node) Type() Type {
+	return n.entry().t
+}
+
+// Raw returns the text of the value in the document, quotes included for
+// strings and everything up to the closing brace or bracket for objects and
+// arrays.  It is part of the Tape's buffer.
+func (n Node) Raw() []byte {
+	e := n.entry()
+	return n.t.buf[e.start : e.start+e.length]
+}
+
+// Offset returns the position of the value in the document, as Raw does.
+func (n Node) Offset() (start, end int) {
+	e := n.entry()
+	return int(e.start), int(e.start + e.length)
+}
+
+// Value returns what a Callback would have been passed as the value: the
+// unescaped text of a string, the text of a number, and nil otherwise.  Only
+// strings with escapes are copied.
+func (n Node) Value() []byte {
+	switch e := n.entry(); e.t {
+	case String:
+		return n.t.text(e)
+	case Integer, NegInteger, Float:
+		return n.Raw()
+	}
+	return nil
+}
+
+// Key returns the unescaped key of the value, if it is a member of an
+// object, and nil otherwise.
+func (n Node) Key() []byte {
+	if n.i == 0 {
+		return nil
+	}
+	if k := &n.t.entries[n.i-1]; k.flags&tapeKey != 0 {
+		return n.t.text(k)
+	}
+	return nil
+}
+
+// text returns the unescaped text of a string or key.
+func (t *Tape) text(e *tapeEntry) []byte {
+	if e.flags&tapeCooked == 0 {
+		return t.buf[e.start+1 : e.start+e.length-1]
+	}
+	p := t.p
+	p.buf, p.i = t.buf, int(e.start)
+	v, _, _ := p.readString()
+	return append([]byte(nil), v...)
+}
+
+// Int64 returns the value of an integer which fits in an int64.
+func (n Node) Int64() (int64, error) {
+	return strconv.ParseInt(string(n.Value()), 10, 64)
+}
+
+// Uint64 returns the value of an integer which fits in a uint64.
+func (n Node) Uint64() (uint64, error) {
+	return strconv.ParseUint(string(n.Value()), 10, 64)
+}
+
+// Float64 returns the value of a number as a float64.
+func (n Node) Float64() (float64, error) {
+	return strconv.ParseFloat(string(n.Value()), 64)
+}
+
+// Bool reports whether the value is true.
+func (n Node) Bool() bool {
+	return n.Type() == True
+}
+
+// First returns the first element of an array, or the value of the first
+// member of an object, if it has one.
+func (n Node) First() (Node, bool) {
+	e := n.entry()
+	if e.t != Object && e.t != Array || int(e.next) == n.i+1 {
+		return Node{}, false
+	}
+	c := Node{n.t, n.i + 1, int(e.next)}
+	if e.t == Object {
+		c.i++ // past the key
+	}
+	return c, true
+}
+
+// Next returns the value which follows n in its array or object, if there
+// is one.  Its contents are stepped over at once.
+func (n Node) Next() (Node, bool) {
+	next := int(n.entry().next)
+	if next >= n.end {
+		return Node{}, false
+	}
+	if n.t.entries[next].flags&tapeKey != 0 {
+		next++
+	}
+	return Node{n.t, next, n.end}, true
+}
+
+// Len returns the number of elements of an array, or of members of an
+// object, and 0 for other values.
+func (n Node) Len() int {
+	l := 0
+	for c, ok := n.First(); ok; c, ok = c.Next() {
+		l++
+	}
+	return l
+}
+
+// Index returns the element of an array at index i.
+func (n Node) Index(i int) (Node, bool) {
+	if n.Type() != Array || i < 0 {
+		return Node{}, false
+	}
+	c, ok := n.First()
+	for ; ok && i > 0; i-- {
+		c, ok = c.Next()
+	}
+	return c, ok
+}
+
+// Member returns the value of the member of an object with the given key,
+// the first one should there be several.
+func (n Node) Member(key string) (Node, bool) {
+	if n.Type() != Object {
+		return Node{}, false
+	}
+	for c, ok := n.First(); ok; c, ok = c.Next() {
+		k := &n.t.entries[c.i-1]
+		if k.flags&tapeCooked == 0 {
+			if string(n.t.buf[k.start+1:k.start+k.length-1]) == key {
+				return c, true
+			}
+		} else if string(n.t.text(k)) == key {
+			return c, true
+		}
+	}
+	return Node{}, false
+}
+
+// pointerUnescaper undoes the escapes of JSON Pointer tokens.
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// Get returns the value at path below n, a JSON Pointer (RFC 6901) such as
+// "/users/0/name".  The empty path is n itself.  Array indices must be
+// decimal, without leading zeros.
+func (n Node) Get(path string) (Node, bool) {
+	if path != "" && path[0] != '/' {
+		return Node{}, false
+	}
+	for path != "" {
+		path = path[1:]
+		tok := path
+		if i := strings.IndexByte(path, '/'); i >= 0 {
+			tok, path = path[:i], path[i:]
+		} else {
+			path = ""
+		}
+		var ok bool
+		switch n.Type() {
+		case Object:
+			if strings.IndexByte(tok, '~') >= 0 {
+				tok = pointerUnescaper.Replace(tok)
+			}
+			n, ok = n.Member(tok)
+		case Array:
+			if i, valid := pointerIndex(tok); valid {
+				n, ok = n.Index(i)
+			}
+		}
+		if !ok {
+			return Node{}, false
+		}
+	}
+	return n, true
+}
+
+// pointerIndex parses an array index of a JSON Pointer.
+func pointerIndex(tok string) (int, bool) {
+	if tok == "" || len(tok) > 1 && tok[0] == '0' {
+		return 0, false
+	}
+	for i := 0; i < len(tok); i++ {
+		if tok[i] < '0' || tok[i] > '9' {
+			return 0, false
+		}
+	}
+	i, err := strconv.Atoi(tok)
+	return i, err == nil
+}
@@ -8,12 +8,15 @@
 package test
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"os"
 	"testing"
 
 	"github.com/lloyd/goj"
+	"github.com/lloyd/goj/value"
 )
 
 var codeJSON []byte
@@ -50,6 +53,116 @@ func BenchmarkGojScanning(b *testing.B) {
 	b.SetBytes(int64(len(codeJSON)))
 }
 
+func BenchmarkGojScanningIndexed(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	parser := goj.NewParser()
+	parser.SetEngine(goj.Indexed)
+	for i := 0; i < b.N; i++ {
+		err := parser.Parse([]byte(codeJSON), func(t goj.Type, k []byte, v []byte) goj.Action {
+			return goj.Continue
+		})
+		if err != nil {
+			b.Fatal("Scanning:", err)
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
+
+func BenchmarkGojTape(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	tape := goj.NewTape()
+	for i := 0; i < b.N; i++ {
+		if err := tape.Parse(codeJSON); err != nil {
+			b.Fatal("Tape:", err)
+		}
+		if _, ok := tape.Get("/tree/kids/0/name"); !ok {
+			b.Fatal("Tape: name not found")
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
+
+// Looking up a member of the last child steps over all the others.
+func BenchmarkGojDoc(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	for i := 0; i < b.N; i++ {
+		kids := goj.NewDoc(codeJSON).Get("tree").Get("kids")
+		n, err := kids.Len()
+		if err != nil {
+			b.Fatal("Doc:", err)
+		}
+		if _, err := kids.Index(n - 1).Get("name").String(); err != nil {
+			b.Fatal("Doc:", err)
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
+
+// The indented documents have much more space between tokens, which the
+// indexed engine does not look at.
+func benchmarkIndented(b *testing.B, e goj.Engine) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	var doc bytes.Buffer
+	if err := json.Indent(&doc, codeJSON, "", "  "); err != nil {
+		b.Fatal("Indent:", err)
+	}
+	parser := goj.NewParser()
+	parser.SetEngine(e)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := parser.Parse(doc.Bytes(), func(t goj.Type, k []byte, v []byte) goj.Action {
+			return goj.Continue
+		})
+		if err != nil {
+			b.Fatal("Scanning:", err)
+		}
+	}
+	b.SetBytes(int64(doc.Len()))
+}
+
+func BenchmarkGojScanningIndented(b *testing.B) {
+	benchmarkIndented(b, goj.StateMachine)
+}
+
+func BenchmarkGojScanningIndentedIndexed(b *testing.B) {
+	benchmarkIndented(b, goj.Indexed)
+}
+
+func BenchmarkGojScanningUniqueKeys(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	parser := goj.NewParser()
+	parser.SetDuplicateKeys(goj.ErrorOnDuplicates)
+	for i := 0; i < b.N; i++ {
+		err := parser.Parse([]byte(codeJSON), func(t goj.Type, k []byte, v []byte) goj.Action {
+			return goj.Continue
+		})
+		if err != nil {
+			b.Fatal("Scanning:", err)
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
+
 func BenchmarkStdJSONScanning(b *testing.B) {
 	if codeJSON == nil {
 		b.StopTimer()
@@ -64,3 +177,167 @@ func BenchmarkStdJSONScanning(b *testing.B) {
 	}
 	b.SetBytes(int64(len(codeJSON)))
 }
+
+func BenchmarkGojValue(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	d := value.NewDecoder()
+	d.SetInternKeys(true)
+	for i := 0; i < b.N; i++ {
+		if _, err := d.Decode(codeJSON); err != nil {
+			b.Fatal("Decoding:", err)
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
+
+func BenchmarkStdJSONValue(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	for i := 0; i < b.N; i++ {
+		var v interface{}
+		if err := json.Unmarshal(codeJSON, &v); err != nil {
+			b.Fatal("Decoding:", err)
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
+
+type codeResponse struct {
+	Tree     *codeNode `json:"tree"`
+	Username string    `json:"username"`
+}
+
+type codeNode struct {
+	Name     string      `json:"name"`
+	Kids     []*codeNode `json:"kids"`
+	CLWeight float64     `json:"cl_weight"`
+	Touches  int         `json:"touches"`
+	MinT     int64       `json:"min_t"`
+	MaxT     int64       `json:"max_t"`
+	MeanT    int64       `json:"mean_t"`
+}
+
+func BenchmarkGojUnmarshal(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	for i := 0; i < b.N; i++ {
+		var r codeResponse
+		if err := goj.Unmarshal(codeJSON, &r); err != nil {
+			b.Fatal("Unmarshal:", err)
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
+
+func BenchmarkStdJSONUnmarshal(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	for i := 0; i < b.N; i++ {
+		var r codeResponse
+		if err := json.Unmarshal(codeJSON, &r); err != nil {
+			b.Fatal("Unmarshal:", err)
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
+
+func BenchmarkGojGenerated(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	for i := 0; i < b.N; i++ {
+		var r genCodeResponse
+		if err := r.DecodeGoj(codeJSON); err != nil {
+			b.Fatal("DecodeGoj:", err)
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
+
+func BenchmarkGojDecoderToken(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	for i := 0; i < b.N; i++ {
+		dec := goj.NewDecoder(bytes.NewReader(codeJSON))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal("Token:", err)
+			}
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
+
+func BenchmarkStdJSONDecoderToken(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	for i := 0; i < b.N; i++ {
+		dec := json.NewDecoder(bytes.NewReader(codeJSON))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal("Token:", err)
+			}
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
+
+func BenchmarkGojWriter(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	w := goj.NewWriter(nil)
+	for i := 0; i < b.N; i++ {
+		w.Reset(nil)
+		if err := rewrite(w, codeJSON); err != nil {
+			b.Fatal("rewrite:", err)
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
+
+func BenchmarkStdJSONMarshal(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	var r codeResponse
+	if err := json.Unmarshal(codeJSON, &r); err != nil {
+		b.Fatal("Unmarshal:", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(&r); err != nil {
+			b.Fatal("Marshal:", err)
+		}
+	}
+	b.SetBytes(int64(len(codeJSON)))
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+// The examples of RFC 8785
+func TestCanonicalizeRFC8785(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{`{
+			"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+			"string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+			"literals": [null, true, false]
+		}`, `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`},
+		{`{
+			"\u20ac": "Euro Sign",
+			"\r": "Carriage Return",
+			"\ufb33": "Hebrew Letter Dalet With Dagesh",
+			"1": "One",
+			"\ud83d\ude00": "Emoji: Grinning Face",
+			"\u0080": "Control",
+			"ö": "Latin Small Letter O With Diaeresis"
+		}`, `{"\r":"Carriage Return","1":"One","` + "\u0080" + `":"Control","ö":"Latin Small Letter O With Diaeresis","€":"Euro Sign","😀":"Emoji: Grinning Face","` + "\ufb33" + `":"Hebrew Letter Dalet With Dagesh"}`},
+	} {
+		got, err := goj.Canonicalize([]byte(c.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.want {
+			t.Errorf("\nwant %s\ngot  %s", c.want, got)
+		}
+	}
+}
+
+// Keys beyond the Basic Multilingual Plane which share a high surrogate
+// are ordered by the low one, whatever their order in the input.
+func TestCanonicalizeSurrogateKeys(t *testing.T) {
+	want := `{"𝄞":3,"😀":2,"😁":1}`
+	for _, in := range []string{`{"😁":1,"😀":2,"𝄞":3}`, `{"😀":2,"😁":1,"𝄞":3}`, `{"𝄞":3,"\ud83d\ude01":1,"😀":2}`} {
+		got, err := goj.Canonicalize([]byte(in))
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %s, %v", in, got, err)
+		}
+	}
+}
+
+func TestCanonicalizeNumbers(t *testing.T) {
+	in := `[0, -0, 0.0e5, 1, -1.5, 1e21, 1e20, 1e-6, 1e-7, 123e-9, 9007199254740993,
+		5e-324, 1.7976931348623157e308, 1e-400, 295147905179352830000]`
+	want := `[0,0,0,1,-1.5,1e+21,100000000000000000000,0.000001,1e-7,1.23e-7,9007199254740992,` +
+		`5e-324,1.7976931348623157e+308,0,295147905179352830000]`
+	got, err := goj.Canonicalize([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("\nwant %s\ngot  %s", want, got)
+	}
+}
+
+// Nested objects are sorted, and the output is its own canonical form
+func TestCanonicalizeNested(t *testing.T) {
+	in := `[{"b": {"z": [{"y": 1, "x": 2}], "a": null}, "a": "<&> "}, "x", {}]`
+	want := `[{"a":"<&>` + " " + `","b":{"a":null,"z":[{"x":2,"y":1}]}},"x",{}]`
+	got, err := goj.Canonicalize([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("\nwant %s\ngot  %s", want, got)
+	}
+	again, err := goj.Canonicalize(got)
+	if err != nil || string(again) != string(got) {
+		t.Errorf("not idempotent: %s %v", again, err)
+	}
+}
+
+func TestCanonicalizeErrors(t *testing.T) {
+	for _, c := range []struct{ in, msg string }{
+		{``, "end of JSON input"},
+		{`{"a": 1,}`, ""},
+		{`[1] 2`, ""},
+		{`{"a": 1, "b": 2, "a": 3}`, `duplicate key "a"`},
+		{`[{"x": {"a": 1, "a": 2}}]`, `duplicate key "a"`},
+		{`{"😀": 1, "😁": 2, "😀": 3}`, `duplicate key "😀"`},
+		{`[1e400]`, "out of range"},
+		{`{"a": -1e309}`, "out of range"},
+		{`["\ud800"]`, "unpaired surrogate"},
+		{`["\ud800A"]`, "unpaired surrogate"},
+		{`{"\udc00x": 1}`, "unpaired surrogate"},
+		{"[\"\xff\"]", "invalid UTF-8"},
+	} {
+		got, err := goj.Canonicalize([]byte(c.in))
+		if err == nil {
+			t.Errorf("%q: expected an error, got %s", c.in, got)
+		} else if !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("%q: unexpected error %v", c.in, err)
+		}
+	}
+}
+
+// Objects are read once, however deep they nest
+func TestCanonicalizeDeep(t *testing.T) {
+	got, err := goj.Canonicalize(deepObjects(3000))
+	if want := strings.Repeat(`{"a":1,"b":`, 3000) + "[]" + strings.Repeat("}", 3000); err != nil || string(got) != want {
+		t.Errorf("got %.100s %v", got, err)
+	}
+}
+
+func BenchmarkGojCanonicalizeNested(b *testing.B) {
+	buf := deepObjects(4000)
+	for i := 0; i < b.N; i++ {
+		if _, err := goj.Canonicalize(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(int64(len(buf)))
+}
@@ -0,0 +1,233 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/lloyd/goj"
+)
+
+// gzipMembers compresses data as a gzip stream of a member for each part,
+// as concatenating gzip files gives.
+func gzipMembers(t testing.TB, parts ...[]byte) []byte {
+	var buf bytes.Buffer
+	for _, p := range parts {
+		zw := gzip.NewWriter(&buf)
+		zw.Write(p)
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// bgzf compresses data as bgzip does: in members of no more than size
+// bytes of data, each recording its own size, followed by an empty member.
+func bgzf(t testing.TB, data []byte, size int) []byte {
+	var out []byte
+	for {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+		zw.Write(data[:n])
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		member := buf.Bytes()
+		binary.LittleEndian.PutUint16(member[16:], uint16(len(member)-1))
+		out = append(out, member...)
+		if n == 0 {
+			return out
+		}
+		data = data[n:]
+	}
+}
+
+func readAll(r io.Reader) (string, error) {
+	d, err := goj.Decompress(r)
+	if err != nil {
+		return "", err
+	}
+	defer d.Close()
+	data, err := io.ReadAll(d)
+	return string(data), err
+}
+
+func TestDecompress(t *testing.T) {
+	var lines []byte
+	for i := 0; i < 50000; i++ {
+		lines = append(lines, fmt.Sprintf("{\"n\": %d, \"s\": \"%x\"}\n", i, i*i)...)
+	}
+	for _, c := range []struct {
+		name     string
+		in, want []byte
+	}{
+		{"plain", lines, lines},
+		{"empty", nil, nil},
+		{"short", []byte("1"), []byte("1")},
+		{"gzip magic only", []byte{0x1f}, []byte{0x1f}},
+		{"gzip", gzipMembers(t, lines), lines},
+		{"gzip of nothing", gzipMembers(t, nil), nil},
+		{"gzip members", gzipMembers(t, lines[:1000], nil, lines[1000:300000], lines[300000:]), lines},
+		{"bgzf", bgzf(t, lines, 1<<16), lines},
+		{"bgzf small blocks", bgzf(t, lines, 1000), lines},
+	} {
+		got, err := readAll(iotest.HalfReader(bytes.NewReader(c.in)))
+		if err != nil || got != string(c.want) {
+			t.Errorf("%s: got %d bytes, %v, want %d bytes", c.name, len(got), err, len(c.want))
+		}
+	}
+
+	// bzip2, which Go can't write, from a file of two concatenated streams
+	bz, err := os.ReadFile("testdata/lines.ndjson.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := lines[:bytes.Index(lines, []byte(`{"n": 2000,`))]
+	if got, err := readAll(iotest.HalfReader(bytes.NewReader(bz))); err != nil || got != string(want) {
+		t.Errorf("bzip2: got %d bytes, %v", len(got), err)
+	}
+	if _, err := readAll(bytes.NewReader(bz[:len(bz)-100])); err == nil {
+		t.Errorf("truncated bzip2: no error")
+	}
+	if got, err := readAll(strings.NewReader("BZh")); err != nil || got != "BZh" {
+		t.Errorf("bzip2 magic only: got %q, %v", got, err)
+	}
+
+	corrupted := bgzf(t, lines, 1000)
+	corrupted[len(corrupted)/2] ^= 0xff
+	for name, in := range map[string][]byte{
+		"truncated gzip":  gzipMembers(t, lines)[:5000],
+		"truncated bgzf":  bgzf(t, lines, 1000)[:5000],
+		"corrupted bgzf":  corrupted,
+		"bgzf then gzip":  append(bgzf(t, lines[:5000], 1000), gzipMembers(t, lines[5000:])...),
+		"gzip bad header": {0x1f, 0x8b, 0x42, 0, 0, 0, 0, 0, 0, 0},
+	} {
+		if _, err := readAll(bytes.NewReader(in)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+// Documents read from a compressed stream are those of the stream, and
+// reading may stop before its end.
+func TestReadCompressedJSONNL(t *testing.T) {
+	doc := "{\"a\": 1}\n[2, \"x\"]\n\n3\r\n  \n\"last\""
+	for _, in := range []string{doc, string(gzipMembers(t, []byte(doc))), string(bgzf(t, []byte(doc), 7))} {
+		for _, stopAt := range []int{0, 1, 3} {
+			want, wantErr := readNL(func(cb func(goj.Type, []byte, []byte, int64) bool) error {
+				return goj.ReadJSONNL(strings.NewReader(doc), cb)
+			}, stopAt)
+			got, gotErr := readNL(func(cb func(goj.Type, []byte, []byte, int64) bool) error {
+				return goj.ReadCompressedJSONNL(strings.NewReader(in), cb)
+			}, stopAt)
+			if fmt.Sprint(got) != fmt.Sprint(want) || gotErr != wantErr {
+				t.Errorf("%q, stopping at %d: got\n%v %s\nwant\n%v %s", in, stopAt, got, gotErr, want, wantErr)
+			}
+		}
+	}
+}
+
+func benchmarkCompressed(b *testing.B, compress func(testing.TB, []byte) []byte) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	var buf bytes.Buffer
+	for i := 0; i < 8; i++ {
+		buf.Write(codeJSON)
+		buf.WriteByte('\n')
+	}
+	in := compress(b, buf.Bytes())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := goj.ReadCompressedJSONNL(bytes.NewReader(in), func(t goj.Type, k []byte, v []byte, line int64) bool {
+			return true
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(int64(buf.Len()))
+}
+
+func BenchmarkGojReadGzipJSONNL(b *testing.B) {
+	benchmarkCompressed(b, func(t testing.TB, data []byte) []byte { return gzipMembers(t, data) })
+}
+
+func BenchmarkGojReadBGZFJSONNL(b *testing.B) {
+	benchmarkCompressed(b, func(t testing.TB, data []byte) []byte { return bgzf(t, data, 1<<16) })
+}
+
+// slowReader reads slowly, so that the reads of the decompressor are under
+// way when it is closed, and counts those which end after stop is set.
+type slowReader struct {
+	r          io.Reader
+	stop, late int32
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	if len(p) > 1000 {
+		p = p[:1000]
+	}
+	n, err := s.r.Read(p)
+	if atomic.LoadInt32(&s.stop) != 0 {
+		atomic.AddInt32(&s.late, 1)
+	}
+	return n, err
+}
+
+// Once Close returns, the stream is no longer read, and is left where the
+// decompression stopped for the caller to read on.
+func TestDecompressClose(t *testing.T) {
+	var lines []byte
+	for i := 0; i < 2000; i++ {
+		lines = append(lines, fmt.Sprintf("{\"n\": %d, \"s\": \"%x\"}\n", i, i*i)...)
+	}
+	bz, err := os.ReadFile("testdata/lines.ndjson.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, in := range map[string][]byte{
+		"gzip":  gzipMembers(t, lines),
+		"bgzf":  bgzf(t, lines, 1000),
+		"bzip2": bz,
+	} {
+		r := &slowReader{r: bytes.NewReader(in)}
+		d, err := goj.Decompress(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(d, make([]byte, 100)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		d.Close()
+		atomic.StoreInt32(&r.stop, 1)
+		time.Sleep(20 * time.Millisecond)
+		if late := atomic.LoadInt32(&r.late); late > 0 {
+			t.Errorf("%s: %d reads after Close", name, late)
+		}
+		if _, err := d.Read(make([]byte, 1)); err == nil {
+			t.Errorf("%s: read after Close", name)
+		}
+		atomic.StoreInt32(&r.stop, 0)
+		if _, err := io.ReadAll(r); err != nil {
+			t.Errorf("%s: reading on: %v", name, err)
+		}
+	}
+}
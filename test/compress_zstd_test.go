@@ -0,0 +1,32 @@
+//go:build goj_zstd
+// +build goj_zstd
+
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestDecompressZstd(t *testing.T) {
+	var lines []byte
+	for i := 0; i < 50000; i++ {
+		lines = append(lines, fmt.Sprintf("{\"n\": %d}\n", i)...)
+	}
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := zw.EncodeAll(lines, nil)
+	// frames may be concatenated, as gzip members are
+	in = zw.EncodeAll(lines, in)
+	if got, err := readAll(bytes.NewReader(in)); err != nil || got != string(lines)+string(lines) {
+		t.Errorf("got %d bytes, %v", len(got), err)
+	}
+	if _, err := readAll(bytes.NewReader(in[:len(in)-10])); err == nil {
+		t.Errorf("truncated: no error")
+	}
+}
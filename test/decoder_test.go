@@ -0,0 +1,165 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/lloyd/goj"
+)
+
+const decoderStream = ` {"a": [1, 2.5, -3e2, "x\"y"], "": {"b": null, "c": true}, "d": false}
+	[] {} "top" 42
+	[[{"k": [{}]}], {"é": "😀"}]
+	null`
+
+type tokenResult struct {
+	tok    json.Token
+	offset int64
+	more   bool
+}
+
+func stdTokens(t *testing.T, doc string, useNumber bool) []tokenResult {
+	dec := json.NewDecoder(strings.NewReader(doc))
+	if useNumber {
+		dec.UseNumber()
+	}
+	var res []tokenResult
+	for {
+		more := dec.More()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return res
+		} else if err != nil {
+			t.Fatalf("encoding/json: %v", err)
+		}
+		res = append(res, tokenResult{tok, dec.InputOffset(), more})
+	}
+}
+
+func gojTokens(t *testing.T, r io.Reader, useNumber bool) []tokenResult {
+	dec := goj.NewDecoder(r)
+	if useNumber {
+		dec.UseNumber()
+	}
+	var res []tokenResult
+	for {
+		more := dec.More()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return res
+		} else if err != nil {
+			t.Fatalf("goj: %v", err)
+		}
+		res = append(res, tokenResult{tok, dec.InputOffset(), more})
+	}
+}
+
+func compareTokens(t *testing.T, name string, want, got []tokenResult) {
+	if len(want) != len(got) {
+		t.Errorf("%s: expected %d tokens, got %d", name, len(want), len(got))
+	}
+	for i := 0; i < len(want) && i < len(got); i++ {
+		if !reflect.DeepEqual(want[i], got[i]) {
+			t.Errorf("%s: token %d: want %#v, got %#v", name, i, want[i], got[i])
+			return
+		}
+	}
+}
+
+// Token, More and InputOffset should behave exactly like encoding/json's
+func TestDecoderTokens(t *testing.T) {
+	for _, useNumber := range []bool{false, true} {
+		want := stdTokens(t, decoderStream, useNumber)
+		compareTokens(t, "stream", want, gojTokens(t, strings.NewReader(decoderStream), useNumber))
+		compareTokens(t, "one byte reader", want, gojTokens(t, iotest.OneByteReader(strings.NewReader(decoderStream)), useNumber))
+	}
+}
+
+func TestDecoderTokensCases(t *testing.T) {
+	files, _ := filepath.Glob("cases/*.json")
+	files = append(files, "code.json")
+	for _, f := range files {
+		buf, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !json.Valid(buf) || strings.Contains(f, "surrogate") {
+			continue
+		}
+		compareTokens(t, f, stdTokens(t, string(buf), true), gojTokens(t, iotest.HalfReader(strings.NewReader(string(buf))), true))
+	}
+}
+
+// Decode can be mixed with Token to decode the members of a large array
+func TestDecoderDecode(t *testing.T) {
+	doc := `{"items": [{"A": 1, "bee": "one"}, {"A": 2}, 3], "n": 4.5} {"A": 9} [1]`
+	dec := goj.NewDecoder(iotest.OneByteReader(strings.NewReader(doc)))
+	expect := func(want json.Token) {
+		t.Helper()
+		if tok, err := dec.Token(); err != nil || tok != want {
+			t.Fatalf("expected token %v, got %v (%v)", want, tok, err)
+		}
+	}
+	expect(json.Delim('{'))
+	expect("items")
+	expect(json.Delim('['))
+	var got []Inner
+	for dec.More() {
+		var in Inner
+		if err := dec.Decode(&in); err != nil {
+			got = append(got, Inner{A: -1})
+			continue
+		}
+		got = append(got, in)
+	}
+	if want := []Inner{{1, "one"}, {2, ""}, {-1, ""}}; !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	expect(json.Delim(']'))
+	if err := dec.Decode(new(string)); err == nil {
+		t.Errorf("expected error decoding at key position")
+	}
+	expect("n")
+	var n interface{}
+	if err := dec.Decode(&n); err != nil || n != 4.5 {
+		t.Errorf("expected 4.5, got %v (%v)", n, err)
+	}
+	expect(json.Delim('}'))
+	var in Inner
+	if err := dec.Decode(&in); err != nil || in.A != 9 {
+		t.Errorf("expected A=9, got %+v (%v)", in, err)
+	}
+	if off := dec.InputOffset(); off != int64(strings.Index(doc, " [1]")) {
+		t.Errorf("unexpected offset %d", off)
+	}
+	dec.UseNumber()
+	var arr []interface{}
+	if err := dec.Decode(&arr); err != nil || !reflect.DeepEqual(arr, []interface{}{json.Number("1")}) {
+		t.Errorf("expected [1], got %v (%v)", arr, err)
+	}
+	if err := dec.Decode(&arr); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	for _, doc := range []string{`{"a": 1`, `[1, 2,]`, `"unterminated`, `{"a" 1}`} {
+		dec := goj.NewDecoder(strings.NewReader(doc))
+		var err error
+		for err == nil {
+			_, err = dec.Token()
+		}
+		if err == io.EOF {
+			t.Errorf("%q: expected an error", doc)
+		}
+		if _, again := dec.Token(); again != err {
+			t.Errorf("%q: expected the error to be sticky, got %v", doc, again)
+		}
+	}
+}
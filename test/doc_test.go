@@ -0,0 +1,169 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+func TestDocGet(t *testing.T) {
+	doc := goj.NewDoc([]byte(` {"user": {"id": 42, "name": "béa", "tags": ["x", "y"], "score": -1.5e2,
+		"admin": false, "boss": null}, "n": [1, [2, [3]], {"a": {}}], "user": "again", "k\"ey": true}`))
+
+	if id, err := doc.Object().Get("user").Get("id").Int64(); err != nil || id != 42 {
+		t.Errorf("id: got %d, %v", id, err)
+	}
+	if id, err := doc.Get("user").Get("id").Uint64(); err != nil || id != 42 {
+		t.Errorf("id: got %d, %v", id, err)
+	}
+	if name, err := doc.Get("user").Get("name").String(); err != nil || name != "béa" {
+		t.Errorf("name: got %q, %v", name, err)
+	}
+	if tag, err := doc.Get("user").Get("tags").Index(1).String(); err != nil || tag != "y" {
+		t.Errorf("tag: got %q, %v", tag, err)
+	}
+	if f, err := doc.Get("user").Get("score").Float64(); err != nil || f != -150 {
+		t.Errorf("score: got %g, %v", f, err)
+	}
+	if b, err := doc.Get("user").Get("admin").Bool(); err != nil || b {
+		t.Errorf("admin: got %v, %v", b, err)
+	}
+	if typ, err := doc.Get("user").Get("boss").Type(); err != nil || typ != goj.Null {
+		t.Errorf("boss: got %s, %v", typ, err)
+	}
+	if b, err := doc.Get(`k"ey`).Bool(); err != nil || !b {
+		t.Errorf("escaped key: got %v, %v", b, err)
+	}
+	if n, err := doc.Get("n").Index(1).Index(1).Index(0).Int64(); err != nil || n != 3 {
+		t.Errorf("n: got %d, %v", n, err)
+	}
+	if raw, err := doc.Get("n").Index(1).Raw(); err != nil || string(raw) != "[2, [3]]" {
+		t.Errorf("raw: got %s, %v", raw, err)
+	}
+	if raw, err := doc.Raw(); err != nil || !strings.HasPrefix(string(raw), `{"user"`) || !strings.HasSuffix(string(raw), "true}") {
+		t.Errorf("raw: got %s, %v", raw, err)
+	}
+	// the first of duplicate keys
+	if typ, err := doc.Get("user").Type(); err != nil || typ != goj.Object {
+		t.Errorf("user: got %s, %v", typ, err)
+	}
+	if l, err := doc.Len(); err != nil || l != 4 {
+		t.Errorf("len: got %d, %v", l, err)
+	}
+	if l, err := doc.Get("user").Get("tags").Len(); err != nil || l != 2 {
+		t.Errorf("tags len: got %d, %v", l, err)
+	}
+	if v, err := doc.Get("user").Get("admin").Value(); err != nil || v != nil {
+		t.Errorf("admin value: got %q, %v", v, err)
+	}
+	if v, err := doc.Get("user").Get("score").Value(); err != nil || string(v) != "-1.5e2" {
+		t.Errorf("score value: got %q, %v", v, err)
+	}
+
+	for _, c := range []struct {
+		d    goj.Doc
+		want string
+	}{
+		{doc.Get("nobody"), goj.ErrNotFound.Error()},
+		{doc.Get("nobody").Get("id"), goj.ErrNotFound.Error()},
+		{doc.Get("n").Index(5), goj.ErrNotFound.Error()},
+		{doc.Get("n").Index(-1), goj.ErrNotFound.Error()},
+		{doc.Get("n").Get("a"), "expected object, found array"},
+		{doc.Get("user").Index(0), "expected array, found object"},
+	} {
+		if err := c.d.Err(); err == nil || err.Error() != c.want {
+			t.Errorf("got %v, want %s", err, c.want)
+		}
+	}
+	if _, err := doc.Get("n").Int64(); err == nil || err.Error() != "expected integer, found array" {
+		t.Errorf("got %v", err)
+	}
+	if _, err := doc.Get("user").Get("score").Int64(); err == nil {
+		t.Error("a float read as an integer")
+	}
+	if _, err := doc.Get("nobody").String(); !errors.Is(err, goj.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+// Members found are remembered, whatever the order of the lookups, and
+// objects with many members are looked up through a map.
+func TestDocCache(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("{")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&b, `"k%d": {"v": %d, "w": [%d]}, `, i, i, i)
+	}
+	b.WriteString(`"k0": "dup"}`)
+	doc := goj.NewDoc([]byte(b.String()))
+	for _, i := range []int{50, 3, 99, 0, 50, 17, 98, 1} {
+		key := fmt.Sprintf("k%d", i)
+		if v, err := doc.Get(key).Get("v").Int64(); err != nil || v != int64(i) {
+			t.Errorf("%s: got %d, %v", key, v, err)
+		}
+		if w, err := doc.Get(key).Get("w").Index(0).Int64(); err != nil || w != int64(i) {
+			t.Errorf("%s: got %d, %v", key, w, err)
+		}
+	}
+	if _, err := doc.Get("k100").Type(); err != goj.ErrNotFound {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+	if l, err := doc.Len(); err != nil || l != 101 {
+		t.Errorf("got %d, %v", l, err)
+	}
+	o := doc.Object()
+	if v, err := o.Get("k7").Get("v").Int64(); err != nil || v != 7 {
+		t.Errorf("got %d, %v", v, err)
+	}
+}
+
+// Only what is scanned need be valid, and errors are those of the Parser.
+func TestDocErrors(t *testing.T) {
+	doc := goj.NewDoc([]byte(`{"a": 1, "b": [1, 2 3], "c": {"d": tru}, "e": 2 "f": 3}`))
+	if a, err := doc.Get("a").Int64(); err != nil || a != 1 {
+		t.Errorf("a: got %d, %v", a, err)
+	}
+	if b, err := doc.Get("b").Index(1).Int64(); err != nil || b != 2 {
+		t.Errorf("b: got %d, %v", b, err)
+	}
+	for _, c := range []struct {
+		d    goj.Doc
+		want string
+	}{
+		{doc.Get("b").Index(2), "2 unexpected character"},
+		{doc.Get("c").Get("d"), "invalid string in json text."},
+		{doc.Get("f"), "after key and value, inside map, I expect ',' or '}'"},
+		{doc.Get("g"), "after key and value, inside map, I expect ',' or '}'"},
+	} {
+		_, err := c.d.Type()
+		if err == nil || err.Error() != c.want {
+			t.Errorf("got %v, want %s", err, c.want)
+		}
+	}
+	if _, err := doc.Len(); err == nil {
+		t.Error("malformed object has a length")
+	}
+
+	for _, c := range []struct {
+		doc  string
+		want string
+	}{
+		{``, "no JSON value found"},
+		{` `, "no JSON value found"},
+		{`{"a": 1`, "premature EOF"},
+		{`{"a" 1}`, "expected ':' to separate key and value"},
+		{`{"a": }`, "unallowed token at this point in JSON text"},
+		{`{"a": `, "unexpected end of buffer"},
+		{`{"a": "x`, "unterminated string found"},
+		{`{"a": [1, {"b": ]`, "premature EOF"},
+		{`{a: 1}`, "string expected '\"'"},
+		{`{"a": -}`, "malformed number, a digit is required after the minus sign"},
+	} {
+		if _, err := goj.NewDoc([]byte(c.doc)).Get("z").Type(); err == nil || err.Error() != c.want {
+			t.Errorf("%q: got %v, want %s", c.doc, err, c.want)
+		}
+	}
+}
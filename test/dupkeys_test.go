@@ -0,0 +1,178 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+// parseWith re-encodes what a parser with the given policy reports
+func parseWith(policy goj.DuplicateKeys, doc string) (string, error) {
+	p := goj.NewParser()
+	p.SetDuplicateKeys(policy)
+	w := goj.NewWriter(nil)
+	w.SetValidate(true)
+	err := p.Parse([]byte(doc), goj.NewReencoder(w, nil).Callback)
+	return string(w.Bytes()), err
+}
+
+func TestDuplicateKeyPolicies(t *testing.T) {
+	doc := `{"a": 1, "b": [1, {"a": 0, "a": 5}], "a": {"x": [2], "y": {}}, "c": 3, "\u0062": 4, "d": {"a": 1}}`
+	for _, c := range []struct {
+		policy goj.DuplicateKeys
+		want   string
+	}{
+		{goj.AllowDuplicates, `{"a":1,"b":[1,{"a":0,"a":5}],"a":{"x":[2],"y":{}},"c":3,"b":4,"d":{"a":1}}`},
+		{goj.KeepFirst, `{"a":1,"b":[1,{"a":0}],"c":3,"d":{"a":1}}`},
+		{goj.KeepLast, `{"a":{"x":[2],"y":{}},"c":3,"b":4,"d":{"a":1}}`},
+	} {
+		got, err := parseWith(c.policy, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("policy %d:\nwant %s\ngot  %s", c.policy, c.want, got)
+		}
+	}
+
+	_, err := parseWith(goj.ErrorOnDuplicates, doc)
+	var dup *goj.DuplicateKeyError
+	if !errors.As(err, &dup) {
+		t.Fatalf("expected a DuplicateKeyError, got %v", err)
+	}
+	if dup.Key != "a" || dup.Offset != strings.Index(doc, `"a": 5`) {
+		t.Errorf("unexpected error %#v", dup)
+	}
+}
+
+// Every policy agrees with the default on documents without duplicates
+func TestDuplicateKeysNone(t *testing.T) {
+	for _, c := range getTests() {
+		want, wantErr := parseWith(goj.AllowDuplicates, c.json)
+		for _, policy := range []goj.DuplicateKeys{goj.ErrorOnDuplicates, goj.KeepFirst, goj.KeepLast} {
+			got, err := parseWith(policy, c.json)
+			if got != want || fmt.Sprint(err) != fmt.Sprint(wantErr) {
+				t.Errorf("%s: policy %d:\nwant %.200s %v\ngot  %.200s %v", c.name, policy, want, wantErr, got, err)
+			}
+		}
+	}
+}
+
+func TestDuplicateKeysMany(t *testing.T) {
+	var keys []string
+	for i := 0; i < 100; i++ {
+		keys = append(keys, fmt.Sprintf(`"k%d": %d`, i, i))
+	}
+	doc := "{" + strings.Join(keys, ", ") + `, "k42": "again"}`
+	_, err := parseWith(goj.ErrorOnDuplicates, doc)
+	if dup, ok := err.(*goj.DuplicateKeyError); !ok || dup.Key != "k42" || dup.Offset != strings.LastIndex(doc, `"k42"`) {
+		t.Errorf("unexpected error %v", err)
+	}
+	for policy, want := range map[goj.DuplicateKeys]string{
+		goj.KeepFirst: `"k41":41,"k42":42,"k43":43,`,
+		goj.KeepLast:  `"k41":41,"k43":43,`,
+	} {
+		got, err := parseWith(policy, doc)
+		if err != nil || !strings.Contains(got, want) || strings.Count(got, `"k42"`) != 1 {
+			t.Errorf("policy %d: unexpected output %s %v", policy, got, err)
+		}
+	}
+}
+
+// Skipped objects and the Iterator keep track of the open objects
+func TestDuplicateKeysSkipping(t *testing.T) {
+	doc := `[{"a": {"a": 1, "a": 2}, "b": 1, "a": 3}, {"a": [{"b": 1, "b": 2}], "b": 2}]`
+	p := goj.NewParser()
+	p.SetDuplicateKeys(goj.KeepFirst)
+	var skipped []string
+	err := p.Parse([]byte(doc), func(t goj.Type, k []byte, v []byte) goj.Action {
+		switch {
+		case t == goj.SkippedData:
+			skipped = append(skipped, string(v))
+		case string(k) == "a":
+			return goj.Skip
+		}
+		return goj.Continue
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(skipped, " "); got != `{"a": 1, "a": 2} [{"b": 1, "b": 2}]` {
+		t.Errorf("unexpected skipped data %s", got)
+	}
+
+	it := goj.NewIterator([]byte(doc))
+	it.Next()
+	it.SetDuplicateKeys(goj.ErrorOnDuplicates)
+	var depths []int
+	for {
+		ty, k, _, err := it.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if _, ok := err.(*goj.DuplicateKeyError); !ok || fmt.Sprint(depths) != "[1 2 3 2]" {
+				t.Errorf("unexpected error %v after %v", err, depths)
+			}
+			return
+		}
+		depths = append(depths, it.Depth())
+		if ty == goj.Object && k != nil {
+			it.SkipValue()
+		}
+	}
+	t.Errorf("expected a duplicate key error")
+}
+
+// nested returns objects nested depth deep, in the member "b" of the one
+// around them, which has the members before ahead of it and after behind
+func nested(depth int, before, after string) string {
+	return strings.Repeat(`{`+before+`"b":`, depth) + "{}" + strings.Repeat(after+"}", depth)
+}
+
+// Objects within objects are looked ahead through once, whatever their depth
+func TestDuplicateKeysNested(t *testing.T) {
+	doc := nested(300, `"a":1,`, `,"a":2`)
+	got, err := parseWith(goj.KeepLast, doc)
+	if want := nested(300, "", `,"a":2`); err != nil || got != want {
+		t.Errorf("unexpected output %.100s %v", got, err)
+	}
+
+	// the parse passes the keys in skipped objects by
+	p := goj.NewParser()
+	p.SetDuplicateKeys(goj.KeepLast)
+	var values []string
+	err = p.Parse([]byte(`{"a":{"a":1,"a":2},"b":[{"a":3,"a":4}],"a":{"c":5,"c":6}}`), func(t goj.Type, k []byte, v []byte) goj.Action {
+		if t == goj.Array {
+			return goj.Skip
+		}
+		if t == goj.Integer {
+			values = append(values, string(v))
+		}
+		return goj.Continue
+	})
+	if err != nil || fmt.Sprint(values) != "[6]" {
+		t.Errorf("unexpected values %v %v", values, err)
+	}
+}
+
+func benchmarkNested(b *testing.B, policy goj.DuplicateKeys) {
+	doc := []byte(nested(4000, `"a":1,`, `,"c":2`))
+	p := goj.NewParser()
+	p.SetDuplicateKeys(policy)
+	for i := 0; i < b.N; i++ {
+		err := p.Parse(doc, func(t goj.Type, k []byte, v []byte) goj.Action {
+			return goj.Continue
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(int64(len(doc)))
+}
+
+func BenchmarkGojNestedAllowDuplicates(b *testing.B) { benchmarkNested(b, goj.AllowDuplicates) }
+func BenchmarkGojNestedKeepLast(b *testing.B)        { benchmarkNested(b, goj.KeepLast) }
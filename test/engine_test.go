@@ -0,0 +1,193 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+// engineOutcome parses doc with an engine, and renders everything the
+// callback sees, offsets included, and how the parse ends.  The entity
+// numbered skip, counting from 1, is skipped.
+func engineOutcome(e goj.Engine, dups goj.DuplicateKeys, doc []byte, skip int) (out string) {
+	var b bytes.Buffer
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(&b, "panic: %v\n", r)
+		}
+		out = b.String()
+	}()
+	p := goj.NewParser()
+	p.SetEngine(e)
+	p.SetDuplicateKeys(dups)
+	p.SetBigNumbers(true)
+	n := 0
+	err := p.Parse(doc, func(t goj.Type, k []byte, v []byte) goj.Action {
+		start, end := p.Offset()
+		fmt.Fprintf(&b, "%d-%d ", start, end)
+		if k != nil {
+			start, end = p.KeyOffset()
+			fmt.Fprintf(&b, "(%d-%d) ", start, end)
+		}
+		fmt.Fprintf(&b, "%s %q %q\n", t, k, v)
+		if n++; n == skip {
+			return goj.Skip
+		}
+		return goj.Continue
+	})
+	if perr, ok := err.(*goj.Error); ok {
+		fmt.Fprintf(&b, "error: %s\n", perr.Verbose())
+	} else if err != nil {
+		fmt.Fprintf(&b, "error: %s\n", err)
+	}
+	return out
+}
+
+func compareEngines(t *testing.T, name string, dups goj.DuplicateKeys, doc []byte, skip int) {
+	t.Helper()
+	want := engineOutcome(goj.StateMachine, dups, doc, skip)
+	if got := engineOutcome(goj.Indexed, dups, doc, skip); got != want {
+		t.Fatalf("%s, %q, skipping %d:\nstate machine:\n%s\nindexed:\n%s", name, doc, skip, want, got)
+	}
+}
+
+// The Indexed engine reports the same as the state machine on the test
+// cases, whatever is skipped and whatever the policy for duplicate keys.
+func TestEnginesAgree(t *testing.T) {
+	for _, c := range getTests() {
+		doc := []byte(c.json)
+		// only objects and arrays may be skipped, try the first few
+		skips := []int{0}
+		for i, e := range strings.Split(engineOutcome(goj.StateMachine, goj.AllowDuplicates, doc, 0), "\n") {
+			if len(skips) < 20 && (strings.Contains(e, " object ") || strings.Contains(e, " array ")) {
+				skips = append(skips, i+1)
+			}
+		}
+		for _, dups := range []goj.DuplicateKeys{goj.AllowDuplicates, goj.ErrorOnDuplicates, goj.KeepFirst, goj.KeepLast} {
+			for _, skip := range skips {
+				compareEngines(t, c.name, dups, doc, skip)
+			}
+		}
+	}
+
+	// Skipped sections with unbalanced quotes and stray backslashes, where
+	// the quotes of the index are not those of the state machine.
+	for _, doc := range []string{
+		`{"a":[1,2,{"bf:4"c\"d"}],"e":"\\" ,"f":tue}`,
+		`{"a":[1,2,{"bf:4"c\"d"}],"e":"\\" ,"f":true}`,
+		"[\"\\\"\",\n] and this string \" ]\n",
+		`[[1, "x\"], \"], "y"]`,
+	} {
+		for skip := 1; skip < 6; skip++ {
+			compareEngines(t, "unbalanced", goj.AllowDuplicates, []byte(doc), skip)
+		}
+	}
+}
+
+// And on broken documents: the test cases cut short, and with bytes
+// replaced, inserted or removed.
+func TestEnginesAgreeOnErrors(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	alphabet := []byte("{}[]:,\"\\ \t\n0123456789-+.eEtrufalsn\x00\x1fx\u00e9/")
+	for _, c := range getTests() {
+		doc := []byte(c.json)
+		for i := 0; i < len(doc); i++ {
+			compareEngines(t, c.name, goj.AllowDuplicates, doc[:i], 0)
+		}
+		for i := 0; i < 100 && len(doc) > 0; i++ {
+			var d []byte
+			at := r.Intn(len(doc))
+			switch r.Intn(3) {
+			case 0:
+				d = append([]byte(nil), doc...)
+				d[at] = alphabet[r.Intn(len(alphabet))]
+			case 1:
+				d = append(append(append([]byte(nil), doc[:at]...), alphabet[r.Intn(len(alphabet))]), doc[at:]...)
+			case 2:
+				d = append(append([]byte(nil), doc[:at]...), doc[at+1:]...)
+			}
+			compareEngines(t, c.name, goj.AllowDuplicates, d, 0)
+			compareEngines(t, c.name, goj.AllowDuplicates, d, 1+r.Intn(8))
+		}
+	}
+}
+
+// Long documents span many blocks of the index, and strings, escapes and
+// runs of backslashes cross from one block to the next.
+func TestEnginesAgreeOnLongDocuments(t *testing.T) {
+	if codeJSON == nil {
+		codeInit()
+	}
+	compareEngines(t, "code.json", goj.AllowDuplicates, codeJSON, 0)
+	compareEngines(t, "code.json", goj.AllowDuplicates, codeJSON, 2)
+
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		var b bytes.Buffer
+		b.WriteString("[")
+		for j := r.Intn(40); j >= 0; j-- {
+			b.WriteString(`"`)
+			for k := r.Intn(150); k > 0; k-- {
+				switch r.Intn(10) {
+				case 0:
+					b.WriteString(`\\`)
+				case 1:
+					b.WriteString(`\"`)
+				case 2:
+					b.WriteString(`\u00e9`)
+				default:
+					b.WriteByte('a' + byte(r.Intn(26)))
+				}
+			}
+			b.WriteString(`", `)
+			b.Write(bytes.Repeat([]byte(" "), r.Intn(70)))
+			fmt.Fprintf(&b, `{"n": %d, "m": [%g, true, null]}, `, r.Int63(), r.NormFloat64())
+		}
+		b.WriteString("false]")
+		doc := b.Bytes()
+		compareEngines(t, "long", goj.AllowDuplicates, doc, 0)
+		compareEngines(t, "long", goj.AllowDuplicates, doc[:r.Intn(len(doc))], 0)
+		compareEngines(t, "long", goj.AllowDuplicates, doc, 2+r.Intn(4))
+	}
+}
+
+// The Iterator may switch engines, and skips values as Parse does.
+func TestIteratorEngines(t *testing.T) {
+	doc := []byte(`{"a": [1, {"b": "c"}], "d": {"e": [true]}, "f": "\u00e9"}`)
+	for _, e := range []goj.Engine{goj.StateMachine, goj.Indexed} {
+		it := goj.NewIterator(doc)
+		it.SetEngine(e)
+		var got []string
+		for {
+			typ, k, v, err := it.Next()
+			if err != nil {
+				break
+			}
+			start, end := it.Offset()
+			got = append(got, fmt.Sprintf("%s %s %s %d-%d", typ, k, v, start, end))
+			if string(k) == "a" {
+				v, _ := it.SkipValue()
+				got = append(got, string(v))
+			}
+		}
+		want := []string{
+			"object   0-1",
+			"array a  6-7",
+			`[1, {"b": "c"}]`,
+			"object d  28-29",
+			"array e  34-35",
+			"true   35-39",
+			"array end   39-40",
+			"object end   40-41",
+			"string f é 48-56",
+			"object end   56-57",
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: got\n%q\nwant\n%q", e, got, want)
+		}
+	}
+}
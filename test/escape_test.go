@@ -0,0 +1,115 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+// escapedCorpora are documents made of strings with escapes in every few
+// characters, as JSON written by encoders which escape all that is not
+// ASCII is.
+var escapedCorpora = func() map[string][]byte {
+	words := strings.Fields("Да Му Еба Майката Добро утро Здравей свят Благодаря много")
+	emoji := []rune("😀😃😄😁🎉🚀🌍🔥")
+	docs := map[string]*strings.Builder{"Bulgarian": {}, "ASCII": {}, "Surrogates": {}}
+	for _, b := range docs {
+		b.WriteString("[")
+	}
+	for i := 0; i < 5000; i++ {
+		sep := ",\n"
+		if i == 0 {
+			sep = "\n"
+		}
+		b := docs["Bulgarian"]
+		b.WriteString(sep + `"`)
+		for j := 0; j < 4; j++ {
+			for _, r := range words[(i+j)%len(words)] {
+				fmt.Fprintf(b, `\u%04x`, r)
+			}
+			b.WriteString(" ")
+		}
+		b.WriteString(`"`)
+		fmt.Fprintf(docs["ASCII"], `%s"line %d\tof \"%d\"\nsays C:\\path\/to\r\n"`, sep, i, i*7)
+		b = docs["Surrogates"]
+		b.WriteString(sep + `"`)
+		for j := 0; j < 6; j++ {
+			r := emoji[(i+j)%len(emoji)]
+			fmt.Fprintf(b, `\u%04X\u%04X ok `, 0xD800+((r-0x10000)>>10), 0xDC00+((r-0x10000)&0x3FF))
+		}
+		b.WriteString(`"`)
+	}
+	corpora := map[string][]byte{}
+	for name, b := range docs {
+		b.WriteString("\n]\n")
+		corpora[name] = []byte(b.String())
+	}
+	return corpora
+}()
+
+// Strings are unescaped as encoding/json unescapes them, and once the parser
+// has grown its buffers, without allocating.
+func TestUnescape(t *testing.T) {
+	for name, doc := range escapedCorpora {
+		var want []string
+		if err := json.Unmarshal(doc, &want); err != nil {
+			t.Fatal(err)
+		}
+		for _, engine := range []goj.Engine{goj.StateMachine, goj.Indexed} {
+			parser := goj.NewParser()
+			parser.SetEngine(engine)
+			var got []string
+			err := parser.Parse(doc, func(t goj.Type, k []byte, v []byte) goj.Action {
+				if t == goj.String {
+					got = append(got, string(v))
+				}
+				return goj.Continue
+			})
+			if err != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("%s, %v: got %q, %v", name, engine, got[:1], err)
+			}
+			allocs := testing.AllocsPerRun(10, func() {
+				parser.Parse(doc, func(t goj.Type, k []byte, v []byte) goj.Action {
+					return goj.Continue
+				})
+			})
+			if allocs != 0 {
+				t.Errorf("%s, %v: %v allocations a parse", name, engine, allocs)
+			}
+		}
+	}
+}
+
+func benchmarkEscaped(b *testing.B, name string) {
+	doc := escapedCorpora[name]
+	parser := goj.NewParser()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := parser.Parse(doc, func(t goj.Type, k []byte, v []byte) goj.Action {
+			return goj.Continue
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(int64(len(doc)))
+}
+
+func BenchmarkGojEscapedBulgarian(b *testing.B)  { benchmarkEscaped(b, "Bulgarian") }
+func BenchmarkGojEscapedASCII(b *testing.B)      { benchmarkEscaped(b, "ASCII") }
+func BenchmarkGojEscapedSurrogates(b *testing.B) { benchmarkEscaped(b, "Surrogates") }
+
+func BenchmarkStdJSONEscapedBulgarian(b *testing.B) {
+	doc := escapedCorpora["Bulgarian"]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var v []string
+		if err := json.Unmarshal(doc, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(int64(len(doc)))
+}
@@ -0,0 +1,181 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// describeErr renders an error the way the test cases compare them, Verbose
+// included, which shows the document after the error.
+func describeErr(err error) string {
+	if e, ok := err.(*goj.Error); ok {
+		return e.Verbose()
+	}
+	return fmt.Sprint(err)
+}
+
+// ParseFile reports what Parse does, errors included, and the errors may be
+// looked at once the file is unmapped.
+func TestParseFile(t *testing.T) {
+	for _, c := range getTests() {
+		var want, got string
+		err := goj.NewParser().Parse([]byte(c.json), func(t goj.Type, k []byte, v []byte) goj.Action {
+			want += formatEvent(t, k, v)
+			return goj.Continue
+		})
+		want += describeErr(err)
+		path := writeFile(t, "doc.json", []byte(c.json))
+		err = goj.ParseFile(path, func(t goj.Type, k []byte, v []byte) goj.Action {
+			got += formatEvent(t, k, v)
+			return goj.Continue
+		})
+		got += describeErr(err)
+		if got != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, got, want)
+		}
+	}
+
+	if err := goj.ParseFile(filepath.Join(t.TempDir(), "missing.json"), nil); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v, want a missing file", err)
+	}
+	called := false
+	if err := goj.ParseFile(writeFile(t, "empty.json", nil), func(goj.Type, []byte, []byte) goj.Action {
+		called = true
+		return goj.Continue
+	}); err != nil || called {
+		t.Errorf("empty file: got %v, called %v", err, called)
+	}
+	if err := goj.ParseFile(writeFile(t, "cancel.json", []byte(`[1, 2]`)), func(goj.Type, []byte, []byte) goj.Action {
+		return goj.Cancel
+	}); err != goj.ClientCancelledParse {
+		t.Errorf("got %v, want the parse cancelled", err)
+	}
+}
+
+// Files whose data ends at the end of a page, where the mapping ends, are
+// scanned up to their last byte and no further.
+func TestParseFileAtPageEnd(t *testing.T) {
+	size := 2 * os.Getpagesize()
+	parse := func(parse func(goj.Callback) error) string {
+		var out string
+		err := parse(func(t goj.Type, k []byte, v []byte) goj.Action {
+			out += formatEvent(t, k, v)
+			return goj.Continue
+		})
+		return out + describeErr(err)
+	}
+	docs := []string{
+		`"` + strings.Repeat("y", size-2) + `"`,
+		`"` + strings.Repeat("y", size-1),
+		strings.Repeat("7", size),
+	}
+	for _, suffix := range []string{`"c": "zz"}`, `"c": 1}`, `"c": [[]]}`, `"c": {"d": [1]}}`, `"c": "zz`, `"c": 12`, `"c": [1, 2`, `"c": {"d`} {
+		head := `{"a": 123, "b": "`
+		docs = append(docs, head+strings.Repeat("x", size-len(head)-len(`", `)-len(suffix))+`", `+suffix)
+	}
+	for _, d := range docs {
+		want := parse(func(cb goj.Callback) error { return goj.NewParser().Parse([]byte(d), cb) })
+		path := writeFile(t, "page.json", []byte(d))
+		got := parse(func(cb goj.Callback) error { return goj.ParseFile(path, cb) })
+		if got != want {
+			t.Errorf("%q: got\n%s\nwant\n%s", d[len(d)-20:], got, want)
+		}
+	}
+
+	// and newline separated documents end there just as well
+	line := `{"n": 1234567890}` + "\n"
+	doc := strings.Repeat(line, (size-len("12345"))/len(line))
+	doc += strings.Repeat(" ", size-len(doc)-len("12345")) + "12345"
+	var last []byte
+	err := goj.ReadJSONNLFile(writeFile(t, "page.ndjson", []byte(doc)), func(typ goj.Type, k []byte, v []byte, line int64) bool {
+		last = append(last[:0], v...)
+		return true
+	})
+	if err != nil || string(last) != "12345" {
+		t.Errorf("got %q, %v", last, err)
+	}
+}
+
+type nlEvent struct {
+	event string
+	line  int64
+}
+
+func readNL(f func(cb func(t goj.Type, k []byte, v []byte, line int64) bool) error, stopAt int) ([]nlEvent, string) {
+	var events []nlEvent
+	err := f(func(t goj.Type, k []byte, v []byte, line int64) bool {
+		events = append(events, nlEvent{formatEvent(t, k, v), line})
+		return len(events) != stopAt
+	})
+	return events, describeErr(err)
+}
+
+// ReadJSONNLFile reports what ReadJSONNL does.
+func TestReadJSONNLFile(t *testing.T) {
+	for _, doc := range []string{
+		"",
+		"\n",
+		`{"a": 1}`,
+		"{\"a\": 1}\n[2, \"x\"]\n\n3\r\n  \n\"last\"",
+		"{\"a\": 1}\n[2, \"x\"]\n",
+		"{\"a\": 1}\n[2, \"x\"\n{}\n",
+		"1\n2\n3 4\n5\n",
+	} {
+		path := writeFile(t, "docs.ndjson", []byte(doc))
+		for _, stopAt := range []int{0, 1, 3} {
+			want, wantErr := readNL(func(cb func(goj.Type, []byte, []byte, int64) bool) error {
+				return goj.ReadJSONNL(strings.NewReader(doc), cb)
+			}, stopAt)
+			got, gotErr := readNL(func(cb func(goj.Type, []byte, []byte, int64) bool) error {
+				return goj.ReadJSONNLFile(path, cb)
+			}, stopAt)
+			if fmt.Sprint(got) != fmt.Sprint(want) || gotErr != wantErr {
+				t.Errorf("%q, stopping at %d: got\n%v %s\nwant\n%v %s", doc, stopAt, got, gotErr, want, wantErr)
+			}
+		}
+	}
+}
+
+func BenchmarkGojReadJSONNLFile(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	var buf bytes.Buffer
+	for i := 0; i < 8; i++ {
+		buf.Write(codeJSON)
+		buf.WriteByte('\n')
+	}
+	path := filepath.Join(b.TempDir(), "code.ndjson")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := goj.ReadJSONNLFile(path, func(t goj.Type, k []byte, v []byte, line int64) bool {
+			return true
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(int64(buf.Len()))
+}
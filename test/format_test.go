@@ -0,0 +1,183 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/lloyd/goj"
+)
+
+func formatInputs(t *testing.T) map[string][]byte {
+	files, _ := filepath.Glob("cases/*.json")
+	files = append(files, "code.json")
+	inputs := make(map[string][]byte)
+	for _, f := range files {
+		buf, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if json.Valid(buf) {
+			inputs[f] = buf
+		}
+	}
+	inputs["trailing space"] = []byte("  {\"a\" : [ 1 , {} , [ ] ]}  \n\t")
+	return inputs
+}
+
+// Compact and Indent should produce exactly what encoding/json does
+func TestCompactIndentMatchEncodingJSON(t *testing.T) {
+	for name, buf := range formatInputs(t) {
+		var want, got bytes.Buffer
+		want.WriteString("keep")
+		got.WriteString("keep")
+		json.Compact(&want, buf)
+		if err := goj.Compact(&got, buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(want.Bytes(), got.Bytes()) {
+			t.Errorf("%s: Compact:\nwant %.200q\ngot  %.200q", name, want.Bytes(), got.Bytes())
+		}
+
+		want.Reset()
+		got.Reset()
+		json.Indent(&want, buf, ">", "\t")
+		if err := goj.Indent(&got, buf, ">", "\t"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(want.Bytes(), got.Bytes()) {
+			t.Errorf("%s: Indent:\nwant %.200q\ngot  %.200q", name, want.Bytes(), got.Bytes())
+		}
+	}
+}
+
+// SortKeys with EscapeHTML matches what encoding/json makes of a decoded
+// document
+func TestFormatSortKeys(t *testing.T) {
+	for name, buf := range formatInputs(t) {
+		if !utf8.Valid(buf) || strings.Contains(name, "surrogate") {
+			// goj decodes a lone surrogate as '?', encoding/json as U+FFFD
+			continue
+		}
+		want, err := json.MarshalIndent(decodeNumbers(t, buf), "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got bytes.Buffer
+		if err := goj.Format(&got, buf, goj.FormatOptions{Indent: "  ", SortKeys: true, EscapeHTML: true}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(want, bytes.TrimRight(got.Bytes(), " \t\r\n")) {
+			t.Errorf("%s:\nwant %.300s\ngot  %.300s", name, want, got.Bytes())
+		}
+	}
+}
+
+func TestFormatEscapeNonASCII(t *testing.T) {
+	buf := []byte(`{"é": ["😀", "a\u00e9b", "<&>", "\u2028"]}`)
+	var got bytes.Buffer
+	if err := goj.Format(&got, buf, goj.FormatOptions{EscapeNonASCII: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"\u00e9":["\ud83d\ude00","a\u00e9b","<&>","\u2028"]}`
+	if got.String() != want {
+		t.Errorf("\nwant %s\ngot  %s", want, got.String())
+	}
+	if !reflect.DeepEqual(decodeNumbers(t, buf), decodeNumbers(t, got.Bytes())) {
+		t.Errorf("escaping changed the document")
+	}
+}
+
+func TestFormatWidth(t *testing.T) {
+	buf := []byte(`{"short": [1, 2, 3], "nested": {"b": {"c": [true, null]}, "a": "xxxxxxxxxxxxxxxxxxxx"},
+		"long": ["aaaaaaaaaa", "bbbbbbbbbb", "cccccccccc", "dddddddddd"], "empty": {}}`)
+	var got bytes.Buffer
+	if err := goj.Format(&got, buf, goj.FormatOptions{Indent: "  ", Width: 40, SortKeys: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "empty": {},
+  "long": [
+    "aaaaaaaaaa",
+    "bbbbbbbbbb",
+    "cccccccccc",
+    "dddddddddd"
+  ],
+  "nested": {
+    "a": "xxxxxxxxxxxxxxxxxxxx",
+    "b": {"c": [true, null]}
+  },
+  "short": [1, 2, 3]
+}`
+	if got.String() != want {
+		t.Errorf("\nwant %s\ngot  %s", want, got.String())
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	for _, doc := range []string{``, `   `, `{"a": 1,}`, `[1] 2`, `{"a": [1, 2}`} {
+		for _, opts := range []goj.FormatOptions{{}, {Indent: " ", Width: 80, SortKeys: true}} {
+			dst := bytes.NewBufferString("unchanged")
+			if err := goj.Format(dst, []byte(doc), opts); err == nil {
+				t.Errorf("%q: expected an error", doc)
+			}
+			if dst.String() != "unchanged" {
+				t.Errorf("%q: dst was modified: %q", doc, dst.String())
+			}
+		}
+	}
+}
+
+// deepObjects returns objects nested depth deep, each the member "b" of the
+// one around it, ahead of a member "a"
+func deepObjects(depth int) []byte {
+	return []byte(strings.Repeat(`{"b":`, depth) + "[]" + strings.Repeat(`,"a":1}`, depth))
+}
+
+// Sorting and measuring read each container once, however deep they nest
+func TestFormatNested(t *testing.T) {
+	buf := deepObjects(3000)
+	for _, c := range []struct {
+		opts goj.FormatOptions
+		want string
+	}{
+		{goj.FormatOptions{SortKeys: true}, strings.Repeat(`{"a":1,"b":`, 3000) + "[]" + strings.Repeat("}", 3000)},
+		{goj.FormatOptions{Indent: " ", Width: 1 << 20, SortKeys: true}, strings.Repeat(`{"a": 1, "b": `, 3000) + "[]" + strings.Repeat("}", 3000)},
+		{goj.FormatOptions{Indent: " ", Width: 1 << 20}, strings.Repeat(`{"b": `, 3000) + "[]" + strings.Repeat(`, "a": 1}`, 3000)},
+	} {
+		var got bytes.Buffer
+		if err := goj.Format(&got, buf, c.opts); err != nil || got.String() != c.want {
+			t.Errorf("%+v: got %.100s %v", c.opts, got.String(), err)
+		}
+	}
+}
+
+func benchmarkFormatNested(b *testing.B, opts goj.FormatOptions) {
+	buf := deepObjects(4000)
+	var out bytes.Buffer
+	for i := 0; i < b.N; i++ {
+		out.Reset()
+		if err := goj.Format(&out, buf, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(int64(len(buf)))
+}
+
+func BenchmarkGojFormatNested(b *testing.B) {
+	benchmarkFormatNested(b, goj.FormatOptions{})
+}
+
+func BenchmarkGojFormatNestedSortKeys(b *testing.B) {
+	benchmarkFormatNested(b, goj.FormatOptions{SortKeys: true})
+}
+
+func BenchmarkGojFormatNestedWidth(b *testing.B) {
+	// indented, deep objects take lines ever longer, unless they fit on one
+	benchmarkFormatNested(b, goj.FormatOptions{Indent: "  ", Width: 1 << 20})
+}
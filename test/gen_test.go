@@ -0,0 +1,78 @@
+package test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+const genEventDoc = `{
+	"id": 12,
+	"Created": "2016-04-01T12:00:00Z",
+	"author": {"name": "lloyd", "EMAIL": "lloyd@example.com"},
+	"kind": "create",
+	"count": "17",
+	"score": -1.5e3,
+	"ratio": 0.25,
+	"enabled": true,
+	"small": 255,
+	"tags": ["a", "b"],
+	"matrix": [[1, 2], [], [3]],
+	"children": [{"id": 1, "children": null}, null, {"kind": "x", "author": null}],
+	"siblings": [{"name": "a"}, {"name": "b", "Email": null}],
+	"counts": {"x": 1, "y": 2},
+	"authors": {"first": {"name": "f"}, "none": null},
+	"extra": {"anything": [1, "goes", {"here": true}]},
+	"raw": "aGVsbG8=",
+	"fixed": ["one", "two", "three"],
+	"Skipped": "no",
+	"hidden": 7,
+	"unknown": {"deeply": [{"nested": "value"}]}
+}`
+
+// generated decoders should produce exactly what encoding/json does
+func TestGeneratedMatchesEncodingJSON(t *testing.T) {
+	var want, got genEvent
+	if err := json.Unmarshal([]byte(genEventDoc), &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := got.DecodeGoj([]byte(genEventDoc)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant %+v\ngot  %+v", want, got)
+	}
+
+	if codeJSON == nil {
+		codeInit()
+	}
+	var wantCode, gotCode genCodeResponse
+	if err := json.Unmarshal(codeJSON, &wantCode); err != nil {
+		t.Fatal(err)
+	}
+	if err := gotCode.DecodeGoj(codeJSON); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wantCode, gotCode) {
+		t.Errorf("code.json decoded differently")
+	}
+}
+
+func TestGeneratedErrors(t *testing.T) {
+	var e genEvent
+	err := e.DecodeGoj([]byte(`{"small": 256, "tags": {}, "kind": "ok"}`))
+	if te, ok := err.(*goj.UnmarshalTypeError); !ok || te.Key != "small" {
+		t.Errorf("expected type error on key 'small', got %v", err)
+	}
+	if e.Kind != "ok" {
+		t.Errorf("expected decoding to continue past type errors")
+	}
+	if err := e.DecodeGoj([]byte(`[1, 2]`)); err == nil {
+		t.Errorf("expected error decoding an array into a struct")
+	}
+	if err := e.DecodeGoj([]byte(`{"id": 1`)); err == nil {
+		t.Errorf("expected syntax error")
+	}
+}
@@ -0,0 +1,482 @@
+// Code generated by gojgen. DO NOT EDIT.
+
+package test
+
+import "github.com/lloyd/goj"
+
+// DecodeGoj decodes the JSON object in buf into x.
+func (x *GenBase) DecodeGoj(buf []byte) error {
+	return goj.DecodeObject(buf, x)
+}
+
+// GojMember decodes a member of a JSON object into x.  It implements
+// goj.Frame.
+func (x *GenBase) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	switch string(key) {
+	case "id":
+		if v, ok := s.Int(t, key, value, 64); ok {
+			x.ID = v
+		}
+		return goj.Continue
+	case "Created":
+		return s.Fallback(&x.Created, t, value)
+	}
+	if k, ok := s.Fold(key, gojFieldsGenBase); ok {
+		return x.GojMember(s, t, k, value)
+	}
+	return goj.Skip
+}
+
+var gojFieldsGenBase = [][]byte{[]byte("id"), []byte("Created")}
+
+// DecodeGoj decodes the JSON object in buf into x.
+func (x *GenAuthor) DecodeGoj(buf []byte) error {
+	return goj.DecodeObject(buf, x)
+}
+
+// GojMember decodes a member of a JSON object into x.  It implements
+// goj.Frame.
+func (x *GenAuthor) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	switch string(key) {
+	case "name":
+		if v, ok := s.String(t, key, value); ok {
+			x.Name = v
+		}
+		return goj.Continue
+	case "Email":
+		if t == goj.Null {
+			x.Email = nil
+			return goj.Continue
+		}
+		if x.Email == nil {
+			x.Email = new(string)
+		}
+		if v, ok := s.String(t, key, value); ok {
+			*x.Email = v
+		}
+		return goj.Continue
+	}
+	if k, ok := s.Fold(key, gojFieldsGenAuthor); ok {
+		return x.GojMember(s, t, k, value)
+	}
+	return goj.Skip
+}
+
+var gojFieldsGenAuthor = [][]byte{[]byte("name"), []byte("Email")}
+
+// DecodeGoj decodes the JSON object in buf into x.
+func (x *genEvent) DecodeGoj(buf []byte) error {
+	return goj.DecodeObject(buf, x)
+}
+
+// GojMember decodes a member of a JSON object into x.  It implements
+// goj.Frame.
+func (x *genEvent) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	switch string(key) {
+	case "author":
+		if t == goj.Null {
+			x.GenAuthor = nil
+			return goj.Continue
+		}
+		if t != goj.Object {
+			s.TypeError(t, key, (*GenAuthor)(nil))
+			return goj.Skip
+		}
+		if x.GenAuthor == nil {
+			x.GenAuthor = new(GenAuthor)
+		}
+		s.Push(x.GenAuthor)
+		return goj.Continue
+	case "kind":
+		if v, ok := s.String(t, key, value); ok {
+			x.Kind = genStatus(v)
+		}
+		return goj.Continue
+	case "count":
+		t, value = s.Literal(t, key, value)
+		if v, ok := s.Int(t, key, value, 32); ok {
+			x.Count = int32(v)
+		}
+		return goj.Continue
+	case "score":
+		if v, ok := s.Float(t, key, value, 64); ok {
+			x.Score = v
+		}
+		return goj.Continue
+	case "ratio":
+		if t == goj.Null {
+			x.Ratio = nil
+			return goj.Continue
+		}
+		if x.Ratio == nil {
+			x.Ratio = new(float32)
+		}
+		if v, ok := s.Float(t, key, value, 32); ok {
+			*x.Ratio = float32(v)
+		}
+		return goj.Continue
+	case "enabled":
+		if v, ok := s.Bool(t, key, value); ok {
+			x.Enabled = v
+		}
+		return goj.Continue
+	case "small":
+		if v, ok := s.Uint(t, key, value, 8); ok {
+			x.Small = uint8(v)
+		}
+		return goj.Continue
+	case "tags":
+		if t == goj.Null {
+			x.Tags = nil
+			return goj.Continue
+		}
+		if t != goj.Array {
+			s.TypeError(t, key, &x.Tags)
+			return goj.Skip
+		}
+		if x.Tags == nil {
+			x.Tags = genTags{}
+		} else {
+			x.Tags = x.Tags[:0]
+		}
+		s.Push((*gojSliceString)(&x.Tags))
+		return goj.Continue
+	case "matrix":
+		if t == goj.Null {
+			x.Matrix = nil
+			return goj.Continue
+		}
+		if t != goj.Array {
+			s.TypeError(t, key, &x.Matrix)
+			return goj.Skip
+		}
+		if x.Matrix == nil {
+			x.Matrix = [][]int{}
+		} else {
+			x.Matrix = x.Matrix[:0]
+		}
+		s.Push((*gojSliceSliceInt)(&x.Matrix))
+		return goj.Continue
+	case "children":
+		if t == goj.Null {
+			x.Children = nil
+			return goj.Continue
+		}
+		if t != goj.Array {
+			s.TypeError(t, key, &x.Children)
+			return goj.Skip
+		}
+		if x.Children == nil {
+			x.Children = []*genEvent{}
+		} else {
+			x.Children = x.Children[:0]
+		}
+		s.Push((*gojSlicePtrGenEvent)(&x.Children))
+		return goj.Continue
+	case "siblings":
+		if t == goj.Null {
+			x.Siblings = nil
+			return goj.Continue
+		}
+		if t != goj.Array {
+			s.TypeError(t, key, &x.Siblings)
+			return goj.Skip
+		}
+		if x.Siblings == nil {
+			x.Siblings = []GenAuthor{}
+		} else {
+			x.Siblings = x.Siblings[:0]
+		}
+		s.Push((*gojSliceGenAuthor)(&x.Siblings))
+		return goj.Continue
+	case "counts":
+		if t == goj.Null {
+			x.Counts = nil
+			return goj.Continue
+		}
+		if t != goj.Object {
+			s.TypeError(t, key, (*map[string]int)(nil))
+			return goj.Skip
+		}
+		if x.Counts == nil {
+			x.Counts = make(map[string]int)
+		}
+		s.Push(gojMapStringInt(x.Counts))
+		return goj.Continue
+	case "authors":
+		if t == goj.Null {
+			x.Authors = nil
+			return goj.Continue
+		}
+		if t != goj.Object {
+			s.TypeError(t, key, (*map[string]*GenAuthor)(nil))
+			return goj.Skip
+		}
+		if x.Authors == nil {
+			x.Authors = make(map[string]*GenAuthor)
+		}
+		s.Push(gojMapStringPtrGenAuthor(x.Authors))
+		return goj.Continue
+	case "extra":
+		return s.Fallback(&x.Extra, t, value)
+	case "raw":
+		return s.Fallback(&x.Raw, t, value)
+	case "fixed":
+		return s.Fallback(&x.Fixed, t, value)
+	case "id":
+		if v, ok := s.Int(t, key, value, 64); ok {
+			x.GenBase.ID = v
+		}
+		return goj.Continue
+	case "Created":
+		return s.Fallback(&x.GenBase.Created, t, value)
+	}
+	if k, ok := s.Fold(key, gojFieldsGenEvent); ok {
+		return x.GojMember(s, t, k, value)
+	}
+	return goj.Skip
+}
+
+var gojFieldsGenEvent = [][]byte{[]byte("author"), []byte("kind"), []byte("count"), []byte("score"), []byte("ratio"), []byte("enabled"), []byte("small"), []byte("tags"), []byte("matrix"), []byte("children"), []byte("siblings"), []byte("counts"), []byte("authors"), []byte("extra"), []byte("raw"), []byte("fixed"), []byte("id"), []byte("Created")}
+
+// DecodeGoj decodes the JSON object in buf into x.
+func (x *genCodeResponse) DecodeGoj(buf []byte) error {
+	return goj.DecodeObject(buf, x)
+}
+
+// GojMember decodes a member of a JSON object into x.  It implements
+// goj.Frame.
+func (x *genCodeResponse) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	switch string(key) {
+	case "tree":
+		if t == goj.Null {
+			x.Tree = nil
+			return goj.Continue
+		}
+		if t != goj.Object {
+			s.TypeError(t, key, (*genCodeNode)(nil))
+			return goj.Skip
+		}
+		if x.Tree == nil {
+			x.Tree = new(genCodeNode)
+		}
+		s.Push(x.Tree)
+		return goj.Continue
+	case "username":
+		if v, ok := s.String(t, key, value); ok {
+			x.Username = v
+		}
+		return goj.Continue
+	}
+	if k, ok := s.Fold(key, gojFieldsGenCodeResponse); ok {
+		return x.GojMember(s, t, k, value)
+	}
+	return goj.Skip
+}
+
+var gojFieldsGenCodeResponse = [][]byte{[]byte("tree"), []byte("username")}
+
+// DecodeGoj decodes the JSON object in buf into x.
+func (x *genCodeNode) DecodeGoj(buf []byte) error {
+	return goj.DecodeObject(buf, x)
+}
+
+// GojMember decodes a member of a JSON object into x.  It implements
+// goj.Frame.
+func (x *genCodeNode) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	switch string(key) {
+	case "name":
+		if v, ok := s.String(t, key, value); ok {
+			x.Name = v
+		}
+		return goj.Continue
+	case "kids":
+		if t == goj.Null {
+			x.Kids = nil
+			return goj.Continue
+		}
+		if t != goj.Array {
+			s.TypeError(t, key, &x.Kids)
+			return goj.Skip
+		}
+		if x.Kids == nil {
+			x.Kids = []*genCodeNode{}
+		} else {
+			x.Kids = x.Kids[:0]
+		}
+		s.Push((*gojSlicePtrGenCodeNode)(&x.Kids))
+		return goj.Continue
+	case "cl_weight":
+		if v, ok := s.Float(t, key, value, 64); ok {
+			x.CLWeight = v
+		}
+		return goj.Continue
+	case "touches":
+		if v, ok := s.Int(t, key, value, 0); ok {
+			x.Touches = int(v)
+		}
+		return goj.Continue
+	case "min_t":
+		if v, ok := s.Int(t, key, value, 64); ok {
+			x.MinT = v
+		}
+		return goj.Continue
+	case "max_t":
+		if v, ok := s.Int(t, key, value, 64); ok {
+			x.MaxT = v
+		}
+		return goj.Continue
+	case "mean_t":
+		if v, ok := s.Int(t, key, value, 64); ok {
+			x.MeanT = v
+		}
+		return goj.Continue
+	}
+	if k, ok := s.Fold(key, gojFieldsGenCodeNode); ok {
+		return x.GojMember(s, t, k, value)
+	}
+	return goj.Skip
+}
+
+var gojFieldsGenCodeNode = [][]byte{[]byte("name"), []byte("kids"), []byte("cl_weight"), []byte("touches"), []byte("min_t"), []byte("max_t"), []byte("mean_t")}
+
+// gojSliceString decodes the elements of a []string.
+type gojSliceString []string
+
+func (x *gojSliceString) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	var e string
+	i := len(*x)
+	*x = append(*x, e)
+	if v, ok := s.String(t, key, value); ok {
+		(*x)[i] = v
+	}
+	return goj.Continue
+}
+
+// gojSliceInt decodes the elements of a []int.
+type gojSliceInt []int
+
+func (x *gojSliceInt) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	var e int
+	i := len(*x)
+	*x = append(*x, e)
+	if v, ok := s.Int(t, key, value, 0); ok {
+		(*x)[i] = int(v)
+	}
+	return goj.Continue
+}
+
+// gojSliceSliceInt decodes the elements of a [][]int.
+type gojSliceSliceInt [][]int
+
+func (x *gojSliceSliceInt) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	var e []int
+	i := len(*x)
+	*x = append(*x, e)
+	if t == goj.Null {
+		(*x)[i] = nil
+		return goj.Continue
+	}
+	if t != goj.Array {
+		s.TypeError(t, key, &(*x)[i])
+		return goj.Skip
+	}
+	if (*x)[i] == nil {
+		(*x)[i] = []int{}
+	} else {
+		(*x)[i] = (*x)[i][:0]
+	}
+	s.Push((*gojSliceInt)(&(*x)[i]))
+	return goj.Continue
+}
+
+// gojSlicePtrGenEvent decodes the elements of a []*genEvent.
+type gojSlicePtrGenEvent []*genEvent
+
+func (x *gojSlicePtrGenEvent) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	var e *genEvent
+	i := len(*x)
+	*x = append(*x, e)
+	if t == goj.Null {
+		(*x)[i] = nil
+		return goj.Continue
+	}
+	if t != goj.Object {
+		s.TypeError(t, key, (*genEvent)(nil))
+		return goj.Skip
+	}
+	if (*x)[i] == nil {
+		(*x)[i] = new(genEvent)
+	}
+	s.Push((*x)[i])
+	return goj.Continue
+}
+
+// gojSliceGenAuthor decodes the elements of a []GenAuthor.
+type gojSliceGenAuthor []GenAuthor
+
+func (x *gojSliceGenAuthor) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	var e GenAuthor
+	i := len(*x)
+	*x = append(*x, e)
+	if t == goj.Null {
+		return goj.Continue
+	}
+	if t != goj.Object {
+		s.TypeError(t, key, (*GenAuthor)(nil))
+		return goj.Skip
+	}
+	s.Push(&(*x)[i])
+	return goj.Continue
+}
+
+// gojMapStringInt decodes the members of a map[string]int.
+type gojMapStringInt map[string]int
+
+func (x gojMapStringInt) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	if v, ok := s.Int(t, key, value, 0); ok {
+		x[string(key)] = int(v)
+	}
+	return goj.Continue
+}
+
+// gojMapStringPtrGenAuthor decodes the members of a map[string]*GenAuthor.
+type gojMapStringPtrGenAuthor map[string]*GenAuthor
+
+func (x gojMapStringPtrGenAuthor) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	if t == goj.Null {
+		x[string(key)] = nil
+		return goj.Continue
+	}
+	if t != goj.Object {
+		s.TypeError(t, key, (*GenAuthor)(nil))
+		return goj.Skip
+	}
+	if x[string(key)] == nil {
+		x[string(key)] = new(GenAuthor)
+	}
+	s.Push(x[string(key)])
+	return goj.Continue
+}
+
+// gojSlicePtrGenCodeNode decodes the elements of a []*genCodeNode.
+type gojSlicePtrGenCodeNode []*genCodeNode
+
+func (x *gojSlicePtrGenCodeNode) GojMember(s *goj.Frames, t goj.Type, key []byte, value []byte) goj.Action {
+	var e *genCodeNode
+	i := len(*x)
+	*x = append(*x, e)
+	if t == goj.Null {
+		(*x)[i] = nil
+		return goj.Continue
+	}
+	if t != goj.Object {
+		s.TypeError(t, key, (*genCodeNode)(nil))
+		return goj.Skip
+	}
+	if (*x)[i] == nil {
+		(*x)[i] = new(genCodeNode)
+	}
+	s.Push((*x)[i])
+	return goj.Continue
+}
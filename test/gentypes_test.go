@@ -0,0 +1,59 @@
+package test
+
+import "time"
+
+//go:generate go run ../cmd/gojgen gentypes_test.go
+
+// Types for the generated decoder tests.  gentypes_goj_test.go is generated
+// from this file, re-run `go generate` after changing it.
+
+type genStatus string
+
+type genTags []string
+
+type GenBase struct {
+	ID      int64 `json:"id"`
+	Created time.Time
+}
+
+type GenAuthor struct {
+	Name  string `json:"name"`
+	Email *string
+}
+
+type genEvent struct {
+	GenBase
+	*GenAuthor `json:"author"`
+	Kind       genStatus             `json:"kind"`
+	Count      int32                 `json:"count,string"`
+	Score      float64               `json:"score"`
+	Ratio      *float32              `json:"ratio"`
+	Enabled    bool                  `json:"enabled"`
+	Small      uint8                 `json:"small"`
+	Tags       genTags               `json:"tags"`
+	Matrix     [][]int               `json:"matrix"`
+	Children   []*genEvent           `json:"children"`
+	Siblings   []GenAuthor           `json:"siblings"`
+	Counts     map[string]int        `json:"counts"`
+	Authors    map[string]*GenAuthor `json:"authors"`
+	Extra      interface{}           `json:"extra"`
+	Raw        []byte                `json:"raw"`
+	Fixed      [2]string             `json:"fixed"`
+	Skipped    string                `json:"-"`
+	hidden     int
+}
+
+type genCodeResponse struct {
+	Tree     *genCodeNode `json:"tree"`
+	Username string       `json:"username"`
+}
+
+type genCodeNode struct {
+	Name     string         `json:"name"`
+	Kids     []*genCodeNode `json:"kids"`
+	CLWeight float64        `json:"cl_weight"`
+	Touches  int            `json:"touches"`
+	MinT     int64          `json:"min_t"`
+	MaxT     int64          `json:"max_t"`
+	MeanT    int64          `json:"mean_t"`
+}
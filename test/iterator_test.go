@@ -0,0 +1,212 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+func testIterate(json string) (results string) {
+	it := goj.NewIterator([]byte(json))
+	for {
+		t, k, v, err := it.Next()
+		if err == io.EOF {
+			return results
+		} else if err != nil {
+			return results + fmt.Sprintf("parse error: %s\n", err)
+		}
+		results += formatEvent(t, k, v)
+	}
+}
+
+// The iterator must produce exactly the events Parse does
+func TestIterator(t *testing.T) {
+	for _, c := range getTests() {
+		want := strings.TrimRight(c.gold, "\n")
+		got := strings.TrimRight(testIterate(c.json), "\n")
+		if got != want {
+			t.Errorf("%s:\nwant:\n%s\ngot:\n%s\n", c.name, want, got)
+		}
+	}
+}
+
+type iterPoint struct {
+	X, Y float64
+}
+
+type iterShape struct {
+	Name   string
+	Points []iterPoint
+	Kids   []iterShape
+}
+
+// readShape shows the recursive style the iterator allows
+func readShape(it *goj.Iterator) (s iterShape, err error) {
+	for {
+		t, k, v, err := it.Next()
+		if err != nil || t == goj.ObjectEnd {
+			return s, err
+		}
+		switch string(k) {
+		case "name":
+			s.Name = string(v)
+		case "points":
+			for {
+				if t, _, _, err = it.Next(); err != nil || t == goj.ArrayEnd {
+					break
+				}
+				var p iterPoint
+				for {
+					t, k, v, err := it.Next()
+					if err != nil || t == goj.ObjectEnd {
+						break
+					}
+					f, _ := strconv.ParseFloat(string(v), 64)
+					if string(k) == "x" {
+						p.X = f
+					} else {
+						p.Y = f
+					}
+				}
+				s.Points = append(s.Points, p)
+			}
+		case "kids":
+			for {
+				if t, _, _, err = it.Next(); err != nil || t == goj.ArrayEnd {
+					break
+				}
+				kid, err := readShape(it)
+				if err != nil {
+					return s, err
+				}
+				s.Kids = append(s.Kids, kid)
+			}
+		default:
+			if _, err := it.SkipValue(); err != nil {
+				return s, err
+			}
+		}
+		if err != nil {
+			return s, err
+		}
+	}
+}
+
+func TestIteratorRecursive(t *testing.T) {
+	doc := `{"name": "root", "ignored": {"deep": [1, {"x": 2}]}, "points": [{"x": 1, "y": 2}],
+		"kids": [{"name": "a", "kids": [], "extra": [[], {}]}, {"points": [{"y": -1.5}], "name": "b"}]}`
+	it := goj.NewIterator([]byte(doc))
+	if _, _, _, err := it.Next(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := readShape(it)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{root [{1 2}] [{a [] []} {b [{0 -1.5}] []}]}"
+	if got := fmt.Sprint(s); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if _, _, _, err := it.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestIteratorSkipAndDepth(t *testing.T) {
+	it := goj.NewIterator([]byte(`[1, {"a": [2, 3]}, [4], 5]`))
+	var depths []int
+	var skipped []string
+	for {
+		ty, _, _, err := it.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		depths = append(depths, it.Depth())
+		if ty == goj.Object || (ty == goj.Array && it.Depth() > 1) {
+			raw, err := it.SkipValue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			skipped = append(skipped, string(raw))
+			depths = append(depths, it.Depth())
+		}
+	}
+	if got := fmt.Sprint(depths); got != "[1 1 2 1 2 1 1 0]" {
+		t.Errorf("unexpected depths %s", got)
+	}
+	if got := strings.Join(skipped, " "); got != `{"a": [2, 3]} [4]` {
+		t.Errorf("unexpected skipped values %s", got)
+	}
+	if raw, err := it.SkipValue(); raw != nil || err != io.EOF {
+		t.Errorf("expected EOF, got %q %v", raw, err)
+	}
+
+	it.Reset([]byte(`{"a": [1, 2}`))
+	var err error
+	for err == nil {
+		_, _, _, err = it.Next()
+	}
+	if err == io.EOF {
+		t.Errorf("expected a syntax error")
+	}
+	if _, _, _, again := it.Next(); again != err {
+		t.Errorf("expected the error to persist, got %v", again)
+	}
+}
+
+// Skipping a truncated container must fail rather than run off the buffer
+func TestSkipTruncated(t *testing.T) {
+	for _, doc := range []string{`[{"a": [1, 2}`, `[[1, 2`, `{"a": {"b": "c"`, `[{"a": "]}`} {
+		err := goj.NewParser().Parse([]byte(doc), func(t goj.Type, k []byte, v []byte) goj.Action {
+			if t == goj.Object || (t == goj.Array && k != nil) {
+				return goj.Skip
+			}
+			return goj.Continue
+		})
+		if err == nil {
+			t.Errorf("%q: expected an error", doc)
+		}
+	}
+}
+
+func TestOffsets(t *testing.T) {
+	doc := `{"a": [1, "x\ty"], "b": {"c": null}, "d": true}`
+	var got []string
+	p := goj.NewParser()
+	err := p.Parse([]byte(doc), func(ty goj.Type, k []byte, v []byte) goj.Action {
+		start, end := p.Offset()
+		s := doc[start:end]
+		if k != nil {
+			ks, ke := p.KeyOffset()
+			s = doc[ks:ke] + " " + s
+		}
+		got = append(got, s)
+		if string(k) == "b" {
+			return goj.Skip
+		}
+		return goj.Continue
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`{`, `"a" [`, `1`, `"x\ty"`, `]`, `"b" {`, `{"c": null}`, `"d" true`, `}`}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("want %q\ngot  %q", want, got)
+	}
+
+	it := goj.NewIterator([]byte(doc))
+	it.Next()
+	it.Next()
+	if _, err := it.SkipValue(); err != nil {
+		t.Fatal(err)
+	}
+	if start, end := it.Offset(); doc[start:end] != `[1, "x\ty"]` {
+		t.Errorf("unexpected offsets %d %d", start, end)
+	}
+}
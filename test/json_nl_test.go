@@ -0,0 +1,42 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+// Once the callback cancels, or a line fails to parse, ReadJSONNL returns
+// and the callback is not called again, for that line or any other.
+func TestReadJSONNLStops(t *testing.T) {
+	input := "[1, 2]\n[3, 4]\n[5, 6]\n"
+	for cancelLine := int64(0); cancelLine < 3; cancelLine++ {
+		calls := 0
+		err := goj.ReadJSONNL(strings.NewReader(input), func(typ goj.Type, k []byte, v []byte, line int64) bool {
+			calls++
+			if line > cancelLine {
+				t.Errorf("cancelled on line %d, called on line %d", cancelLine, line)
+			}
+			return line != cancelLine
+		})
+		if err != goj.ClientCancelledParse {
+			t.Errorf("cancelled on line %d: got %v", cancelLine, err)
+		}
+		if want := int(cancelLine)*4 + 1; calls != want {
+			t.Errorf("cancelled on line %d: %d calls, want %d", cancelLine, calls, want)
+		}
+	}
+
+	var events []string
+	err := goj.ReadJSONNL(strings.NewReader("[1]\n[2, }\n[3]\n"), func(typ goj.Type, k []byte, v []byte, line int64) bool {
+		events = append(events, formatEvent(typ, k, v))
+		return true
+	})
+	if err == nil {
+		t.Error("expected a parse error")
+	}
+	if got := strings.Join(events, ""); got != "array open '['\ninteger: 1\narray close ']'\narray open '['\ninteger: 2\n" {
+		t.Errorf("unexpected events\n%s", got)
+	}
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+func TestBigNumberFlag(t *testing.T) {
+	cases := []struct {
+		json string
+		want goj.Type
+	}{
+		{"18446744073709551615", goj.Integer},
+		{"18446744073709551616", goj.Integer | goj.Big},
+		{"-9223372036854775808", goj.NegInteger},
+		{"-9223372036854775809", goj.NegInteger | goj.Big},
+		{"0.1", goj.Float},
+		{"1e308", goj.Float},
+		{"1e400", goj.Float | goj.Big},
+		{"1e-400", goj.Float | goj.Big},
+		{"0.30000000000000004", goj.Float},
+		{"12345678901234567890.12345", goj.Float | goj.Big},
+		{"1.0000000000000000000000001", goj.Float | goj.Big},
+	}
+
+	parser := goj.NewParser()
+	parser.SetBigNumbers(true)
+	for _, c := range cases {
+		var got goj.Type
+		err := parser.Parse([]byte(c.json), func(t goj.Type, k []byte, v []byte) goj.Action {
+			got = t
+			return goj.Continue
+		})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.json, err)
+		} else if got != c.want {
+			t.Errorf("%s: got %s, want %s", c.json, got, c.want)
+		}
+	}
+}
+
+func TestBigNumberHelpers(t *testing.T) {
+	i, err := goj.ParseBigInt([]byte("-123456789012345678901234567890"))
+	if err != nil || i.String() != "-123456789012345678901234567890" {
+		t.Errorf("ParseBigInt: got %v, %v", i, err)
+	}
+
+	r, err := goj.ParseBigRat([]byte("1234.5678e-2"))
+	if err != nil || r.Cmp(big.NewRat(12345678, 1000000)) != 0 {
+		t.Errorf("ParseBigRat: got %v, %v", r, err)
+	}
+
+	f, err := goj.ParseBigFloat([]byte("123456789012345678901234567890"), 0)
+	if err != nil || f.Text('f', 0) != "123456789012345678901234567890" {
+		t.Errorf("ParseBigFloat: got %v, %v", f, err)
+	}
+
+	for _, bogus := range []string{"", "-", "0x10", "1_000", "Inf", "1.", "01", ".5"} {
+		if _, err := goj.ParseBigRat([]byte(bogus)); err == nil {
+			t.Errorf("ParseBigRat(%q): expected error", bogus)
+		}
+		if _, err := goj.ParseBigFloat([]byte(bogus), 0); err == nil {
+			t.Errorf("ParseBigFloat(%q): expected error", bogus)
+		}
+	}
+}
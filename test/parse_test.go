@@ -103,37 +103,38 @@ func getTests() []*parseTestCase {
 	return qSlice
 }
 
+// formatEvent renders a parse event the way the .gold files do
+func formatEvent(t goj.Type, k []byte, v []byte) (results string) {
+	if len(k) > 0 {
+		results += fmt.Sprintf("key: '%s'\n", string(k))
+	}
+	switch t {
+	case goj.True:
+		results += "bool: true\n"
+	case goj.False:
+		results += "bool: false\n"
+	case goj.Null:
+		results += "null\n"
+	case goj.String:
+		results += fmt.Sprintf("string: '%s'\n", v)
+	case goj.Array:
+		results += "array open '['\n"
+	case goj.Object:
+		results += "map open '{'\n"
+	case goj.Integer, goj.NegInteger, goj.Float:
+		results += fmt.Sprintf("%s: %s\n", t.String(), v)
+	case goj.ArrayEnd:
+		results += "array close ']'\n"
+	case goj.ObjectEnd:
+		results += "map close '}'\n"
+	}
+	return results
+}
+
 func testParse(json string) (results string) {
-	var stack []bool
 	parser := goj.NewParser()
 	err := parser.Parse([]byte(json), func(t goj.Type, k []byte, v []byte) goj.Action {
-		if len(k) > 0 {
-			results += fmt.Sprintf("key: '%s'\n", string(k))
-		}
-		switch t {
-		case goj.True:
-			results += "bool: true\n"
-		case goj.False:
-			results += "bool: false\n"
-		case goj.Null:
-			results += "null\n"
-		case goj.String:
-			results += fmt.Sprintf("string: '%s'\n", v)
-		case goj.Array:
-			results += "array open '['\n"
-			stack = append(stack, true)
-		case goj.Object:
-			results += "map open '{'\n"
-			stack = append(stack, false)
-		case goj.Integer, goj.NegInteger, goj.Float:
-			results += fmt.Sprintf("%s: %s\n", t.String(), v)
-		case goj.ArrayEnd:
-			stack = stack[:len(stack)-1]
-			results += "array close ']'\n"
-		case goj.ObjectEnd:
-			stack = stack[:len(stack)-1]
-			results += "map close '}'\n"
-		}
+		results += formatEvent(t, k, v)
 		return goj.Continue
 	})
 	if err != nil {
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+// Without a filter, re-encoding is the same as compacting
+func TestReencodeCompacts(t *testing.T) {
+	files, _ := filepath.Glob("cases/*.json")
+	files = append(files, "code.json")
+	for _, f := range files {
+		buf, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want bytes.Buffer
+		if json.Compact(&want, buf) != nil || bytes.Contains(buf, []byte(`\u`)) || bytes.Contains(buf, []byte(`\/`)) {
+			// invalid, or escapes are written differently
+			continue
+		}
+		w := goj.NewWriter(nil)
+		if err := goj.Reencode(buf, w, nil); err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		if !bytes.Equal(want.Bytes(), w.Bytes()) {
+			t.Errorf("%s:\nwant %.200s\ngot  %.200s", f, want.Bytes(), w.Bytes())
+		}
+	}
+}
+
+func TestReencodeFilter(t *testing.T) {
+	doc := `{"id": 1, "password": "secret", "profile": {"password": {"hash": [1, 2]}, "name": "bob"},
+		"tags": ["a", "b"], "count": 2.5e3, "meta": {"id": 7}}`
+	var r *goj.Reencoder
+	w := goj.NewWriter(nil)
+	w.SetValidate(true)
+	r = goj.NewReencoder(w, func(t goj.Type, k []byte, v []byte) (goj.Type, []byte, []byte, goj.Action) {
+		switch {
+		case string(k) == "password":
+			return t, k, v, goj.Skip
+		case string(k) == "id" && r.Depth() == 1:
+			return t, []byte("ID"), v, goj.Continue
+		case t == goj.String:
+			return t, k, bytes.ToUpper(v), goj.Continue
+		case string(k) == "count":
+			return goj.String, k, v, goj.Continue
+		}
+		return t, k, v, goj.Continue
+	})
+	if err := goj.NewParser().Parse([]byte(doc), r.Callback); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"ID":1,"profile":{"name":"BOB"},"tags":["A","B"],"count":"2.5e3","meta":{"id":7}}`
+	if got := string(w.Bytes()); got != want {
+		t.Errorf("\nwant %s\ngot  %s", want, got)
+	}
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestReencodeErrors(t *testing.T) {
+	w := goj.NewWriter(nil)
+	err := goj.Reencode([]byte(`[1, 2, 3]`), w, func(t goj.Type, k []byte, v []byte) (goj.Type, []byte, []byte, goj.Action) {
+		if string(v) == "2" {
+			return t, k, v, goj.Cancel
+		}
+		return t, k, v, goj.Continue
+	})
+	if err != goj.ClientCancelledParse || string(w.Bytes()) != "[1" {
+		t.Errorf("expected a cancelled parse, got %v, %q", err, w.Bytes())
+	}
+
+	w = goj.NewWriter(failingWriter{})
+	big := "[" + strings.Repeat(`"abcdefghijklmnopqrstuvwxyz",`, 1000) + "0]"
+	if err := goj.Reencode([]byte(big), w, nil); err == nil || err.Error() != "disk full" {
+		t.Errorf("expected the write error, got %v", err)
+	}
+
+	w = goj.NewWriter(nil)
+	w.SetValidate(true)
+	err = goj.Reencode([]byte(`{"a": 1}`), w, func(t goj.Type, k []byte, v []byte) (goj.Type, []byte, []byte, goj.Action) {
+		return t, nil, v, goj.Continue
+	})
+	if err == nil || err == goj.ClientCancelledParse {
+		t.Errorf("expected a validation error for a missing key, got %v", err)
+	}
+}
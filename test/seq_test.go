@@ -0,0 +1,240 @@
+//go:build go1.23
+// +build go1.23
+
+package test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/lloyd/goj"
+)
+
+func TestEvents(t *testing.T) {
+	for _, c := range getTests() {
+		results := ""
+		for ev, err := range goj.Events([]byte(c.json)) {
+			if err != nil {
+				results += fmt.Sprintf("parse error: %s\n", err)
+				break
+			}
+			results += formatEvent(ev.Type, ev.Key, ev.Value)
+		}
+		if got, want := strings.TrimRight(results, "\n"), strings.TrimRight(c.gold, "\n"); got != want {
+			t.Errorf("%s:\nwant:\n%s\ngot:\n%s\n", c.name, want, got)
+		}
+	}
+
+	n := 0
+	for ev := range goj.Events([]byte(`[[1], 2, 3]`)) {
+		if n++; ev.Depth != n {
+			t.Errorf("unexpected depth %d for %v", ev.Depth, ev.Type)
+		}
+		if ev.Depth == 2 {
+			break
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	long := `{"name": "` + strings.Repeat("x", 5<<20) + `"}`
+	input := "{\"name\": \"a\", \"kids\": [{\"name\": \"nested\"}]}\r\n\n  \n[1, 2]\n" + long + "\n{\"name\": \"b\"}"
+	var names []string
+	var lines []int64
+	for rec, err := range goj.Lines(iotest.HalfReader(strings.NewReader(input))) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, rec.Line)
+		if rec.Raw[0] != '{' {
+			continue
+		}
+		var v struct {
+			Name string `json:"name"`
+		}
+		if err := rec.Unmarshal(&v); err != nil {
+			t.Fatal(err)
+		}
+		for ev, err := range rec.Events() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev.Depth == 1 && string(ev.Key) == "name" && string(ev.Value) != v.Name {
+				t.Errorf("line %d: Events and Unmarshal disagree", rec.Line)
+			}
+		}
+		names = append(names, fmt.Sprint(len(v.Name)))
+	}
+	if got := fmt.Sprint(lines); got != "[0 3 4 5]" {
+		t.Errorf("unexpected line offsets %s", got)
+	}
+	if got := strings.Join(names, " "); got != fmt.Sprintf("1 %d 1", 5<<20) {
+		t.Errorf("unexpected names %s", got)
+	}
+
+	readErr := errors.New("broken")
+	var got []string
+	for rec, err := range goj.Lines(io.MultiReader(strings.NewReader("{}\n"), iotest.ErrReader(readErr))) {
+		if err != nil {
+			got = append(got, err.Error())
+		} else {
+			got = append(got, string(rec.Raw))
+		}
+	}
+	if fmt.Sprint(got) != "[{} broken]" {
+		t.Errorf("unexpected records %q", got)
+	}
+}
+
+// LinesFile yields what Lines does.
+func TestLinesFile(t *testing.T) {
+	input := "{\"name\": \"a\"}\r\n\n  \n[1, 2]\n\"last\""
+	lines := func(seq iter.Seq2[goj.Record, error]) string {
+		var got []string
+		for rec, err := range seq {
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, fmt.Sprintf("%d:%s", rec.Line, rec.Raw))
+		}
+		return strings.Join(got, " ")
+	}
+	path := filepath.Join(t.TempDir(), "lines.ndjson")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := lines(goj.Lines(strings.NewReader(input)))
+	if got := lines(goj.LinesFile(path)); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	var errs []error
+	for _, err := range goj.LinesFile(filepath.Join(t.TempDir(), "missing.ndjson")) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], fs.ErrNotExist) {
+		t.Errorf("got %v, want a missing file", errs)
+	}
+}
+
+func TestNodeChildren(t *testing.T) {
+	tape := goj.NewTape()
+	if err := tape.Parse([]byte(`{"a": [1, [2, 3], 4], "b": {"c": "d"}, "e": []}`)); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for c := range tape.Root().Children() {
+		got = append(got, string(c.Key())+"="+string(c.Raw()))
+		for cc := range c.Children() {
+			got = append(got, string(cc.Raw()))
+			if cc.Type() == goj.Array {
+				break
+			}
+		}
+	}
+	if s := strings.Join(got, " "); s != `a=[1, [2, 3], 4] 1 [2, 3] b={"c": "d"} "d" e=[]` {
+		t.Errorf("unexpected children %s", s)
+	}
+}
+
+// walkDoc renders the value d and its contents as the .gold files do.
+func walkDoc(key []byte, d goj.Doc) (string, error) {
+	typ, err := d.Type()
+	if err != nil {
+		return "", err
+	}
+	v, err := d.Value()
+	if err != nil {
+		return "", err
+	}
+	results := formatEvent(typ, key, v)
+	switch typ {
+	case goj.Object:
+		for k, m := range d.Members() {
+			s, err := walkDoc(k, m)
+			if err != nil {
+				return "", err
+			}
+			results += s
+		}
+		results += formatEvent(goj.ObjectEnd, nil, nil)
+	case goj.Array:
+		for _, e := range d.Elements() {
+			s, err := walkDoc(nil, e)
+			if err != nil {
+				return "", err
+			}
+			results += s
+		}
+		results += formatEvent(goj.ArrayEnd, nil, nil)
+	}
+	return results, nil
+}
+
+// A Doc read from end to end holds what the Parser reports.
+func TestDocCases(t *testing.T) {
+	for _, c := range getTests() {
+		want := ""
+		err := goj.NewParser().Parse([]byte(c.json), func(t goj.Type, k []byte, v []byte) goj.Action {
+			want += formatEvent(t, k, v)
+			return goj.Continue
+		})
+		if err != nil || want == "" {
+			continue
+		}
+		got, err := walkDoc(nil, goj.NewDoc([]byte(c.json)))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if got != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, got, want)
+		}
+	}
+}
+
+func TestDocMembers(t *testing.T) {
+	doc := goj.NewDoc([]byte(`{"a": 1, "b": [true, null], "c": {}} `))
+	var got []string
+	for k, v := range doc.Members() {
+		raw, _ := v.Raw()
+		got = append(got, string(k)+"="+string(raw))
+		if typ, _ := v.Type(); typ != goj.Array {
+			continue
+		}
+		for i, e := range v.Elements() {
+			raw, _ := e.Raw()
+			got = append(got, fmt.Sprint(i, "=", string(raw)))
+			break
+		}
+	}
+	if s := strings.Join(got, " "); s != "a=1 b=[true, null] 0=true c={}" {
+		t.Errorf("unexpected members %s", s)
+	}
+
+	var errs []string
+	for i, e := range goj.NewDoc([]byte(`[1, 2`)).Elements() {
+		if err := e.Err(); err != nil {
+			errs = append(errs, fmt.Sprint(i, " ", err))
+		}
+	}
+	if fmt.Sprint(errs) != "[-1 premature EOF]" {
+		t.Errorf("unexpected errors %q", errs)
+	}
+	errs = nil
+	for k, v := range goj.NewDoc([]byte(`[]`)).Members() {
+		if k != nil || v.Err() == nil {
+			t.Errorf("unexpected member %q", k)
+		} else {
+			errs = append(errs, v.Err().Error())
+		}
+	}
+	if fmt.Sprint(errs) != "[expected object, found array]" {
+		t.Errorf("unexpected errors %q", errs)
+	}
+}
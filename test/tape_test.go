@@ -0,0 +1,194 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+// walkTape renders the value n and its contents as the .gold files do.
+func walkTape(n goj.Node) string {
+	results := formatEvent(n.Type(), n.Key(), n.Value())
+	switch n.Type() {
+	case goj.Object, goj.Array:
+		for c, ok := n.First(); ok; c, ok = c.Next() {
+			results += walkTape(c)
+		}
+		if n.Type() == goj.Object {
+			results += formatEvent(goj.ObjectEnd, nil, nil)
+		} else {
+			results += formatEvent(goj.ArrayEnd, nil, nil)
+		}
+	}
+	return results
+}
+
+// A Tape holds what the Parser reports, and fails as it does.
+func TestTapeCases(t *testing.T) {
+	tape := goj.NewTape()
+	for _, c := range getTests() {
+		want := ""
+		p := goj.NewParser()
+		perr := p.Parse([]byte(c.json), func(t goj.Type, k []byte, v []byte) goj.Action {
+			want += formatEvent(t, k, v)
+			return goj.Continue
+		})
+		for _, e := range []goj.Engine{goj.StateMachine, goj.Indexed} {
+			tape.SetEngine(e)
+			err := tape.Parse([]byte(c.json))
+			if perr == nil && want == "" {
+				// the Parser accepts a document without a value
+				if err == nil {
+					t.Errorf("%s, %s: empty document parsed", c.name, e)
+				}
+				continue
+			}
+			if fmt.Sprint(err) != fmt.Sprint(perr) {
+				t.Errorf("%s, %s: got error %v, want %v", c.name, e, err, perr)
+			}
+			if err != nil {
+				continue
+			}
+			if got := walkTape(tape.Root()); got != want {
+				t.Errorf("%s, %s: got\n%s\nwant\n%s", c.name, e, got, want)
+			}
+		}
+	}
+}
+
+func TestTapeGet(t *testing.T) {
+	doc := []byte(`{"a": {"b": [10, -2, 3.5, {"c": null}]}, "d/e": true, "f~g": false,
+		"hé": "w\"x", "": "empty", "a": "again", "i": [], "j": {}}`)
+	tape := goj.NewTape()
+	if err := tape.Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"", string(doc)},
+		{"/a", `{"b": [10, -2, 3.5, {"c": null}]}`},
+		{"/a/b", `[10, -2, 3.5, {"c": null}]`},
+		{"/a/b/0", `10`},
+		{"/a/b/1", `-2`},
+		{"/a/b/2", `3.5`},
+		{"/a/b/3/c", `null`},
+		{"/d~1e", `true`},
+		{"/f~0g", `false`},
+		{"/hé", `"w\"x"`},
+		{"/", `"empty"`},
+		{"/i", `[]`},
+		{"/j", `{}`},
+		{"a", ""},
+		{"/a/b/4", ""},
+		{"/a/b/-1", ""},
+		{"/a/b/+1", ""},
+		{"/a/b/01", ""},
+		{"/a/b/-", ""},
+		{"/a/b/0/x", ""},
+		{"/a/c", ""},
+		{"/i/0", ""},
+		{"/j/k", ""},
+		{"/d/e", ""},
+	}
+	for _, c := range cases {
+		n, ok := tape.Get(c.path)
+		if !ok {
+			if c.want != "" {
+				t.Errorf("%q: not found", c.path)
+			}
+			continue
+		}
+		if c.want == "" {
+			t.Errorf("%q: found %s", c.path, n.Raw())
+		} else if string(n.Raw()) != c.want {
+			t.Errorf("%q: got %s, want %s", c.path, n.Raw(), c.want)
+		}
+	}
+
+	root := tape.Root()
+	if l := root.Len(); l != 8 {
+		t.Errorf("got %d members, want 8", l)
+	}
+	b, _ := tape.Get("/a/b")
+	if l := b.Len(); l != 4 {
+		t.Errorf("got %d elements, want 4", l)
+	}
+	if start, end := b.Offset(); start != 12 || end != 38 {
+		t.Errorf("got offset %d-%d, want 12-38", start, end)
+	}
+	if i, _ := b.Get("/1"); i.Type() != goj.NegInteger {
+		t.Errorf("got %s, want a negative integer", i.Type())
+	} else if v, err := i.Int64(); err != nil || v != -2 {
+		t.Errorf("got %d, %v, want -2", v, err)
+	}
+	if f, _ := b.Index(2); f.Type() != goj.Float {
+		t.Errorf("got %s, want a float", f.Type())
+	} else if v, err := f.Float64(); err != nil || v != 3.5 {
+		t.Errorf("got %g, %v, want 3.5", v, err)
+	}
+	if s, _ := tape.Get("/hé"); string(s.Value()) != `w"x` || string(s.Key()) != "hé" {
+		t.Errorf("got %q: %q", s.Key(), s.Value())
+	}
+	if d, _ := tape.Get("/d~1e"); !d.Bool() {
+		t.Errorf("got %s, want true", d.Raw())
+	}
+	if k := root.Key(); k != nil {
+		t.Errorf("got key %q for the root", k)
+	}
+	if e, _ := tape.Get("/a/b/0"); e.Key() != nil {
+		t.Errorf("got key %q for an element", e.Key())
+	}
+}
+
+// Duplicate keys are kept, and found first to last, unless the policy of
+// the Tape drops them.
+func TestTapeDuplicateKeys(t *testing.T) {
+	doc := []byte(`{"a": 1, "b": {"a": 2}, "a": 3}`)
+	tape := goj.NewTape()
+	for _, c := range []struct {
+		policy goj.DuplicateKeys
+		want   string
+		len    int
+	}{
+		{goj.AllowDuplicates, "1", 3},
+		{goj.KeepFirst, "1", 2},
+		{goj.KeepLast, "3", 2},
+	} {
+		tape.SetDuplicateKeys(c.policy)
+		if err := tape.Parse(doc); err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := tape.Get("/a"); string(n.Raw()) != c.want {
+			t.Errorf("%v: got %s, want %s", c.policy, n.Raw(), c.want)
+		}
+		if l := tape.Root().Len(); l != c.len {
+			t.Errorf("%v: got %d members, want %d", c.policy, l, c.len)
+		}
+	}
+	tape.SetDuplicateKeys(goj.ErrorOnDuplicates)
+	if err := tape.Parse(doc); err == nil {
+		t.Error("duplicate keys parsed")
+	}
+}
+
+func TestTapeErrors(t *testing.T) {
+	tape := goj.NewTape()
+	for _, doc := range []string{"", "  ", `{"a": `, `[1, 2`, `{"a" 1}`} {
+		if err := tape.Parse([]byte(doc)); err == nil {
+			t.Errorf("%q parsed", doc)
+		}
+		if _, ok := tape.Get(""); ok {
+			t.Errorf("%q: found the root after an error", doc)
+		}
+	}
+	// and the Tape may be used again
+	if err := tape.Parse([]byte(`[true]`)); err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := tape.Get("/0"); !ok || !n.Bool() {
+		t.Errorf("got %s, want true", n.Raw())
+	}
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lloyd/goj"
+)
+
+type Inner struct {
+	A int
+	B string `json:"bee"`
+}
+
+type Embedded struct {
+	Promoted string
+	Shadowed string
+}
+
+type unmarshalOuter struct {
+	Embedded
+	*Inner
+	Shadowed  string
+	Name      string           `json:"name,omitempty"`
+	Count     int64            `json:"count,string"`
+	Ratio     float32          `json:"ratio"`
+	Ignored   string           `json:"-"`
+	Ptr       *int             `json:"ptr"`
+	Kids      []Inner          `json:"kids"`
+	Fixed     [2]int           `json:"fixed"`
+	ByName    map[string]int   `json:"by_name"`
+	ByNumber  map[int]string   `json:"by_number"`
+	Anything  interface{}      `json:"anything"`
+	When      time.Time        `json:"when"`
+	Raw       []byte           `json:"raw"`
+	Nested    *unmarshalOuter  `json:"nested"`
+	Flags     map[string]*bool `json:"flags"`
+	Matrix    [][]float64      `json:"matrix"`
+	unexposed string
+}
+
+const unmarshalDoc = `{
+	"Promoted": "p",
+	"Shadowed": "outer",
+	"A": 7,
+	"bee": "buzz",
+	"NAME": "folded",
+	"count": "42",
+	"ratio": 0.5,
+	"Ignored": "nope",
+	"ptr": 3,
+	"kids": [{"A": 1}, {"bee": "x", "unknown": {"deep": [1, 2, {"x": 3}]}}],
+	"fixed": [1, 2, 3],
+	"by_name": {"a": 1, "b": 2},
+	"by_number": {"1": "one", "-2": "minus two"},
+	"anything": {"list": [1, "two", true, null, {"k": []}]},
+	"when": "2016-04-01T12:00:00Z",
+	"raw": "aGVsbG8=",
+	"nested": {"name": "child", "nested": null},
+	"flags": {"on": true, "off": false, "unset": null},
+	"matrix": [[1, 2], [], [3.5]],
+	"unexposed": "hidden",
+	"unknown": [1, 2, 3]
+}`
+
+// goj.Unmarshal should produce exactly what encoding/json does
+func TestUnmarshalMatchesEncodingJSON(t *testing.T) {
+	var want, got unmarshalOuter
+	if err := json.Unmarshal([]byte(unmarshalDoc), &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := goj.Unmarshal([]byte(unmarshalDoc), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant %+v\ngot  %+v", want, got)
+	}
+	if got.Promoted != "p" || got.Shadowed != "outer" || got.Embedded.Shadowed != "" || got.A != 7 || got.Count != 42 {
+		t.Errorf("unexpected field values: %+v", got)
+	}
+}
+
+func TestUnmarshalInterface(t *testing.T) {
+	var want, got interface{}
+	doc := []byte(`[{"a": [1, {"b": null}], "c": "d"}, 2.5, "x", false]`)
+	if err := json.Unmarshal(doc, &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := goj.Unmarshal(doc, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant %#v\ngot  %#v", want, got)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	var s struct {
+		A int8  `json:"a"`
+		B uint  `json:"b"`
+		C []int `json:"c"`
+		D string
+	}
+	err := goj.Unmarshal([]byte(`{"a": 300, "b": -1, "c": {}, "D": "ok"}`), &s)
+	if te, ok := err.(*goj.UnmarshalTypeError); !ok || te.Key != "a" {
+		t.Errorf("expected type error on key 'a', got %v", err)
+	}
+	// decoding continues past type errors
+	if s.D != "ok" {
+		t.Errorf("expected D to be decoded, got %q", s.D)
+	}
+
+	if err := goj.Unmarshal([]byte(`{"a": 1`), &s); err == nil {
+		t.Errorf("expected syntax error")
+	}
+	if _, ok := goj.Unmarshal([]byte(`{}`), s).(*goj.InvalidUnmarshalError); !ok {
+		t.Errorf("expected InvalidUnmarshalError for non-pointer")
+	}
+}
@@ -0,0 +1,186 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lloyd/goj"
+)
+
+// rewrite re-emits a document through a goj.Writer
+func rewrite(w *goj.Writer, buf []byte) error {
+	return goj.NewParser().Parse(buf, func(t goj.Type, k []byte, v []byte) goj.Action {
+		if k != nil {
+			w.KeyBytes(k)
+		}
+		switch t {
+		case goj.String:
+			w.StringBytes(v)
+		case goj.Integer, goj.NegInteger, goj.Float:
+			w.Number(v)
+		case goj.True:
+			w.Bool(true)
+		case goj.False:
+			w.Bool(false)
+		case goj.Null:
+			w.Null()
+		case goj.Array:
+			w.BeginArray()
+		case goj.ArrayEnd:
+			w.EndArray()
+		case goj.Object:
+			w.BeginObject()
+		case goj.ObjectEnd:
+			w.EndObject()
+		}
+		return goj.Continue
+	})
+}
+
+func decodeNumbers(t *testing.T, buf []byte) interface{} {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("%v in %.100s", err, buf)
+	}
+	return v
+}
+
+// Parsing and re-emitting a document must preserve it exactly
+func TestWriterRoundTrip(t *testing.T) {
+	files, _ := filepath.Glob("cases/*.json")
+	files = append(files, "code.json")
+	for _, f := range files {
+		buf, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !json.Valid(buf) || strings.Contains(f, "surrogate") {
+			continue
+		}
+		var out bytes.Buffer
+		w := goj.NewWriter(&out)
+		w.SetValidate(true)
+		if err := rewrite(w, buf); err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		if !reflect.DeepEqual(decodeNumbers(t, buf), decodeNumbers(t, out.Bytes())) {
+			t.Errorf("%s: round trip changed the document:\n%.200s", f, out.Bytes())
+		}
+	}
+}
+
+func TestWriterEscaping(t *testing.T) {
+	var all []byte
+	for c := 0; c < 0x80; c++ {
+		if c != '<' && c != '>' && c != '&' {
+			all = append(all, byte(c))
+		}
+	}
+	for _, s := range []string{"", "plain", string(all), "é😀 ", strings.Repeat("long \"quoted\"\n", 100)} {
+		w := goj.NewWriter(nil)
+		w.String(s)
+		want, _ := json.Marshal(s)
+		if s == "é😀 " {
+			want = []byte(`"` + s + `"`)
+		}
+		if got := w.Bytes(); !bytes.Equal(want, got) {
+			t.Errorf("want %s, got %s", want, got)
+		}
+
+		// strings and their bytes are escaped alike
+		for _, escape := range []bool{false, true} {
+			ws, wb := goj.NewWriter(nil), goj.NewWriter(nil)
+			for _, w := range []*goj.Writer{ws, wb} {
+				w.SetEscapeHTML(escape)
+				w.SetEscapeNonASCII(escape)
+				w.BeginObject()
+			}
+			ws.Key(s)
+			ws.String(s + "<\u2028>")
+			wb.KeyBytes([]byte(s))
+			wb.StringBytes([]byte(s + "<\u2028>"))
+			if !bytes.Equal(ws.Bytes(), wb.Bytes()) {
+				t.Errorf("escaping %v: %s, from bytes %s", escape, ws.Bytes(), wb.Bytes())
+			}
+		}
+	}
+}
+
+func TestWriterNumbers(t *testing.T) {
+	w := goj.NewWriter(nil)
+	w.BeginArray()
+	floats := []float64{0, 1, -1.5, 1e20, 1e21, 1e-6, 1e-7, 123456789.125, -2.5e-300, math.MaxFloat64, math.SmallestNonzeroFloat64}
+	for _, f := range floats {
+		w.Float(f)
+	}
+	w.Int(math.MinInt64)
+	w.Uint(math.MaxUint64)
+	w.EndArray()
+	want, _ := json.Marshal(floats)
+	want = append(want[:len(want)-1], ",-9223372036854775808,18446744073709551615]"...)
+	if got := w.Bytes(); !bytes.Equal(want, got) {
+		t.Errorf("\nwant %s\ngot  %s", want, got)
+	}
+
+	w.Reset(nil)
+	w.Float(math.NaN())
+	w.Null()
+	if w.Close() == nil || len(w.Bytes()) != 0 {
+		t.Errorf("expected an error and no output for NaN, got %q", w.Bytes())
+	}
+}
+
+func TestWriterStructure(t *testing.T) {
+	var out bytes.Buffer
+	w := goj.NewWriter(&out)
+	w.SetValidate(true)
+	for i := 0; i < 1000; i++ {
+		w.BeginObject()
+		w.Key("n")
+		w.Int(int64(i))
+		w.Key("list")
+		w.BeginArray()
+		w.String("a")
+		w.BeginObject()
+		w.EndObject()
+		w.Raw([]byte(`{"raw": [1]}`))
+		w.EndArray()
+		w.EndObject()
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) != 1000 || lines[999] != `{"n":999,"list":["a",{},{"raw": [1]}]}` {
+		t.Errorf("unexpected output %q", lines[len(lines)-1])
+	}
+
+	for name, f := range map[string]func(w *goj.Writer){
+		"key in array":    func(w *goj.Writer) { w.BeginArray(); w.Key("k") },
+		"value in object": func(w *goj.Writer) { w.BeginObject(); w.Int(1) },
+		"key twice":       func(w *goj.Writer) { w.BeginObject(); w.Key("a"); w.Key("b") },
+		"dangling key":    func(w *goj.Writer) { w.BeginObject(); w.Key("a"); w.EndObject() },
+		"mismatched end":  func(w *goj.Writer) { w.BeginArray(); w.EndObject() },
+		"extra end":       func(w *goj.Writer) { w.Null(); w.EndArray() },
+		"unclosed":        func(w *goj.Writer) { w.BeginArray(); w.BeginArray(); w.EndArray() },
+		"bad number":      func(w *goj.Writer) { w.Number([]byte("01")) },
+	} {
+		w := goj.NewWriter(nil)
+		w.SetValidate(true)
+		f(w)
+		if w.Close() == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,738 @@
+package goj
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Unmarshal parses the JSON document in buf and stores the result in the
+// value pointed to by v, following the rules of encoding/json.Unmarshal:
+// struct fields are matched by their `json:"name"` tag or name (exactly, then
+// case-insensitively), fields of embedded structs are promoted, pointers are
+// allocated as needed, and types implementing encoding.TextUnmarshaler are
+// handed the contents of JSON strings.  Unknown keys are skipped without
+// being decoded.
+//
+// As with encoding/json, if a JSON value is not appropriate for the target
+// type, decoding continues and the first such error (an *UnmarshalTypeError)
+// is returned.
+func Unmarshal(buf []byte, v interface{}) error {
+	return unmarshal(buf, v, false)
+}
+
+// unmarshal implements Unmarshal.  With useNumber, numbers decoded into an
+// interface{} are stored as json.Number rather than float64.
+func unmarshal(buf []byte, v interface{}, useNumber bool) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidUnmarshalError{reflect.TypeOf(v)}
+	}
+	u := unmarshalerPool.Get().(*unmarshaler)
+	u.useNumber = useNumber
+	err := u.unmarshal(buf, rv.Elem())
+	unmarshalerPool.Put(u)
+	return err
+}
+
+// An InvalidUnmarshalError describes an invalid argument passed to Unmarshal.
+// (The argument to Unmarshal must be a non-nil pointer.)
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidUnmarshalError) Error() string {
+	if e.Type == nil {
+		return "goj: Unmarshal(nil)"
+	}
+	if e.Type.Kind() != reflect.Ptr {
+		return "goj: Unmarshal(non-pointer " + e.Type.String() + ")"
+	}
+	return "goj: Unmarshal(nil " + e.Type.String() + ")"
+}
+
+// An UnmarshalTypeError describes a JSON value that was not appropriate for
+// the Go type it was to be stored in.
+type UnmarshalTypeError struct {
+	Value string       // description of the JSON value, e.g. "array" or "integer 300"
+	Type  reflect.Type // type of the Go value it could not be assigned to
+	Key   string       // the object key the value was found under, if any
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	s := "goj: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+	if e.Key != "" {
+		s += " (key '" + e.Key + "')"
+	}
+	return s
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	emptyMapType        = reflect.TypeOf(map[string]interface{}(nil))
+	emptySliceType      = reflect.TypeOf([]interface{}(nil))
+	numberType          = reflect.TypeOf(json.Number(""))
+)
+
+// fieldPlan describes how to reach and decode a single struct field.
+type fieldPlan struct {
+	name      string
+	nameBytes []byte
+	index     []int
+	quoted    bool
+	omitEmpty bool
+	tagged    bool
+	direct    bool
+}
+
+// structPlan is the cached decoding plan for a struct type.
+type structPlan struct {
+	fields []fieldPlan
+	byName map[string]int
+}
+
+// lookup returns the index of the field named k, or -1.  Keys usually
+// arrive in declaration order, so the field at hint is tried first.
+func (sp *structPlan) lookup(k []byte, hint int) int {
+	if hint < len(sp.fields) && bytes.Equal(sp.fields[hint].nameBytes, k) {
+		return hint
+	}
+	if i, ok := sp.byName[string(k)]; ok {
+		return i
+	}
+	for i := range sp.fields {
+		if bytes.EqualFold(sp.fields[i].nameBytes, k) {
+			return i
+		}
+	}
+	return -1
+}
+
+var planCache sync.Map // reflect.Type -> *structPlan
+
+func planFor(t reflect.Type) *structPlan {
+	if sp, ok := planCache.Load(t); ok {
+		return sp.(*structPlan)
+	}
+	sp, _ := planCache.LoadOrStore(t, buildPlan(t))
+	return sp.(*structPlan)
+}
+
+// parseTag splits a struct field's json tag into its name and options.
+func parseTag(tag string) (string, string) {
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
+
+func hasOption(opts, name string) bool {
+	for opts != "" {
+		var o string
+		if i := strings.IndexByte(opts, ','); i >= 0 {
+			o, opts = opts[:i], opts[i+1:]
+		} else {
+			o, opts = opts, ""
+		}
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// buildPlan walks the fields of t breadth first, descending into embedded
+// structs, and applies the encoding/json visibility rules: a shallower field
+// hides deeper ones with the same name, and at equal depth a tagged field
+// wins, otherwise the name is ambiguous and dropped.
+func buildPlan(t reflect.Type) *structPlan {
+	type queued struct {
+		typ   reflect.Type
+		index []int
+	}
+	sp := &structPlan{byName: make(map[string]int)}
+	taken := make(map[string]bool)
+	visited := make(map[reflect.Type]bool)
+	next := []queued{{typ: t}}
+
+	for len(next) > 0 {
+		current := next
+		next = nil
+		var level []fieldPlan
+		for _, q := range current {
+			if visited[q.typ] {
+				continue
+			}
+			visited[q.typ] = true
+			for i := 0; i < q.typ.NumField(); i++ {
+				sf := q.typ.Field(i)
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous {
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts := parseTag(tag)
+				index := make([]int, len(q.index)+1)
+				copy(index, q.index)
+				index[len(q.index)] = i
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, queued{ft, index})
+					continue
+				}
+				tagged := name != ""
+				if name == "" {
+					name = sf.Name
+				}
+				quoted := false
+				if hasOption(opts, "string") {
+					switch ft.Kind() {
+					case reflect.Bool, reflect.String,
+						reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+						reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+						reflect.Float32, reflect.Float64:
+						quoted = true
+					}
+				}
+				level = append(level, fieldPlan{
+					name:      name,
+					nameBytes: []byte(name),
+					index:     index,
+					quoted:    quoted,
+					omitEmpty: hasOption(opts, "omitempty"),
+					tagged:    tagged,
+					direct:    isDirect(sf.Type),
+				})
+			}
+		}
+
+		// resolve conflicts between fields of the same name at this depth
+		for i := range level {
+			f := level[i]
+			if taken[f.name] {
+				continue
+			}
+			dominant := -1
+			count, taggedCount := 0, 0
+			for j := range level {
+				if level[j].name != f.name {
+					continue
+				}
+				count++
+				if level[j].tagged {
+					taggedCount++
+					dominant = j
+				}
+			}
+			taken[f.name] = true
+			if count == 1 {
+				dominant = i
+			} else if taggedCount != 1 {
+				continue
+			}
+			sp.byName[f.name] = len(sp.fields)
+			sp.fields = append(sp.fields, level[dominant])
+		}
+	}
+	return sp
+}
+
+// target is a location that will receive a decoded JSON value.
+type target struct {
+	v      reflect.Value // settable location of the value
+	quoted bool          // value is wrapped in a string (`json:",string"`)
+	direct bool          // v may be decoded into without calling indirect
+}
+
+type frameKind uint8
+
+const (
+	frameStruct frameKind = iota
+	frameMap
+	frameSlice
+	frameArray
+)
+
+type decodeFrame struct {
+	kind   frameKind
+	v      reflect.Value // the container being filled
+	plan   *structPlan
+	i      int           // next index for arrays, or the likely next field for structs
+	direct bool          // elements may be decoded into without calling indirect
+	iface  reflect.Value // interface which receives v when complete, if any
+	key    reflect.Value // for maps, the key of the element being decoded
+	elem   reflect.Value // for maps, the element being decoded
+}
+
+type unmarshaler struct {
+	parser  *Parser
+	literal *Parser // lazily allocated, decodes `json:",string"` values
+	cb      Callback
+	stack   []decodeFrame
+	root    reflect.Value
+	started bool
+	err     error
+	empties map[reflect.Type]reflect.Value
+
+	useNumber bool
+}
+
+// emptySlice returns a non-nil empty slice of type t.  They are cached as
+// reflect.MakeSlice allocates even when the length is zero.
+func (u *unmarshaler) emptySlice(t reflect.Type) reflect.Value {
+	if s, ok := u.empties[t]; ok {
+		return s
+	}
+	s := reflect.MakeSlice(t, 0, 0)
+	u.empties[t] = s
+	return s
+}
+
+var unmarshalerPool = sync.Pool{
+	New: func() interface{} {
+		u := &unmarshaler{
+			parser:  NewParser(),
+			stack:   make([]decodeFrame, 0, 8),
+			empties: make(map[reflect.Type]reflect.Value),
+		}
+		u.cb = u.event
+		return u
+	},
+}
+
+func (u *unmarshaler) unmarshal(buf []byte, v reflect.Value) error {
+	u.root = v
+	u.started = false
+	u.err = nil
+	err := u.parser.Parse(buf, u.cb)
+	for i := range u.stack {
+		u.stack[i] = decodeFrame{}
+	}
+	u.stack = u.stack[:0]
+	u.root = reflect.Value{}
+	if err != nil {
+		return err
+	}
+	return u.err
+}
+
+// finish commits a completed value to its parent.  That only matters for
+// maps, whose elements are decoded into a temporary and then inserted.
+func (u *unmarshaler) finish() {
+	if n := len(u.stack); n > 0 {
+		if f := &u.stack[n-1]; f.kind == frameMap {
+			f.v.SetMapIndex(f.key, f.elem)
+		}
+	}
+}
+
+func (u *unmarshaler) saveError(err error) {
+	if u.err == nil {
+		u.err = err
+	}
+}
+
+func (u *unmarshaler) typeError(what string, t reflect.Type, k []byte) {
+	if u.err == nil {
+		u.err = &UnmarshalTypeError{Value: what, Type: t, Key: string(k)}
+	}
+}
+
+func (u *unmarshaler) event(t Type, k []byte, v []byte) Action {
+	t = t.Base()
+	switch t {
+	case ArrayEnd, ObjectEnd:
+		f := &u.stack[len(u.stack)-1]
+		switch f.kind {
+		case frameArray:
+			for ; f.i < f.v.Len(); f.i++ {
+				f.v.Index(f.i).Set(reflect.Zero(f.v.Type().Elem()))
+			}
+		case frameSlice:
+			// an empty JSON array decodes to an empty, not nil, slice
+			if f.v.IsNil() {
+				f.v.Set(u.emptySlice(f.v.Type()))
+			}
+		}
+		if f.iface.IsValid() {
+			f.iface.Set(f.v)
+		}
+		*f = decodeFrame{}
+		u.stack = u.stack[:len(u.stack)-1]
+		u.finish()
+		return Continue
+	case SkippedData:
+		return Continue
+	}
+
+	tg, ok := u.next(k)
+	if !ok {
+		if t == Object || t == Array {
+			return Skip
+		}
+		return Continue
+	}
+	switch t {
+	case Object:
+		return u.beginObject(tg, k)
+	case Array:
+		return u.beginArray(tg, k)
+	}
+	if tg.quoted && t != Null {
+		u.quoted(tg, t, k, v)
+	} else {
+		u.scalar(tg, t, k, v)
+	}
+	return Continue
+}
+
+// next returns the target for the value about to be decoded, or false if the
+// value should be skipped.
+func (u *unmarshaler) next(k []byte) (target, bool) {
+	if len(u.stack) == 0 {
+		if u.started {
+			return target{}, false
+		}
+		u.started = true
+		return target{v: u.root}, true
+	}
+	f := &u.stack[len(u.stack)-1]
+	switch f.kind {
+	case frameStruct:
+		i := f.plan.lookup(k, f.i)
+		if i < 0 {
+			return target{}, false
+		}
+		f.i = i + 1
+		fp := &f.plan.fields[i]
+		fv, ok := fieldByIndex(f.v, fp.index)
+		if !ok {
+			return target{}, false
+		}
+		return target{v: fv, quoted: fp.quoted, direct: fp.direct}, true
+	case frameMap:
+		mt := f.v.Type()
+		key, ok := u.mapKey(mt, k)
+		if !ok {
+			return target{}, false
+		}
+		f.key = key
+		f.elem = reflect.New(mt.Elem()).Elem()
+		return target{v: f.elem, direct: f.direct}, true
+	case frameSlice:
+		n := f.v.Len()
+		if n < f.v.Cap() {
+			f.v.SetLen(n + 1)
+			f.v.Index(n).Set(reflect.Zero(f.v.Type().Elem()))
+		} else {
+			f.v.Grow(1)
+			f.v.SetLen(n + 1)
+		}
+		return target{v: f.v.Index(n), direct: f.direct}, true
+	case frameArray:
+		if f.i >= f.v.Len() {
+			return target{}, false
+		}
+		f.i++
+		return target{v: f.v.Index(f.i - 1), direct: f.direct}, true
+	}
+	return target{}, false
+}
+
+func (u *unmarshaler) mapKey(mt reflect.Type, k []byte) (reflect.Value, bool) {
+	kt := mt.Key()
+	if reflect.PointerTo(kt).Implements(textUnmarshalerType) {
+		kv := reflect.New(kt)
+		if err := kv.Interface().(encoding.TextUnmarshaler).UnmarshalText(k); err != nil {
+			u.saveError(err)
+			return reflect.Value{}, false
+		}
+		return kv.Elem(), true
+	}
+	switch kt.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(string(k)).Convert(kt), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(string(k), 10, 64)
+		if err != nil || reflect.Zero(kt).OverflowInt(n) {
+			u.typeError("integer "+string(k), kt, k)
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(n).Convert(kt), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(string(k), 10, 64)
+		if err != nil || reflect.Zero(kt).OverflowUint(n) {
+			u.typeError("integer "+string(k), kt, k)
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(n).Convert(kt), true
+	}
+	u.typeError(Object.String(), mt, k)
+	return reflect.Value{}, false
+}
+
+func (u *unmarshaler) beginObject(tg target, k []byte) Action {
+	tu, dst := u.indirect(&tg)
+	if tu != nil {
+		u.typeError(Object.String(), tg.v.Type(), k)
+		return Skip
+	}
+	switch dst.Kind() {
+	case reflect.Struct:
+		u.stack = append(u.stack, decodeFrame{kind: frameStruct, v: dst, plan: planFor(dst.Type())})
+	case reflect.Map:
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(dst.Type()))
+		}
+		u.stack = append(u.stack, decodeFrame{kind: frameMap, v: dst, direct: isDirect(dst.Type().Elem())})
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			u.typeError(Object.String(), dst.Type(), k)
+			return Skip
+		}
+		m := reflect.New(emptyMapType).Elem()
+		m.Set(reflect.MakeMap(emptyMapType))
+		u.stack = append(u.stack, decodeFrame{kind: frameMap, v: m, iface: dst})
+	default:
+		u.typeError(Object.String(), dst.Type(), k)
+		return Skip
+	}
+	return Continue
+}
+
+func (u *unmarshaler) beginArray(tg target, k []byte) Action {
+	tu, dst := u.indirect(&tg)
+	if tu != nil {
+		u.typeError(Array.String(), tg.v.Type(), k)
+		return Skip
+	}
+	switch dst.Kind() {
+	case reflect.Slice:
+		if !dst.IsNil() {
+			dst.SetLen(0)
+		}
+		u.stack = append(u.stack, decodeFrame{kind: frameSlice, v: dst, direct: isDirect(dst.Type().Elem())})
+	case reflect.Array:
+		u.stack = append(u.stack, decodeFrame{kind: frameArray, v: dst, direct: isDirect(dst.Type().Elem())})
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			u.typeError(Array.String(), dst.Type(), k)
+			return Skip
+		}
+		s := reflect.New(emptySliceType).Elem()
+		u.stack = append(u.stack, decodeFrame{kind: frameSlice, v: s, iface: dst})
+	default:
+		u.typeError(Array.String(), dst.Type(), k)
+		return Skip
+	}
+	return Continue
+}
+
+// quoted decodes a value for a field tagged `json:",string"`, which must be a
+// JSON string containing a JSON scalar.
+func (u *unmarshaler) quoted(tg target, t Type, k []byte, v []byte) {
+	if t != String {
+		u.saveError(fmt.Errorf("goj: invalid use of ,string struct tag, trying to unmarshal %s into %v", t, tg.v.Type()))
+		return
+	}
+	if u.literal == nil {
+		u.literal = NewParser()
+	}
+	var lt Type
+	var lv []byte
+	n := 0
+	err := u.literal.Parse(v, func(t Type, _ []byte, v []byte) Action {
+		lt, lv = t, v
+		n++
+		return Continue
+	})
+	if err != nil || n != 1 || (lt == String) != (tg.v.Kind() == reflect.String) {
+		u.saveError(fmt.Errorf("goj: invalid use of ,string struct tag, trying to unmarshal %q into %v", v, tg.v.Type()))
+		return
+	}
+	u.scalar(tg, lt, k, lv)
+}
+
+func (u *unmarshaler) scalar(tg target, t Type, k []byte, v []byte) {
+	if t == Null {
+		switch tg.v.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			tg.v.Set(reflect.Zero(tg.v.Type()))
+		}
+		u.finish()
+		return
+	}
+
+	tu, dst := u.indirect(&tg)
+	if tu != nil {
+		if t != String {
+			u.typeError(t.String(), tg.v.Type(), k)
+			return
+		}
+		if err := tu.UnmarshalText(v); err != nil {
+			u.saveError(err)
+			return
+		}
+		u.finish()
+		return
+	}
+
+	switch t {
+	case String:
+		switch {
+		case dst.Kind() == reflect.String:
+			dst.SetString(string(v))
+		case dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8:
+			b := make([]byte, base64.StdEncoding.DecodedLen(len(v)))
+			n, err := base64.StdEncoding.Decode(b, v)
+			if err != nil {
+				u.saveError(err)
+				return
+			}
+			dst.SetBytes(b[:n])
+		case dst.Kind() == reflect.Interface && dst.NumMethod() == 0:
+			dst.Set(reflect.ValueOf(string(v)))
+		default:
+			u.typeError(t.String(), dst.Type(), k)
+			return
+		}
+	case Integer, NegInteger, Float:
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil || dst.OverflowInt(n) {
+				u.typeError(t.String()+" "+string(v), dst.Type(), k)
+				return
+			}
+			dst.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n, err := strconv.ParseUint(string(v), 10, 64)
+			if err != nil || dst.OverflowUint(n) {
+				u.typeError(t.String()+" "+string(v), dst.Type(), k)
+				return
+			}
+			dst.SetUint(n)
+		case reflect.Float32, reflect.Float64:
+			n, err := strconv.ParseFloat(string(v), dst.Type().Bits())
+			if err != nil {
+				u.typeError(t.String()+" "+string(v), dst.Type(), k)
+				return
+			}
+			dst.SetFloat(n)
+		case reflect.String:
+			if dst.Type() != numberType {
+				u.typeError(t.String()+" "+string(v), dst.Type(), k)
+				return
+			}
+			dst.SetString(string(v))
+		case reflect.Interface:
+			if u.useNumber && dst.NumMethod() == 0 {
+				dst.Set(reflect.ValueOf(json.Number(v)))
+				break
+			}
+			n, err := strconv.ParseFloat(string(v), 64)
+			if err != nil || dst.NumMethod() != 0 {
+				u.typeError(t.String()+" "+string(v), dst.Type(), k)
+				return
+			}
+			dst.Set(reflect.ValueOf(n))
+		default:
+			u.typeError(t.String()+" "+string(v), dst.Type(), k)
+			return
+		}
+	case True, False:
+		switch {
+		case dst.Kind() == reflect.Bool:
+			dst.SetBool(t == True)
+		case dst.Kind() == reflect.Interface && dst.NumMethod() == 0:
+			dst.Set(reflect.ValueOf(t == True))
+		default:
+			u.typeError("bool", dst.Type(), k)
+			return
+		}
+	}
+	u.finish()
+}
+
+func (u *unmarshaler) indirect(tg *target) (encoding.TextUnmarshaler, reflect.Value) {
+	if tg.direct {
+		return nil, tg.v
+	}
+	return indirect(tg.v)
+}
+
+// isDirect reports whether values of type t can be decoded into without
+// first walking through indirect.
+func isDirect(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return false
+	}
+	return !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// indirect walks down v allocating pointers as needed, until it gets to a
+// non-pointer.  If it encounters an encoding.TextUnmarshaler along the way,
+// it stops and returns that.
+func indirect(v reflect.Value) (encoding.TextUnmarshaler, reflect.Value) {
+	// a named non-pointer type may implement TextUnmarshaler on its pointer
+	if v.Kind() != reflect.Ptr && v.Type().Name() != "" && v.CanAddr() {
+		v = v.Addr()
+	}
+	for {
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+			e := v.Elem()
+			if e.Kind() == reflect.Ptr && !e.IsNil() {
+				v = e
+				continue
+			}
+		}
+		if v.Kind() != reflect.Ptr {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if v.Type().NumMethod() > 0 && v.CanInterface() {
+			if tu, ok := v.Interface().(encoding.TextUnmarshaler); ok {
+				return tu, reflect.Value{}
+			}
+		}
+		v = v.Elem()
+	}
+	return nil, v
+}
+
+// fieldByIndex returns the field of struct v at the given index path,
+// allocating embedded struct pointers on the way.  It returns false if such a
+// pointer is nil and cannot be set (it is unexported).
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
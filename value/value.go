@@ -0,0 +1,204 @@
+// Package value builds a generic in-memory tree of Go values
+// (map[string]interface{}, []interface{}, string, numbers, bool and nil) from
+// the events produced by the goj scanner.  It is the moral equivalent of
+// decoding into an interface{} with encoding/json, only faster.
+package value
+
+import (
+	"strconv"
+
+	"github.com/lloyd/goj"
+)
+
+// NumberMode selects the Go representation of JSON numbers.
+type NumberMode uint8
+
+const (
+	// Float64 represents every number as a float64, like encoding/json.
+	Float64 NumberMode = iota
+	// UseNumber represents every number as a Number, preserving its text.
+	UseNumber
+	// Int64IfExact represents integers which fit in an int64 as int64, and
+	// every other number as a float64.
+	Int64IfExact
+)
+
+// Number is the text of a JSON number, in the spirit of json.Number.
+type Number string
+
+// String returns the literal text of the number.
+func (n Number) String() string {
+	return string(n)
+}
+
+// Float64 returns the number as a float64.
+func (n Number) Float64() (float64, error) {
+	return strconv.ParseFloat(string(n), 64)
+}
+
+// Int64 returns the number as an int64.
+func (n Number) Int64() (int64, error) {
+	return strconv.ParseInt(string(n), 10, 64)
+}
+
+type frame struct {
+	key string
+	obj map[string]interface{}
+	arr []interface{}
+}
+
+// Decoder turns JSON documents into trees of Go values.  A Decoder may be
+// re-used, but is not safe for concurrent use.
+type Decoder struct {
+	parser  *goj.Parser
+	numbers NumberMode
+	intern  bool
+	keys    map[string]string
+	stack   []frame
+	root    interface{}
+	err     error
+}
+
+// NewDecoder allocates a new Decoder that represents numbers as float64 and
+// does not deduplicate keys.
+func NewDecoder() *Decoder {
+	return &Decoder{
+		parser: goj.NewParser(),
+		stack:  make([]frame, 0, 8),
+	}
+}
+
+// SetNumberMode selects how numbers are represented in decoded trees.
+func (d *Decoder) SetNumberMode(m NumberMode) {
+	d.numbers = m
+}
+
+// SetInternKeys enables or disables deduplication of object key strings.
+// When enabled, every distinct key is allocated once for the lifetime of the
+// Decoder, which saves a great deal of memory when decoding many documents
+// with the same shape.
+func (d *Decoder) SetInternKeys(on bool) {
+	d.intern = on
+	if on && d.keys == nil {
+		d.keys = make(map[string]string)
+	}
+}
+
+// Decode parses a complete JSON document and returns its value.
+func (d *Decoder) Decode(buf []byte) (interface{}, error) {
+	d.stack = d.stack[:0]
+	d.root = nil
+	d.err = nil
+	err := d.parser.Parse(buf, d.event)
+	if d.err != nil {
+		err = d.err
+	}
+	v := d.root
+	d.root = nil
+	if err != nil {
+		// drop references to partially built containers
+		for i := range d.stack {
+			d.stack[i] = frame{}
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// Decode parses a complete JSON document with a default Decoder.
+func Decode(buf []byte) (interface{}, error) {
+	return NewDecoder().Decode(buf)
+}
+
+func (d *Decoder) event(t goj.Type, k []byte, v []byte) goj.Action {
+	switch t.Base() {
+	case goj.String:
+		d.add(k, string(v))
+	case goj.Integer, goj.NegInteger, goj.Float:
+		n, err := d.number(t.Base(), v)
+		if err != nil {
+			d.err = err
+			return goj.Cancel
+		}
+		d.add(k, n)
+	case goj.True:
+		d.add(k, true)
+	case goj.False:
+		d.add(k, false)
+	case goj.Null:
+		d.add(k, nil)
+	case goj.Array:
+		d.stack = append(d.stack, frame{key: d.key(k), arr: make([]interface{}, 0)})
+	case goj.Object:
+		d.stack = append(d.stack, frame{key: d.key(k), obj: make(map[string]interface{})})
+	case goj.ArrayEnd, goj.ObjectEnd:
+		f := d.stack[len(d.stack)-1]
+		d.stack[len(d.stack)-1] = frame{}
+		d.stack = d.stack[:len(d.stack)-1]
+		if f.obj != nil {
+			d.addString(f.key, f.obj)
+		} else {
+			d.addString(f.key, f.arr)
+		}
+	}
+	return goj.Continue
+}
+
+func (d *Decoder) number(t goj.Type, v []byte) (interface{}, error) {
+	switch d.numbers {
+	case UseNumber:
+		return Number(v), nil
+	case Int64IfExact:
+		if t != goj.Float {
+			if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+				return i, nil
+			}
+		}
+	}
+	f, err := strconv.ParseFloat(string(v), 64)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (d *Decoder) key(k []byte) string {
+	if k == nil {
+		return ""
+	}
+	if !d.intern {
+		return string(k)
+	}
+	if s, ok := d.keys[string(k)]; ok {
+		return s
+	}
+	s := string(k)
+	d.keys[s] = s
+	return s
+}
+
+func (d *Decoder) add(k []byte, v interface{}) {
+	if len(d.stack) == 0 {
+		d.root = v
+		return
+	}
+	top := &d.stack[len(d.stack)-1]
+	if top.obj != nil {
+		top.obj[d.key(k)] = v
+	} else {
+		top.arr = append(top.arr, v)
+	}
+}
+
+func (d *Decoder) addString(k string, v interface{}) {
+	if len(d.stack) == 0 {
+		d.root = v
+		return
+	}
+	top := &d.stack[len(d.stack)-1]
+	if top.obj != nil {
+		top.obj[k] = v
+	} else {
+		top.arr = append(top.arr, v)
+	}
+}
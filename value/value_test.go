@@ -0,0 +1,98 @@
+package value
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// goj cooks unpaired surrogates to '?' where encoding/json uses U+FFFD
+var knownDifferences = map[string]bool{
+	"isolated_surrogate_marker.json": true,
+}
+
+// decoded trees must match what encoding/json produces for every document
+// that both accept.
+func TestMatchesEncodingJSON(t *testing.T) {
+	files, err := filepath.Glob("../test/cases/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder()
+	for _, f := range files {
+		if knownDifferences[filepath.Base(f)] {
+			continue
+		}
+		buf, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want interface{}
+		if json.Unmarshal(buf, &want) != nil {
+			continue
+		}
+		got, err := d.Decode(buf)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", f, err)
+			continue
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%s:\nwant %#v\ngot  %#v", f, want, got)
+		}
+	}
+}
+
+func TestNumberModes(t *testing.T) {
+	doc := []byte(`[1, -2, 3.5, 1e2, 18446744073709551616]`)
+
+	d := NewDecoder()
+	d.SetNumberMode(Int64IfExact)
+	got, err := d.Decode(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{int64(1), int64(-2), 3.5, 100.0, 18446744073709551616.0}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Int64IfExact: want %#v got %#v", want, got)
+	}
+
+	d.SetNumberMode(UseNumber)
+	got, err = d.Decode(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []interface{}{Number("1"), Number("-2"), Number("3.5"), Number("1e2"), Number("18446744073709551616")}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("UseNumber: want %#v got %#v", want, got)
+	}
+}
+
+func TestInternKeys(t *testing.T) {
+	d := NewDecoder()
+	d.SetInternKeys(true)
+	a, err := d.Decode([]byte(`{"name": "a", "nested": {"name": "b"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.Decode([]byte(`{"name": "c"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.keys) != 2 {
+		t.Errorf("expected 2 interned keys, got %d", len(d.keys))
+	}
+	if a.(map[string]interface{})["name"] != "a" || b.(map[string]interface{})["name"] != "c" {
+		t.Errorf("unexpected values: %#v %#v", a, b)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	if v, err := Decode([]byte(`{"a": [1, 2`)); err == nil {
+		t.Errorf("expected error, got %#v", v)
+	}
+	if v, err := Decode([]byte(`1e400`)); err == nil {
+		t.Errorf("expected range error, got %#v", v)
+	}
+}
@@ -0,0 +1,493 @@
+package goj
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Writer emits JSON text one entity at a time, to an io.Writer or into a
+// buffer.  Separators between keys and values are inserted as needed, and
+// strings are escaped.  Successive top-level values are separated by
+// newlines, so a Writer can also produce newline separated JSON.
+//
+// Output is buffered, and written to the underlying io.Writer as the buffer
+// fills up and when Flush or Close is called.  Errors are sticky: after the
+// first one nothing more is written and Flush and Close return it.
+//
+// A Writer does not check that its output is well formed unless
+// SetValidate is turned on, then misplaced keys and values and unbalanced
+// containers are reported as errors.
+type Writer struct {
+	out      io.Writer
+	buf      []byte
+	stack    []byte // '{' or '[' for each open container
+	comma    bool   // a separator is due before the next key or value
+	key      bool   // a key was written and awaits its value
+	validate bool
+	err      error
+
+	prefix         string
+	indent         string
+	indented       bool
+	spaced         bool // separate members with ", " and keys with ": "
+	escapeHTML     bool
+	escapeNonASCII bool
+}
+
+const flushSize = 4096
+
+// NewWriter returns a Writer that writes to out.  If out is nil, output
+// accumulates in the Writer's buffer, see Bytes.
+func NewWriter(out io.Writer) *Writer {
+	return &Writer{
+		out:   out,
+		buf:   make([]byte, 0, flushSize+512),
+		stack: make([]byte, 0, 8),
+	}
+}
+
+// Reset discards any unflushed output and state, and makes the Writer
+// write to out.  Its buffer is kept for reuse.
+func (w *Writer) Reset(out io.Writer) {
+	w.out = out
+	w.buf = w.buf[:0]
+	w.stack = w.stack[:0]
+	w.comma = false
+	w.key = false
+	w.err = nil
+}
+
+// SetValidate turns checking of the structure of the output on or off.
+func (w *Writer) SetValidate(on bool) {
+	w.validate = on
+}
+
+// SetIndent makes the Writer put each member of an object or array on a line
+// of its own, which begins with prefix followed by one copy of indent for
+// each level of nesting, as encoding/json.Indent does.  With both empty the
+// output is compact.
+func (w *Writer) SetIndent(prefix, indent string) {
+	w.prefix = prefix
+	w.indent = indent
+	w.indented = prefix != "" || indent != ""
+}
+
+// SetEscapeHTML controls whether <, > and & are escaped in strings, as
+// encoding/json does by default so that the output is safe to embed in HTML.
+func (w *Writer) SetEscapeHTML(on bool) {
+	w.escapeHTML = on
+}
+
+// SetEscapeNonASCII controls whether all characters outside of ASCII are
+// escaped in strings, so that the output is pure ASCII.
+func (w *Writer) SetEscapeNonASCII(on bool) {
+	w.escapeNonASCII = on
+}
+
+// Bytes returns the output which has not been flushed yet.  For a Writer
+// without an io.Writer that is all of it.
+func (w *Writer) Bytes() []byte {
+	return w.buf
+}
+
+// Flush writes any buffered output to the underlying io.Writer.
+func (w *Writer) Flush() error {
+	if w.err == nil && w.out != nil && len(w.buf) > 0 {
+		if _, err := w.out.Write(w.buf); err != nil {
+			w.err = err
+		}
+		w.buf = w.buf[:0]
+	}
+	return w.err
+}
+
+// Close flushes the Writer.  When validating, it reports containers which
+// are still open.
+func (w *Writer) Close() error {
+	if w.validate && (len(w.stack) > 0 || w.key) {
+		w.fail("unclosed object or array")
+	}
+	return w.Flush()
+}
+
+func (w *Writer) fail(msg string) {
+	if w.err == nil {
+		w.err = errors.New("goj: " + msg)
+	}
+}
+
+// value prepares for a value to be written, returning false if it may not.
+func (w *Writer) value() bool {
+	if w.err != nil {
+		return false
+	}
+	if w.key {
+		w.key = false
+		return true
+	}
+	if w.validate && len(w.stack) > 0 && w.stack[len(w.stack)-1] == '{' {
+		w.fail("value inside an object without a key")
+		return false
+	}
+	if len(w.stack) > 0 {
+		w.member()
+	} else if w.comma {
+		w.buf = append(w.buf, '\n')
+		w.buf = append(w.buf, w.prefix...)
+	}
+	return true
+}
+
+// member writes what goes before a key or array element.
+func (w *Writer) member() {
+	if w.comma {
+		w.buf = append(w.buf, ',')
+		if w.spaced {
+			w.buf = append(w.buf, ' ')
+		}
+	}
+	if w.indented {
+		w.newline(len(w.stack))
+	}
+}
+
+func (w *Writer) newline(depth int) {
+	w.buf = append(w.buf, '\n')
+	w.buf = append(w.buf, w.prefix...)
+	for i := 0; i < depth; i++ {
+		w.buf = append(w.buf, w.indent...)
+	}
+}
+
+// quote appends s as a quoted string, escaped as configured.
+func (w *Writer) quote(s []byte) {
+	if w.escapeHTML || w.escapeNonASCII {
+		w.buf = appendEscaped(w.buf, s, w.escapeHTML, w.escapeNonASCII)
+	} else {
+		w.buf = appendQuoted(w.buf, s)
+	}
+}
+
+// quoteString is quote for a string.  Escaping more than the minimum works
+// on a copy of it.
+func (w *Writer) quoteString(s string) {
+	if w.escapeHTML || w.escapeNonASCII {
+		w.buf = appendEscaped(w.buf, []byte(s), w.escapeHTML, w.escapeNonASCII)
+	} else {
+		w.buf = appendQuotedString(w.buf, s)
+	}
+}
+
+// done finishes writing a value.
+func (w *Writer) done() {
+	w.comma = true
+	if w.out != nil && len(w.buf) >= flushSize {
+		w.Flush()
+	}
+}
+
+func (w *Writer) begin(c byte) {
+	if w.value() {
+		w.buf = append(w.buf, c)
+		w.stack = append(w.stack, c)
+		w.comma = false
+	}
+}
+
+func (w *Writer) end(open, close byte) {
+	if w.err != nil {
+		return
+	}
+	if w.validate && (len(w.stack) == 0 || w.stack[len(w.stack)-1] != open || w.key) {
+		w.fail("unbalanced '" + string(close) + "'")
+		return
+	}
+	if len(w.stack) > 0 {
+		w.stack = w.stack[:len(w.stack)-1]
+	}
+	if w.indented && w.comma {
+		w.newline(len(w.stack))
+	}
+	w.buf = append(w.buf, close)
+	w.done()
+}
+
+// BeginObject writes the '{' which opens an object.
+func (w *Writer) BeginObject() {
+	w.begin('{')
+}
+
+// EndObject writes the '}' which closes an object.
+func (w *Writer) EndObject() {
+	w.end('{', '}')
+}
+
+// BeginArray writes the '[' which opens an array.
+func (w *Writer) BeginArray() {
+	w.begin('[')
+}
+
+// EndArray writes the ']' which closes an array.
+func (w *Writer) EndArray() {
+	w.end('[', ']')
+}
+
+// Key writes the key of the next object member.
+func (w *Writer) Key(k string) {
+	if w.beginKey() {
+		w.quoteString(k)
+		w.endKey()
+	}
+}
+
+// KeyBytes writes the key of the next object member.
+func (w *Writer) KeyBytes(k []byte) {
+	w.writeKey(k, false)
+}
+
+// writeKey writes a key, which is already quoted and escaped if quoted is
+// set.
+func (w *Writer) writeKey(k []byte, quoted bool) {
+	if !w.beginKey() {
+		return
+	}
+	if quoted {
+		w.buf = append(w.buf, k...)
+	} else {
+		w.quote(k)
+	}
+	w.endKey()
+}
+
+// beginKey prepares for a key to be written, returning false if it may not.
+func (w *Writer) beginKey() bool {
+	if w.err != nil {
+		return false
+	}
+	if w.validate && (w.key || len(w.stack) == 0 || w.stack[len(w.stack)-1] != '{') {
+		w.fail("key outside of an object")
+		return false
+	}
+	w.member()
+	return true
+}
+
+// endKey finishes writing a key.
+func (w *Writer) endKey() {
+	w.buf = append(w.buf, ':')
+	if w.indented || w.spaced {
+		w.buf = append(w.buf, ' ')
+	}
+	w.key = true
+}
+
+// String writes a string value.
+func (w *Writer) String(s string) {
+	if w.value() {
+		w.quoteString(s)
+		w.done()
+	}
+}
+
+// StringBytes writes a string value.
+func (w *Writer) StringBytes(s []byte) {
+	if w.value() {
+		w.quote(s)
+		w.done()
+	}
+}
+
+// Int writes an integer value.
+func (w *Writer) Int(n int64) {
+	if w.value() {
+		w.buf = strconv.AppendInt(w.buf, n, 10)
+		w.done()
+	}
+}
+
+// Uint writes a non-negative integer value.
+func (w *Writer) Uint(n uint64) {
+	if w.value() {
+		w.buf = strconv.AppendUint(w.buf, n, 10)
+		w.done()
+	}
+}
+
+// Float writes a number value, formatted as encoding/json does.  NaN and
+// infinities can not be represented in JSON, and are an error.
+func (w *Writer) Float(f float64) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		w.fail("unsupported value " + strconv.FormatFloat(f, 'g', -1, 64))
+		return
+	}
+	if w.value() {
+		w.buf = appendFloat(w.buf, f)
+		w.done()
+	}
+}
+
+// Number writes the text of a number as is, like the value of a number
+// entity passed to a Callback.
+func (w *Writer) Number(v []byte) {
+	if w.validate && !isNumber(v) {
+		w.fail("invalid number " + strconv.Quote(string(v)))
+		return
+	}
+	if w.value() {
+		w.buf = append(w.buf, v...)
+		w.done()
+	}
+}
+
+// Bool writes true or false.
+func (w *Writer) Bool(b bool) {
+	if w.value() {
+		if b {
+			w.buf = append(w.buf, "true"...)
+		} else {
+			w.buf = append(w.buf, "false"...)
+		}
+		w.done()
+	}
+}
+
+// Null writes null.
+func (w *Writer) Null() {
+	if w.value() {
+		w.buf = append(w.buf, "null"...)
+		w.done()
+	}
+}
+
+// Raw writes v, which must be a complete JSON value, as is.
+func (w *Writer) Raw(v []byte) {
+	if w.value() {
+		w.buf = append(w.buf, v...)
+		w.done()
+	}
+}
+
+// appendFloat appends f formatted the way encoding/json does, in decimal
+// unless its magnitude is very small or large.
+func appendFloat(b []byte, f float64) []byte {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+const hex = "0123456789abcdef"
+
+// appendQuoted appends s to dst as a quoted JSON string.  Runs of characters
+// which need no escaping are found with the same routines the parser uses
+// to scan strings.
+func appendQuoted(dst []byte, s []byte) []byte {
+	scan := scanNonSpecialStringCharsASM
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		i += scan(s, i)
+		if i >= len(s) {
+			break
+		}
+		dst = append(dst, s[start:i]...)
+		dst = appendEscape(dst, s[i])
+		i++
+		start = i
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// appendQuotedString is appendQuoted for a string.
+func appendQuotedString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c == '"' || c == '\\' {
+			dst = append(dst, s[start:i]...)
+			dst = appendEscape(dst, c)
+			start = i + 1
+		}
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// appendEscape appends the escape of c, a quote, backslash or control
+// character.
+func appendEscape(dst []byte, c byte) []byte {
+	switch c {
+	case '"', '\\':
+		return append(dst, '\\', c)
+	case '\n':
+		return append(dst, '\\', 'n')
+	case '\r':
+		return append(dst, '\\', 'r')
+	case '\t':
+		return append(dst, '\\', 't')
+	case '\b':
+		return append(dst, '\\', 'b')
+	case '\f':
+		return append(dst, '\\', 'f')
+	}
+	return append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+}
+
+// appendEscaped is appendQuoted for when more than the minimum is escaped:
+// with html set <, > and & are, and with nonASCII everything beyond ASCII.
+// Invalid UTF-8 is replaced by U+FFFD in the latter case.  U+2028 and U+2029
+// are escaped in either case, as encoding/json does for JavaScript.
+func appendEscaped(dst []byte, s []byte, html, nonASCII bool) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && (!html || (c != '<' && c != '>' && c != '&')) {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			dst = appendEscape(dst, c)
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if !nonASCII && r != '\u2028' && r != '\u2029' {
+			i += size
+			continue
+		}
+		dst = append(dst, s[start:i]...)
+		if r > 0xFFFF {
+			r1, r2 := utf16.EncodeRune(r)
+			dst = appendRuneEscape(dst, r1)
+			dst = appendRuneEscape(dst, r2)
+		} else {
+			dst = appendRuneEscape(dst, r)
+		}
+		i += size
+		start = i
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+func appendRuneEscape(dst []byte, r rune) []byte {
+	return append(dst, '\\', 'u', hex[r>>12&0xF], hex[r>>8&0xF], hex[r>>4&0xF], hex[r&0xF])
+}